@@ -0,0 +1,212 @@
+// Утилита миграции базы данных
+//
+//	migrator [-config path] [-source-path dir] [-database-url url] [-dry-run] command [arg]
+//
+// Команды:
+//
+//	up [N]     применить все или N следующих миграций
+//	down [N]   откатить N миграций, по умолчанию одну
+//	goto V     перейти к версии V
+//	version    текущая версия схемы
+//	force V    установить версию V без выполнения миграций (после ошибки, оставившей схему dirty)
+//	status     список примененных и ожидающих миграций
+//
+// Адрес базы данных строится из config.Store (файл -config, AUTH_CONFIG_PATH или переменные AUTH_STORE_*).
+// По умолчанию используются миграции, встроенные в бинарный файл, -source-path задает каталог с файлами.
+// -dry-run выводит SQL миграций, которые были бы выполнены, не изменяя базу данных
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/migration"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+// migratorConfig - часть конфигурации сервиса, которая нужна для миграций
+type migratorConfig struct {
+	Store   config.Store   `yaml:"store"`
+	Secrets config.Secrets `yaml:"secrets"`
+}
+
+func main() {
+	var (
+		configPath  string
+		sourcePath  string
+		databaseUrl string
+		dryRun      bool
+	)
+	flag.StringVar(&configPath, "config", "", "path to config file")
+	flag.StringVar(&sourcePath, "source-path", "", "migrations directory, by default embedded migrations")
+	flag.StringVar(&databaseUrl, "database-url", "", "database url, by default built from store config")
+	flag.BoolVar(&dryRun, "dry-run", false, "print SQL without applying migrations")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: migrator [flags] up [N] | down [N] | goto V | version | force V | status\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := mustLoadStore(configPath)
+	if databaseUrl == "" {
+		var err error
+		if databaseUrl, err = migration.DatabaseUrl(cfg); err != nil {
+			log.Fatalf("migration failed: %v", err)
+		}
+	} else if strings.HasPrefix(databaseUrl, "sqlite3://") {
+		cfg.Driver = config.StoreDriverSQLite
+	} else {
+		cfg.Driver = config.StoreDriverPostgres
+	}
+
+	//golang-migrate закрывает свой источник, поэтому для плана открывается отдельный
+	migrateSrc, err := openSource(sourcePath, cfg.Driver)
+	if err != nil {
+		log.Fatalf("migration failed: %v", err)
+	}
+	m, err := migrate.NewWithSourceInstance("migrations", migrateSrc, databaseUrl)
+	if err != nil {
+		log.Fatalf("migration failed: %v", err)
+	}
+	defer m.Close()
+	src, err := openSource(sourcePath, cfg.Driver)
+	if err != nil {
+		log.Fatalf("migration failed: %v", err)
+	}
+	defer src.Close()
+
+	if err := run(m, src, flag.Arg(0), flag.Args()[1:], dryRun); err != nil {
+		log.Fatalf("migration failed: %v", err)
+	}
+}
+
+func run(m *migrate.Migrate, src source.Driver, command string, args []string, dryRun bool) error {
+	switch command {
+	case "up", "down":
+		//up без аргумента применяет все миграции, down без аргумента откатывает одну
+		n := 0
+		if command == "down" {
+			n = 1
+		}
+		if len(args) > 0 {
+			var err error
+			if n, err = parseArg(args); err != nil || n <= 0 {
+				return fmt.Errorf("%s: N must be a positive number", command)
+			}
+		}
+		if command == "down" {
+			n = -n
+		}
+		steps, err := planSteps(m, src, n)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return printPlan(src, steps)
+		}
+		if len(steps) == 0 {
+			log.Println("no change")
+			return nil
+		}
+		if n == 0 {
+			return m.Up()
+		}
+		return m.Steps(n)
+	case "goto":
+		v, err := parseArg(args)
+		if err != nil {
+			return fmt.Errorf("goto: %w", err)
+		}
+		steps, err := planGoto(m, src, uint(v))
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return printPlan(src, steps)
+		}
+		if len(steps) == 0 {
+			log.Println("no change")
+			return nil
+		}
+		return m.Migrate(uint(v))
+	case "version":
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Println("no migrations applied")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d%s\n", version, dirtyMark(dirty))
+		return nil
+	case "force":
+		v, err := parseArg(args)
+		if err != nil {
+			return fmt.Errorf("force: %w", err)
+		}
+		if dryRun {
+			fmt.Printf("-- force version %d\n", v)
+			return nil
+		}
+		return m.Force(v)
+	case "status":
+		return printStatus(m, src)
+	default:
+		return fmt.Errorf("unknown command '%s'", command)
+	}
+}
+func parseArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("exactly one numeric argument is required")
+	}
+	return strconv.Atoi(args[0])
+}
+func dirtyMark(dirty bool) string {
+	if dirty {
+		return " (dirty)"
+	}
+	return ""
+}
+
+// mustLoadStore читает config.Store так же, как сервис: из файла -config или AUTH_CONFIG_PATH,
+// иначе из переменных окружения
+func mustLoadStore(configPath string) *config.Store {
+	cfg := new(migratorConfig)
+	if configPath == "" {
+		configPath = os.Getenv("AUTH_CONFIG_PATH")
+	}
+	if configPath != "" {
+		if err := cleanenv.ReadConfig(configPath, cfg); err != nil {
+			log.Fatalf("CONFIG: %v\n", err)
+		}
+	} else if err := cleanenv.ReadEnv(cfg); err != nil {
+		log.Fatalf("CONFIG: %v\n", err)
+	}
+	if err := config.ResolveSecrets(context.Background(), cfg, &cfg.Secrets); err != nil {
+		log.Fatalf("CONFIG: %v\n", err)
+	}
+	return &cfg.Store
+}
+
+// openSource открывает каталог миграций sourcePath или, если он не задан, встроенные миграции драйвера
+func openSource(sourcePath string, driver string) (source.Driver, error) {
+	if sourcePath != "" {
+		return source.Open("file://" + sourcePath)
+	}
+	return migration.Source(driver)
+}
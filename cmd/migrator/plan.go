@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// step - одна миграция плана: up применяет version, down откатывает version к предыдущей
+type step struct {
+	version uint
+	up      bool
+}
+
+// currentVersion возвращает текущую версию схемы, applied=false если миграции не применялись
+func currentVersion(m *migrate.Migrate) (version uint, applied bool, err error) {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if dirty {
+		return 0, false, fmt.Errorf("schema version %d is dirty, fix it and run force", version)
+	}
+	return version, true, nil
+}
+
+// planSteps строит план для up (n >= 0, 0 - все) и down (n < 0)
+func planSteps(m *migrate.Migrate, src source.Driver, n int) ([]step, error) {
+	version, applied, err := currentVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	steps := []step{}
+	if n >= 0 {
+		next, err := nextVersion(src, version, applied)
+		for err == nil && (n == 0 || len(steps) < n) {
+			steps = append(steps, step{next, true})
+			next, err = src.Next(next)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return steps, nil
+	}
+	for applied && len(steps) < -n {
+		steps = append(steps, step{version, false})
+		prev, err := src.Prev(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		version = prev
+	}
+	return steps, nil
+}
+
+// planGoto строит план перехода к версии target
+func planGoto(m *migrate.Migrate, src source.Driver, target uint) ([]step, error) {
+	if _, _, err := src.ReadUp(target); err != nil {
+		return nil, fmt.Errorf("version %d: %w", target, err)
+	}
+	version, applied, err := currentVersion(m)
+	if err != nil {
+		return nil, err
+	}
+	steps := []step{}
+	if !applied || version < target {
+		next, err := nextVersion(src, version, applied)
+		for err == nil && next <= target {
+			steps = append(steps, step{next, true})
+			next, err = src.Next(next)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return steps, nil
+	}
+	for version > target {
+		steps = append(steps, step{version, false})
+		if version, err = src.Prev(version); err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+func nextVersion(src source.Driver, version uint, applied bool) (uint, error) {
+	if !applied {
+		return src.First()
+	}
+	return src.Next(version)
+}
+
+// printPlan выводит SQL миграций плана
+func printPlan(src source.Driver, steps []step) error {
+	if len(steps) == 0 {
+		fmt.Println("-- no change")
+		return nil
+	}
+	for _, s := range steps {
+		read, direction := src.ReadUp, "up"
+		if !s.up {
+			read, direction = src.ReadDown, "down"
+		}
+		r, identifier, err := read(s.version)
+		if err != nil {
+			return fmt.Errorf("version %d %s: %w", s.version, direction, err)
+		}
+		fmt.Printf("-- %d %s (%s)\n", s.version, identifier, direction)
+		_, err = io.Copy(os.Stdout, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// printStatus выводит миграции каталога с отметкой применена или ожидает. golang-migrate хранит только
+// текущую версию, поэтому примененными считаются все миграции не новее нее
+func printStatus(m *migrate.Migrate, src source.Driver) error {
+	version, dirty, err := m.Version()
+	applied := err == nil
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return err
+	}
+	next, err := src.First()
+	for err == nil {
+		r, identifier, readErr := src.ReadUp(next)
+		if readErr != nil {
+			return readErr
+		}
+		r.Close()
+		status := "pending"
+		if applied && next <= version {
+			status = "applied"
+			if next == version {
+				status += dirtyMark(dirty)
+			}
+		}
+		fmt.Printf("%-10d %-30s %s\n", next, identifier, status)
+		next, err = src.Next(next)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
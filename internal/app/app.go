@@ -0,0 +1,250 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os/signal"
+	"syscall"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/grpcserver"
+	"skillsRockGRPC/internal/health"
+	"skillsRockGRPC/internal/httpserver"
+	"skillsRockGRPC/internal/logger"
+	"skillsRockGRPC/internal/memstore"
+	"skillsRockGRPC/internal/metrics"
+	"skillsRockGRPC/internal/outbox"
+	"skillsRockGRPC/internal/password"
+	"skillsRockGRPC/internal/purge"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/scheduler"
+	"skillsRockGRPC/internal/service"
+	"skillsRockGRPC/internal/sqlitestore"
+	pgstore "skillsRockGRPC/internal/store"
+	"skillsRockGRPC/internal/tracing"
+	"skillsRockGRPC/internal/webhook"
+
+	"google.golang.org/grpc"
+)
+
+// App - сервис авторизации. Подсистемы запускаются в порядке зависимостей: хранилище, метрики, планировщик,
+// gRPC сервер, HTTP шлюз, отслеживание конфигурации. Остановка выполняется в обратном порядке: сервис
+// становится неготовым, шлюз и gRPC сервер завершают выполняющиеся запросы, останавливается планировщик,
+// закрывается хранилище
+type App struct {
+	lg         *slog.Logger
+	cfg        *config.Config
+	lifecycle  *Lifecycle
+	grpcServer *grpcserver.GRPCServer
+	httpServer *httpserver.HttpServer
+}
+
+// Option заменяет хранилище и адреса серверов, используется в тестах
+type Option func(*options)
+type options struct {
+	store        repository.Repository
+	grpcListener net.Listener
+	httpListener net.Listener
+	dialOpts     []grpc.DialOption
+}
+
+// WithStore заменяет хранилище из cfg.Store
+func WithStore(store repository.Repository) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithGRPCListener запускает gRPC сервер на listener вместо cfg.Grpc.Addr. dialOpts дополняют параметры
+// подключения HTTP шлюза к gRPC серверу, например grpc.WithContextDialer для bufconn
+func WithGRPCListener(listener net.Listener, dialOpts ...grpc.DialOption) Option {
+	return func(o *options) {
+		o.grpcListener = listener
+		o.dialOpts = dialOpts
+	}
+}
+
+// WithHTTPListener запускает HTTP шлюз на listener вместо cfg.Http.Addr
+func WithHTTPListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.httpListener = listener
+	}
+}
+
+func MustNew(lg *slog.Logger, cfg *config.Config, opts ...Option) *App {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	tr := tracing.MustNew(lg, &cfg.Tracing)
+
+	mt := metrics.New(lg, &cfg.Metrics)
+
+	hc := health.New(lg, cfg.Health.Timeout)
+
+	//задачи планировщика нескольких экземпляров сервиса разделяют advisory lock PostgreSQL,
+	//остальные хранилища рассчитаны на один узел
+	var store repository.Repository
+	var locker scheduler.Locker = scheduler.NewMemoryLocker()
+	switch {
+	case o.store != nil:
+		store = o.store
+	case cfg.Store.Driver == config.StoreDriverPostgres:
+		pgStore := pgstore.MustNew(lg, &cfg.Store)
+		mt.MustRegister(metrics.NewPoolCollector(pgStore.Stat))
+		hc.AddChecker("store", pgStore.Ping)
+		store, locker = pgStore, pgStore
+	case cfg.Store.Driver == config.StoreDriverSQLite:
+		sqliteStore := sqlitestore.MustNew(lg, &cfg.Store)
+		hc.AddChecker("store", sqliteStore.Ping)
+		store = sqliteStore
+	case cfg.Store.Driver == config.StoreDriverMemory:
+		lg.Warn("STORE: in-memory store is used, data will be lost on restart")
+		store = memstore.New()
+	default:
+		log.Fatalf("STORE: unknown driver '%s'\n", cfg.Store.Driver)
+	}
+
+	scheduler := scheduler.New(lg, &cfg.Scheduler, locker, store)
+
+	service := service.MustNew(store, service.NewStoreAuditSink(store, lg), password.New(&cfg.Password), scheduler, lg, &cfg.Token)
+
+	hc.AddChecker("signingKey", service.CheckSigningKey)
+	hc.AddChecker("scheduler", scheduler.Check)
+
+	grpcServer := grpcserver.New(service, hc, mt, lg, &cfg.Grpc)
+
+	httpServer := httpserver.MustNew(hc, lg, &cfg.Http, &cfg.Grpc, o.dialOpts...)
+
+	purger := purge.MustNew(store, lg, &cfg.Purge)
+	scheduler.RemoveRefreshTokens(purger.RefreshTokens)
+	scheduler.RemoveAuditEvents(purger.AuditEvents)
+
+	publisher := outbox.MustNewPublisher(&cfg.Outbox, webhook.Sign)
+	webhook := webhook.New(store, lg, &cfg.Webhook)
+	relay := outbox.New(store, outbox.MultiPublisher{publisher, webhook}, lg, &cfg.Outbox)
+	scheduler.RelayOutbox(relay.Relay)
+	scheduler.DeliverWebhooks(webhook.Deliver)
+
+	//время жизни токенов, уровень логирования, расписание задач и параметры очистки применяются без перезапуска
+	watcher := config.NewWatcher(lg, cfg)
+	watcher.Subscribe(func(cfg *config.Config) {
+		if err := logger.SetLevel(cfg.Env, cfg.LogLevel); err != nil {
+			lg.Error("LOGGER: level is not changed", slog.Any("error", err))
+		}
+	})
+	watcher.Subscribe(func(cfg *config.Config) { service.Reload(&cfg.Token) })
+	watcher.Subscribe(func(cfg *config.Config) {
+		if err := scheduler.Reload(&cfg.Scheduler); err != nil {
+			lg.Error("SCHEDULER: jobs are not reloaded", slog.Any("error", err))
+		}
+	})
+	watcher.Subscribe(func(cfg *config.Config) { purger.Reload(&cfg.Purge) })
+
+	lifecycle := NewLifecycle(lg)
+	lifecycle.Append(Hook{
+		Name: "tracing",
+		Stop: tr.Stop,
+	})
+	lifecycle.Append(Hook{
+		Name: "store",
+		Stop: func(ctx context.Context) error {
+			//переданное через WithStore хранилище закрывает владелец
+			if closer, ok := store.(io.Closer); ok && o.store == nil {
+				return closer.Close()
+			}
+			return nil
+		},
+	})
+	lifecycle.Append(Hook{
+		Name:  "metrics",
+		Start: func(ctx context.Context) error { return mt.Start() },
+		Stop:  mt.Stop,
+	})
+	lifecycle.Append(Hook{
+		Name:  "scheduler",
+		Start: func(ctx context.Context) error { scheduler.Start(); return nil },
+		Stop:  func(ctx context.Context) error { scheduler.Stop(); return nil },
+	})
+	lifecycle.Append(Hook{
+		Name: "grpc",
+		Start: func(ctx context.Context) error {
+			if o.grpcListener != nil {
+				grpcServer.Serve(o.grpcListener)
+				return nil
+			}
+			return grpcServer.Start()
+		},
+		Stop: grpcServer.Stop,
+	})
+	lifecycle.Append(Hook{
+		Name: "http",
+		Start: func(ctx context.Context) error {
+			if o.httpListener != nil {
+				httpServer.Serve(o.httpListener)
+				return nil
+			}
+			return httpServer.Start()
+		},
+		Stop: httpServer.Stop,
+	})
+	lifecycle.Append(Hook{
+		Name:  "config",
+		Start: func(ctx context.Context) error { watcher.Watch(); return nil },
+		Stop:  func(ctx context.Context) error { watcher.Stop(); return nil },
+	})
+	//добавляется последней, поэтому при остановке сервис первым делом сообщает о неготовности
+	lifecycle.Append(Hook{
+		Name: "readiness",
+		Stop: func(ctx context.Context) error {
+			hc.Shutdown()
+			grpcServer.Shutdown()
+			return nil
+		},
+	})
+
+	return &App{
+		lg:         lg,
+		cfg:        cfg,
+		lifecycle:  lifecycle,
+		grpcServer: grpcServer,
+		httpServer: httpServer,
+	}
+}
+
+// Start запускает подсистемы. При ошибке запуска уже запущенные подсистемы останавливаются
+func (a *App) Start(ctx context.Context) error {
+	return a.lifecycle.Start(ctx)
+}
+
+// Stop останавливает подсистемы не дольше срока ctx
+func (a *App) Stop(ctx context.Context) error {
+	return a.lifecycle.Stop(ctx)
+}
+
+// Run запускает приложение и ожидает SIGINT, SIGTERM, отмены ctx или ошибки сервера, после чего
+// останавливает приложение за время ShutdownTimeout
+func (a *App) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := a.Start(ctx); err != nil {
+		return err
+	}
+	var err error
+	select {
+	case <-ctx.Done():
+		a.lg.Info("APP: shutdown")
+	case err = <-a.grpcServer.Err():
+	case err = <-a.httpServer.Err():
+	}
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.cfg.ShutdownTimeout)
+	defer cancel()
+	if stopErr := a.Stop(stopCtx); stopErr != nil {
+		a.lg.Error("APP: shutdown error", slog.Any("error", stopErr))
+	}
+	return err
+}
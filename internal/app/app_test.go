@@ -0,0 +1,829 @@
+package app_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	auth "skillsRockGRPC/grpc/gen"
+	"skillsRockGRPC/internal/apptest"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/forwarded"
+	"skillsRockGRPC/internal/metrics"
+	"skillsRockGRPC/internal/outbox"
+	"skillsRockGRPC/internal/repository/dto"
+	"skillsRockGRPC/internal/requestid"
+	"skillsRockGRPC/internal/scheduler"
+	"skillsRockGRPC/internal/webhook"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const password = "correct-horse-1"
+
+func register(t *testing.T, h *apptest.Harness, login string) string {
+	t.Helper()
+	resp, err := h.Auth.Register(context.Background(), &auth.RegisterRequest{Login: login, Password: password})
+	if err != nil {
+		t.Fatalf("Register(%s): %v", login, err)
+	}
+	return resp.UserId
+}
+func login(t *testing.T, h *apptest.Harness, login string, deviceCode string) *auth.LoginResponse {
+	t.Helper()
+	resp, err := h.Auth.Login(context.Background(), &auth.LoginRequest{Login: login, Password: password, DeviceCode: deviceCode})
+	if err != nil {
+		t.Fatalf("Login(%s, %s): %v", login, deviceCode, err)
+	}
+	return resp
+}
+func refresh(t *testing.T, h *apptest.Harness, refreshToken string) (*auth.RefreshTokenResponse, error) {
+	t.Helper()
+	return h.Auth.RefreshToken(context.Background(), &auth.RefreshTokenRequest{
+		RefreshTokenId: h.Claims(t, refreshToken).Jti.String(),
+	})
+}
+func withToken(accessToken string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+accessToken)
+}
+
+// assertError проверяет код gRPC статуса и причину google.rpc.ErrorInfo
+func assertError(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+	if status.Code(err) != code || apptest.Reason(err) != reason {
+		t.Fatalf("error = %v (reason %q), want %s (reason %q)", err, apptest.Reason(err), code, reason)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	h := apptest.New(t)
+	userId := register(t, h, "alice")
+
+	tokens := login(t, h, "alice", "phone")
+	access := h.Claims(t, tokens.AccessToken)
+	if access.Sub.String() != userId || access.TokenType != "access" || access.DeviceCode != "phone" {
+		t.Fatalf("access token claims = %+v", access)
+	}
+	if refreshClaims := h.Claims(t, tokens.RefreshToken); refreshClaims.TokenType != "refresh" {
+		t.Fatalf("refresh token type = %s", refreshClaims.TokenType)
+	}
+
+	//refresh выдает новую пару и отзывает использованный токен
+	rotated, err := refresh(t, h, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if rotated.RefreshToken == tokens.RefreshToken || h.Claims(t, rotated.AccessToken).Sub.String() != userId {
+		t.Fatalf("RefreshToken did not rotate tokens")
+	}
+
+	//повторное использование отозванного токена отзывает все токены устройства
+	_, err = refresh(t, h, tokens.RefreshToken)
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonTokenRevoked)
+	_, err = refresh(t, h, rotated.RefreshToken)
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonTokenRevoked)
+
+	//новый вход после отзыва и выход
+	tokens = login(t, h, "alice", "phone")
+	if _, err := h.Auth.Logout(context.Background(), &auth.LogoutRequest{UserId: userId, DeviceCode: "phone"}); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	_, err = refresh(t, h, tokens.RefreshToken)
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonTokenRevoked)
+}
+
+func TestBusinessMetrics(t *testing.T) {
+	h := apptest.New(t)
+	register(t, h, "alice")
+	counter := func(collector prometheus.Collector) float64 {
+		return testutil.ToFloat64(collector)
+	}
+	successBefore := counter(metrics.LoginsTotal.WithLabelValues(entity.AuditOutcomeSuccess))
+	failureBefore := counter(metrics.LoginsTotal.WithLabelValues(entity.AuditOutcomeFailure))
+	accessBefore := counter(metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeAccess))
+	refreshBefore := counter(metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeRefresh))
+	reuseBefore := counter(metrics.RefreshTokenReuseTotal)
+
+	tokens := login(t, h, "alice", "phone")
+	if _, err := h.Auth.Login(context.Background(), &auth.LoginRequest{Login: "alice", Password: "wrong-password-1", DeviceCode: "phone"}); err == nil {
+		t.Fatal("Login with wrong password succeeded")
+	}
+	if _, err := refresh(t, h, tokens.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	refresh(t, h, tokens.RefreshToken)
+
+	//вход и обновление выдают по паре токенов, повторное использование отозванного токена учитывается отдельно
+	for _, tt := range []struct {
+		name   string
+		before float64
+		after  float64
+		want   float64
+	}{
+		{"logins_total success", successBefore, counter(metrics.LoginsTotal.WithLabelValues(entity.AuditOutcomeSuccess)), 1},
+		{"logins_total failure", failureBefore, counter(metrics.LoginsTotal.WithLabelValues(entity.AuditOutcomeFailure)), 1},
+		{"tokens_issued_total access", accessBefore, counter(metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeAccess)), 2},
+		{"tokens_issued_total refresh", refreshBefore, counter(metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeRefresh)), 2},
+		{"refresh_token_reuse_total", reuseBefore, counter(metrics.RefreshTokenReuseTotal), 1},
+	} {
+		if got := tt.after - tt.before; got != tt.want {
+			t.Fatalf("%s increased by %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshTokenNotFound(t *testing.T) {
+	h := apptest.New(t)
+	_, err := h.Auth.RefreshToken(context.Background(), &auth.RefreshTokenRequest{RefreshTokenId: uuid.NewString()})
+	assertError(t, err, codes.NotFound, servererrors.ReasonTokenNotFound)
+	_, err = h.Auth.RefreshToken(context.Background(), &auth.RefreshTokenRequest{RefreshTokenId: "not-a-uuid"})
+	assertError(t, err, codes.InvalidArgument, servererrors.ReasonInvalidArgument)
+}
+
+func TestRegister(t *testing.T) {
+	h := apptest.New(t)
+	register(t, h, "alice")
+
+	_, err := h.Auth.Register(context.Background(), &auth.RegisterRequest{Login: "alice", Password: password})
+	assertError(t, err, codes.AlreadyExists, servererrors.ReasonLoginAlreadyExists)
+
+	//политика паролей
+	_, err = h.Auth.Register(context.Background(), &auth.RegisterRequest{Login: "bob", Password: "short"})
+	assertError(t, err, codes.InvalidArgument, servererrors.ReasonInvalidArgument)
+	_, err = h.Auth.Register(context.Background(), &auth.RegisterRequest{Login: "bob.smith", Password: "bob.smith"})
+	assertError(t, err, codes.InvalidArgument, servererrors.ReasonInvalidArgument)
+
+	//проверка запроса по правилам protovalidate
+	_, err = h.Auth.Register(context.Background(), &auth.RegisterRequest{Login: "b!", Password: password})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Register with invalid login: %v", err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	h := apptest.New(t)
+	register(t, h, "alice")
+
+	_, err := h.Auth.Login(context.Background(), &auth.LoginRequest{Login: "alice", Password: "wrong-password-1", DeviceCode: "phone"})
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidCredentials)
+	_, err = h.Auth.Login(context.Background(), &auth.LoginRequest{Login: "bob", Password: password, DeviceCode: "phone"})
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidCredentials)
+
+	//вход на устройстве отзывает прежние токены этого устройства, но не других устройств
+	first := login(t, h, "alice", "phone")
+	laptop := login(t, h, "alice", "laptop")
+	login(t, h, "alice", "phone")
+	_, err = refresh(t, h, first.RefreshToken)
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonTokenRevoked)
+	if _, err := refresh(t, h, laptop.RefreshToken); err != nil {
+		t.Fatalf("RefreshToken(laptop): %v", err)
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	h := apptest.New(t)
+	userId := register(t, h, "alice")
+	phone := login(t, h, "alice", "phone")
+	laptop := login(t, h, "alice", "laptop")
+
+	const newPassword = "battery-staple-2"
+	if _, err := h.Auth.UpdatePassword(context.Background(), &auth.UpdatePasswordRequest{UserId: userId, NewPassword: newPassword}); err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	//смена пароля отзывает токены всех устройств
+	for _, tokens := range []*auth.LoginResponse{phone, laptop} {
+		_, err := refresh(t, h, tokens.RefreshToken)
+		assertError(t, err, codes.Unauthenticated, servererrors.ReasonTokenRevoked)
+	}
+	_, err := h.Auth.Login(context.Background(), &auth.LoginRequest{Login: "alice", Password: password, DeviceCode: "phone"})
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidCredentials)
+	if _, err := h.Auth.Login(context.Background(), &auth.LoginRequest{Login: "alice", Password: newPassword, DeviceCode: "phone"}); err != nil {
+		t.Fatalf("Login with new password: %v", err)
+	}
+
+	//история паролей
+	_, err = h.Auth.UpdatePassword(context.Background(), &auth.UpdatePasswordRequest{UserId: userId, NewPassword: newPassword})
+	assertError(t, err, codes.InvalidArgument, servererrors.ReasonInvalidArgument)
+
+	_, err = h.Auth.UpdatePassword(context.Background(), &auth.UpdatePasswordRequest{UserId: uuid.NewString(), NewPassword: newPassword})
+	assertError(t, err, codes.NotFound, servererrors.ReasonUserNotFound)
+}
+
+func TestUnregister(t *testing.T) {
+	h := apptest.New(t)
+	userId := register(t, h, "alice")
+	tokens := login(t, h, "alice", "phone")
+
+	if _, err := h.Auth.Unregister(context.Background(), &auth.UnregisterRequest{UserId: userId}); err != nil {
+		t.Fatalf("Unregister: %v", err)
+	}
+	_, err := h.Auth.Unregister(context.Background(), &auth.UnregisterRequest{UserId: userId})
+	assertError(t, err, codes.NotFound, servererrors.ReasonUserNotFound)
+	_, err = h.Auth.Login(context.Background(), &auth.LoginRequest{Login: "alice", Password: password, DeviceCode: "phone"})
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidCredentials)
+	_, err = refresh(t, h, tokens.RefreshToken)
+	assertError(t, err, codes.NotFound, servererrors.ReasonTokenNotFound)
+
+	//логин освобождается
+	register(t, h, "alice")
+}
+
+func TestListSessions(t *testing.T) {
+	h := apptest.New(t)
+	userId := register(t, h, "alice")
+	phone := login(t, h, "alice", "phone")
+	login(t, h, "alice", "laptop")
+
+	deviceCodes := func() []string {
+		t.Helper()
+		resp, err := h.Auth.ListSessions(withToken(phone.AccessToken), &auth.ListSessionsRequest{UserId: userId})
+		if err != nil {
+			t.Fatalf("ListSessions: %v", err)
+		}
+		var deviceCodes []string
+		for _, session := range resp.Sessions {
+			//идентификатор refresh токена не раскрывается
+			if session.SessionId == h.Claims(t, phone.RefreshToken).Jti.String() {
+				t.Fatalf("session id is refresh token id")
+			}
+			deviceCodes = append(deviceCodes, session.DeviceCode)
+		}
+		slices.Sort(deviceCodes)
+		return deviceCodes
+	}
+	if got := deviceCodes(); !slices.Equal(got, []string{"laptop", "phone"}) {
+		t.Fatalf("sessions = %v", got)
+	}
+	if _, err := h.Auth.Logout(context.Background(), &auth.LogoutRequest{UserId: userId, DeviceCode: "laptop"}); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if got := deviceCodes(); !slices.Equal(got, []string{"phone"}) {
+		t.Fatalf("sessions after logout = %v", got)
+	}
+}
+
+func TestListSessionsAuthorization(t *testing.T) {
+	h := apptest.New(t)
+	userId := register(t, h, "alice")
+	login(t, h, "alice", "phone")
+	register(t, h, "bob")
+	bob := login(t, h, "bob", "phone").AccessToken
+	adminId := register(t, h, "admin")
+	h.Store.MakeAdmin(uuidOf(t, adminId))
+	admin := login(t, h, "admin", "console").AccessToken
+
+	_, err := h.Auth.ListSessions(context.Background(), &auth.ListSessionsRequest{UserId: userId})
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidAccessToken)
+	_, err = h.Auth.ListSessions(withToken(bob), &auth.ListSessionsRequest{UserId: userId})
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonPermissionDenied)
+
+	resp, err := h.Auth.ListSessions(withToken(admin), &auth.ListSessionsRequest{UserId: userId})
+	if err != nil || len(resp.Sessions) != 1 {
+		t.Fatalf("ListSessions by admin = %v, %v", resp, err)
+	}
+}
+
+func TestExchangeToken(t *testing.T) {
+	h := apptest.New(t, apptest.WithConfig(func(cfg *config.Config) {
+		cfg.Token.Exchange.Actors = []config.Actor{
+			{Name: "gateway", Secret: "gateway-secret", Audiences: []string{"orders"}, Scopes: []string{"read", "write"}},
+		}
+	}))
+	aliceId := register(t, h, "alice")
+	tokens := login(t, h, "alice", "phone")
+
+	request := func() *auth.ExchangeTokenRequest {
+		return &auth.ExchangeTokenRequest{
+			SubjectToken: tokens.AccessToken,
+			ActorName:    "gateway",
+			ActorSecret:  "gateway-secret",
+			Audience:     "orders",
+			Scopes:       []string{"read"},
+		}
+	}
+	resp, err := h.Auth.ExchangeToken(context.Background(), request())
+	if err != nil {
+		t.Fatalf("ExchangeToken: %v", err)
+	}
+	claims := h.Claims(t, resp.AccessToken)
+	if claims.Act == nil || claims.Act.Sub != "gateway" || !slices.Equal(claims.Audience, []string{"orders"}) || claims.Scope != "read" {
+		t.Fatalf("exchange token claims = %+v", claims)
+	}
+
+	req := request()
+	req.ActorSecret = "wrong"
+	_, err = h.Auth.ExchangeToken(context.Background(), req)
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidActorCredentials)
+	req = request()
+	req.Audience = "billing"
+	_, err = h.Auth.ExchangeToken(context.Background(), req)
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonAudienceNotAllowed)
+	req = request()
+	req.Scopes = []string{"admin"}
+	_, err = h.Auth.ExchangeToken(context.Background(), req)
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonScopeNotAllowed)
+	req = request()
+	req.SubjectToken = tokens.RefreshToken
+	_, err = h.Auth.ExchangeToken(context.Background(), req)
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidSubjectToken)
+
+	//повторный обмен не расширяет scopes исходного токена обмена
+	req = request()
+	req.SubjectToken = resp.AccessToken
+	if _, err := h.Auth.ExchangeToken(context.Background(), req); err != nil {
+		t.Fatalf("ExchangeToken of exchanged token: %v", err)
+	}
+	req.Scopes = []string{"read", "write"}
+	_, err = h.Auth.ExchangeToken(context.Background(), req)
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonScopeNotAllowed)
+
+	//обмен и отказы записываются в журнал аудита
+	events, err := h.Store.GetAuditEvents(context.Background(), &dto.GetAuditEvents{UserId: uuidOf(t, aliceId), Limit: 100})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	outcomes := map[string]int{}
+	for _, event := range events {
+		if event.EventType == entity.AuditEventExchangeToken && event.ActorId == "gateway" {
+			outcomes[event.Outcome]++
+		}
+	}
+	if outcomes[entity.AuditOutcomeSuccess] != 2 || outcomes[entity.AuditOutcomeFailure] != 3 {
+		t.Fatalf("exchange audit events = %v", outcomes)
+	}
+
+	//токен обмена не дает прав администратора
+	_, err = h.Auth.QueryAuditEvents(withToken(resp.AccessToken), &auth.QueryAuditEventsRequest{})
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonPermissionDenied)
+}
+
+func TestAdmin(t *testing.T) {
+	h := apptest.New(t)
+	adminId := register(t, h, "admin")
+	h.Store.MakeAdmin(uuidOf(t, adminId))
+	userId := register(t, h, "alice")
+	admin := login(t, h, "admin", "console").AccessToken
+	user := login(t, h, "alice", "phone").AccessToken
+
+	_, err := h.Auth.QueryAuditEvents(context.Background(), &auth.QueryAuditEventsRequest{})
+	assertError(t, err, codes.Unauthenticated, servererrors.ReasonInvalidAccessToken)
+	_, err = h.Auth.QueryAuditEvents(withToken(user), &auth.QueryAuditEventsRequest{})
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonPermissionDenied)
+
+	events, err := h.Auth.QueryAuditEvents(withToken(admin), &auth.QueryAuditEventsRequest{UserId: userId})
+	if err != nil {
+		t.Fatalf("QueryAuditEvents: %v", err)
+	}
+	var eventTypes []string
+	for _, event := range events.Events {
+		eventTypes = append(eventTypes, event.EventType)
+	}
+	if !slices.Contains(eventTypes, entity.AuditEventRegister) || !slices.Contains(eventTypes, entity.AuditEventLogin) {
+		t.Fatalf("audit events = %v", eventTypes)
+	}
+
+	impersonation, err := h.Auth.Impersonate(withToken(admin), &auth.ImpersonateRequest{UserId: userId, Reason: "support ticket"})
+	if err != nil {
+		t.Fatalf("Impersonate: %v", err)
+	}
+	claims := h.Claims(t, impersonation.AccessToken)
+	if claims.Sub.String() != userId || claims.Act == nil || claims.Act.Sub != adminId {
+		t.Fatalf("impersonation token claims = %+v", claims)
+	}
+	_, err = h.Auth.Impersonate(withToken(admin), &auth.ImpersonateRequest{UserId: adminId, Reason: "self"})
+	assertError(t, err, codes.InvalidArgument, servererrors.ReasonCannotImpersonateSelf)
+	//токен имперсонации не дает прав администратора
+	_, err = h.Auth.Impersonate(withToken(impersonation.AccessToken), &auth.ImpersonateRequest{UserId: adminId, Reason: "escalation"})
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonPermissionDenied)
+	_, err = h.Auth.Impersonate(withToken(user), &auth.ImpersonateRequest{UserId: adminId, Reason: "curious"})
+	assertError(t, err, codes.PermissionDenied, servererrors.ReasonPermissionDenied)
+
+	//отказы в имперсонации записываются в журнал аудита с инициатором
+	events, err = h.Auth.QueryAuditEvents(withToken(admin), &auth.QueryAuditEventsRequest{UserId: adminId})
+	if err != nil {
+		t.Fatalf("QueryAuditEvents: %v", err)
+	}
+	denied := 0
+	for _, event := range events.Events {
+		if event.EventType == entity.AuditEventImpersonate && event.Outcome == entity.AuditOutcomeFailure && event.ActorId == userId {
+			denied++
+		}
+	}
+	if denied != 2 {
+		t.Fatalf("denied impersonation audit events = %d, want 2", denied)
+	}
+}
+
+func TestAuditClientIp(t *testing.T) {
+	h := apptest.New(t)
+	adminId := register(t, h, "admin")
+	h.Store.MakeAdmin(uuidOf(t, adminId))
+	const spoofed = "203.0.113.1"
+
+	//адрес из метаданных клиента gRPC не принимается
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", spoofed, forwarded.MetadataKey, "guess "+spoofed)
+	if _, err := h.Auth.Login(ctx, &auth.LoginRequest{Login: "admin", Password: password, DeviceCode: "console"}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	//шлюз передает адрес соединения, а не заголовок X-Forwarded-For
+	req, _ := http.NewRequest(http.MethodPost, h.HTTP.URL("/api/v1/login"), strings.NewReader(`{"login":"admin","password":"`+password+`","deviceCode":"browser"}`))
+	req.Header.Set("X-Forwarded-For", spoofed)
+	resp, err := (&http.Client{Transport: h.HTTP.Transport()}).Do(req)
+	if err != nil {
+		t.Fatalf("POST login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST login status = %d", resp.StatusCode)
+	}
+
+	admin := login(t, h, "admin", "console").AccessToken
+	events, err := h.Auth.QueryAuditEvents(withToken(admin), &auth.QueryAuditEventsRequest{UserId: adminId})
+	if err != nil {
+		t.Fatalf("QueryAuditEvents: %v", err)
+	}
+	logins := 0
+	for _, event := range events.Events {
+		if event.EventType != entity.AuditEventLogin {
+			continue
+		}
+		logins++
+		if event.Ip == "" || event.Ip == spoofed {
+			t.Fatalf("login audit event ip = %q", event.Ip)
+		}
+	}
+	if logins != 3 {
+		t.Fatalf("login audit events = %d", logins)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	h := apptest.New(t)
+	adminId := register(t, h, "admin")
+	h.Store.MakeAdmin(uuidOf(t, adminId))
+	admin := login(t, h, "admin", "console").AccessToken
+
+	jobs, err := h.Auth.ListJobs(withToken(admin), &auth.ListJobsRequest{})
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	if len(jobs.Jobs) != 4 {
+		t.Fatalf("jobs = %v", jobs.Jobs)
+	}
+	run, err := h.Auth.RunJob(withToken(admin), &auth.RunJobRequest{Name: scheduler.JobRemoveRefreshTokens})
+	if err != nil {
+		t.Fatalf("RunJob: %v", err)
+	}
+	if run.Run == nil || run.Run.Error != "" {
+		t.Fatalf("job run = %v", run.Run)
+	}
+	_, err = h.Auth.RunJob(withToken(admin), &auth.RunJobRequest{Name: "unknown"})
+	assertError(t, err, codes.NotFound, servererrors.ReasonJobNotFound)
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	h := apptest.New(t)
+	adminId := register(t, h, "admin")
+	h.Store.MakeAdmin(uuidOf(t, adminId))
+	admin := login(t, h, "admin", "console").AccessToken
+
+	created, err := h.Auth.CreateWebhookSubscription(withToken(admin), &auth.CreateWebhookSubscriptionRequest{
+		Url:        "https://example.com/hook",
+		EventTypes: []string{"user.registered"},
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhookSubscription: %v", err)
+	}
+	if created.Secret == "" {
+		t.Fatalf("subscription secret is empty")
+	}
+	list, err := h.Auth.ListWebhookSubscriptions(withToken(admin), &auth.ListWebhookSubscriptionsRequest{})
+	if err != nil || len(list.Subscriptions) != 1 || list.Subscriptions[0].SubscriptionId != created.SubscriptionId {
+		t.Fatalf("ListWebhookSubscriptions = %v, %v", list, err)
+	}
+	if _, err := h.Auth.DeleteWebhookSubscription(withToken(admin), &auth.DeleteWebhookSubscriptionRequest{SubscriptionId: created.SubscriptionId}); err != nil {
+		t.Fatalf("DeleteWebhookSubscription: %v", err)
+	}
+	_, err = h.Auth.DeleteWebhookSubscription(withToken(admin), &auth.DeleteWebhookSubscriptionRequest{SubscriptionId: created.SubscriptionId})
+	assertError(t, err, codes.NotFound, servererrors.ReasonSubscriptionNotFound)
+}
+
+// webhookReceiver проверяет подпись запросов и отвечает кодами из statuses по очереди, затем 200
+type webhookReceiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	secret   string
+	statuses []int
+	requests []outbox.Message
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Errorf("read webhook body: %v", err)
+	}
+	if err := webhook.Verify(r.secret, req.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+		r.t.Errorf("webhook signature: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var message outbox.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		r.t.Errorf("webhook body: %v", err)
+	}
+	r.requests = append(r.requests, message)
+	statusCode := http.StatusOK
+	if len(r.statuses) > 0 {
+		statusCode, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(statusCode)
+}
+func (r *webhookReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	const backoff = 500 * time.Millisecond
+	h := apptest.New(t, apptest.WithConfig(func(cfg *config.Config) {
+		cfg.Webhook.BackoffBase = backoff
+		cfg.Webhook.BackoffMax = backoff
+	}))
+	adminId := register(t, h, "admin")
+	h.Store.MakeAdmin(uuidOf(t, adminId))
+	admin := login(t, h, "admin", "console").AccessToken
+	runJob := func(name string) {
+		t.Helper()
+		if _, err := h.Auth.RunJob(withToken(admin), &auth.RunJobRequest{Name: name}); err != nil {
+			t.Fatalf("RunJob(%s): %v", name, err)
+		}
+	}
+	//событие регистрации администратора публикуется до создания подписки
+	runJob(scheduler.JobRelayOutbox)
+
+	receiver := &webhookReceiver{t: t, statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	created, err := h.Auth.CreateWebhookSubscription(withToken(admin), &auth.CreateWebhookSubscriptionRequest{
+		Url:        server.URL,
+		EventTypes: []string{entity.EventUserRegistered},
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhookSubscription: %v", err)
+	}
+	receiver.mu.Lock()
+	receiver.secret = created.Secret
+	receiver.mu.Unlock()
+	userId := register(t, h, "alice")
+
+	delivery := func() *auth.WebhookDelivery {
+		t.Helper()
+		resp, err := h.Auth.ListWebhookDeliveries(withToken(admin), &auth.ListWebhookDeliveriesRequest{SubscriptionId: created.SubscriptionId})
+		if err != nil || len(resp.Deliveries) != 1 {
+			t.Fatalf("ListWebhookDeliveries = %v, %v", resp, err)
+		}
+		return resp.Deliveries[0]
+	}
+
+	//ответ 5xx откладывает повтор на время backoff
+	runJob(scheduler.JobRelayOutbox)
+	runJob(scheduler.JobDeliverWebhooks)
+	failedAt := time.Now()
+	if got := delivery(); got.Status != entity.WebhookDeliveryStatusPending || got.Attempts != 1 || got.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("delivery after 503 = %v", got)
+	}
+	runJob(scheduler.JobDeliverWebhooks)
+	if receiver.count() != 1 && time.Since(failedAt) < backoff {
+		t.Fatalf("delivery retried before backoff, requests = %d", receiver.count())
+	}
+	time.Sleep(backoff)
+	runJob(scheduler.JobDeliverWebhooks)
+	if got := delivery(); got.Status != entity.WebhookDeliveryStatusDelivered || got.Attempts != 2 || got.DeliveredAt == "" {
+		t.Fatalf("delivery after retry = %v", got)
+	}
+	receiver.mu.Lock()
+	if len(receiver.requests) != 2 || receiver.requests[1].Type != entity.EventUserRegistered || receiver.requests[0].Id != receiver.requests[1].Id {
+		t.Fatalf("webhook requests = %+v", receiver.requests)
+	}
+	if !strings.Contains(string(receiver.requests[1].Data), userId) {
+		t.Fatalf("webhook data = %s", receiver.requests[1].Data)
+	}
+	receiver.mu.Unlock()
+
+	//повтор события реле не создает вторую доставку
+	runJob(scheduler.JobRelayOutbox)
+	delivery()
+
+	//ReplayDelivery отправляет доставленное событие повторно
+	if _, err := h.Auth.ReplayDelivery(withToken(admin), &auth.ReplayDeliveryRequest{DeliveryId: delivery().DeliveryId}); err != nil {
+		t.Fatalf("ReplayDelivery: %v", err)
+	}
+	runJob(scheduler.JobDeliverWebhooks)
+	if receiver.count() != 3 {
+		t.Fatalf("requests after replay = %d, want 3", receiver.count())
+	}
+	if got := delivery(); got.Status != entity.WebhookDeliveryStatusDelivered || got.Attempts != 1 {
+		t.Fatalf("delivery after replay = %v", got)
+	}
+	_, err = h.Auth.ReplayDelivery(withToken(admin), &auth.ReplayDeliveryRequest{DeliveryId: uuid.NewString()})
+	assertError(t, err, codes.NotFound, servererrors.ReasonDeliveryNotFound)
+}
+
+func TestGateway(t *testing.T) {
+	h := apptest.New(t)
+	ctx := context.Background()
+
+	var registered auth.RegisterResponse
+	if err := h.HTTP.Call(ctx, "Register", "", &auth.RegisterRequest{Login: "alice", Password: password}, &registered); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	var tokens auth.LoginResponse
+	if err := h.HTTP.Call(ctx, "Login", "", &auth.LoginRequest{Login: "alice", Password: password, DeviceCode: "browser"}, &tokens); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if h.Claims(t, tokens.AccessToken).Sub.String() != registered.UserId {
+		t.Fatalf("access token subject is not %s", registered.UserId)
+	}
+	var sessions auth.ListSessionsResponse
+	if err := h.HTTP.Call(ctx, "ListSessions", tokens.AccessToken, &auth.ListSessionsRequest{UserId: registered.UserId}, &sessions); err != nil || len(sessions.Sessions) != 1 {
+		t.Fatalf("ListSessions = %v, %v", &sessions, err)
+	}
+
+	//ошибки передаются в формате {"error": {...}} с причиной и нарушениями полей
+	err := h.HTTP.Call(ctx, "Login", "", &auth.LoginRequest{Login: "alice", Password: "wrong-password-1", DeviceCode: "browser"}, &auth.LoginResponse{})
+	httpErr, ok := err.(*apptest.HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusUnauthorized || httpErr.Detail.Reason != servererrors.ReasonInvalidCredentials || httpErr.Header.Get("WWW-Authenticate") != `Bearer realm="auth"` {
+		t.Fatalf("Login with wrong password: %v", err)
+	}
+	err = h.HTTP.Call(ctx, "QueryAuditEvents", "not-a-token", &auth.QueryAuditEventsRequest{}, &auth.QueryAuditEventsResponse{})
+	httpErr, ok = err.(*apptest.HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusUnauthorized || httpErr.Header.Get("WWW-Authenticate") != `Bearer realm="auth", error="invalid_token"` {
+		t.Fatalf("QueryAuditEvents with invalid token: %v", err)
+	}
+	err = h.HTTP.Call(ctx, "Register", "", &auth.RegisterRequest{Login: "bob", Password: "short"}, &auth.RegisterResponse{})
+	httpErr, ok = err.(*apptest.HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusBadRequest || len(httpErr.Detail.FieldViolations) == 0 || httpErr.Detail.RequestId == "" {
+		t.Fatalf("Register with short password: %v", err)
+	}
+	err = h.HTTP.Call(ctx, "QueryAuditEvents", tokens.AccessToken, &auth.QueryAuditEventsRequest{}, &auth.QueryAuditEventsResponse{})
+	if apptest.Reason(err) != servererrors.ReasonPermissionDenied {
+		t.Fatalf("QueryAuditEvents: %v", err)
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	h := apptest.New(t)
+	register(t, h, "alice")
+
+	//шлюз сохраняет X-Request-Id клиента, передает его gRPC серверу и возвращает в ответе
+	post := func(requestId string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, h.HTTP.URL("/api/v1/login"), strings.NewReader(`{"login":"alice","password":"`+password+`","deviceCode":"browser"}`))
+		if requestId != "" {
+			req.Header.Set(requestid.Header, requestId)
+		}
+		resp, err := (&http.Client{Transport: h.HTTP.Transport()}).Do(req)
+		if err != nil {
+			t.Fatalf("POST login: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST login status = %d", resp.StatusCode)
+		}
+		return resp
+	}
+	resp := post("client-request-1")
+	if got := resp.Header.Get(requestid.Header); got != "client-request-1" {
+		t.Fatalf("X-Request-Id = %q", got)
+	}
+	if got := resp.Header.Get(runtime.MetadataHeaderPrefix + requestid.MetadataKey); got != "client-request-1" {
+		t.Fatalf("request id from gRPC server = %q, header %v", got, resp.Header)
+	}
+	resp = post("")
+	if got := resp.Header.Get(requestid.Header); got == "" || resp.Header.Get(runtime.MetadataHeaderPrefix+requestid.MetadataKey) != got {
+		t.Fatalf("generated X-Request-Id = %q, header %v", got, resp.Header)
+	}
+
+	//gRPC сервер возвращает идентификатор в заголовках ответа, в том числе при ошибке
+	for _, attempt := range []string{password, "wrong-password-1"} {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), requestid.MetadataKey, "client-request-2")
+		h.Auth.Login(ctx, &auth.LoginRequest{Login: "alice", Password: attempt, DeviceCode: "console"}, grpc.Header(&header))
+		if got := header.Get(requestid.MetadataKey); len(got) != 1 || got[0] != "client-request-2" {
+			t.Fatalf("x-request-id = %v", got)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	h := apptest.New(t)
+	register(t, h, "alice")
+	recorder.Reset()
+
+	//контекст трассировки клиента продолжается в шлюзе, gRPC клиенте шлюза и gRPC сервере
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodPost, h.HTTP.URL("/api/v1/login"), strings.NewReader(`{"login":"alice","password":"`+password+`","deviceCode":"browser"}`))
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	req.Header.Set(requestid.Header, "traced-request")
+	resp, err := (&http.Client{Transport: h.HTTP.Transport()}).Do(req)
+	if err != nil {
+		t.Fatalf("POST login: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST login status = %d", resp.StatusCode)
+	}
+
+	var gateway, client, server sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceId {
+			t.Fatalf("span %q has trace id %s, want %s", span.Name(), span.SpanContext().TraceID(), traceId)
+		}
+		switch {
+		case span.SpanKind() == trace.SpanKindServer && span.Name() == "POST /api/v1/login":
+			gateway = span
+		case span.SpanKind() == trace.SpanKindServer:
+			server = span
+		case span.SpanKind() == trace.SpanKindClient:
+			client = span
+		}
+	}
+	if gateway == nil || client == nil || server == nil {
+		t.Fatalf("recorded %d spans, want gateway, gRPC client and gRPC server spans", len(recorder.Ended()))
+	}
+	if client.Name() != "auth.AuthService/Login" || server.Name() != "auth.AuthService/Login" {
+		t.Fatalf("gRPC span names = %q, %q", client.Name(), server.Name())
+	}
+	if client.Parent().SpanID() != gateway.SpanContext().SpanID() || server.Parent().SpanID() != client.SpanContext().SpanID() {
+		t.Fatal("gRPC spans are not children of the gateway span")
+	}
+	values := map[attribute.Key]string{}
+	for _, kv := range server.Attributes() {
+		values[kv.Key] = kv.Value.Emit()
+	}
+	for key, want := range map[attribute.Key]string{
+		"rpc.system":           "grpc",
+		"rpc.service":          "auth.AuthService",
+		"rpc.method":           "Login",
+		"rpc.grpc.status_code": "0",
+		"request.id":           "traced-request",
+	} {
+		if values[key] != want {
+			t.Fatalf("gRPC server span attribute %s = %q, want %q", key, values[key], want)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	h := apptest.New(t)
+	for path, want := range map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusOK} {
+		resp, err := h.HTTP.Get(context.Background(), path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		var body struct {
+			Status string `json:"status"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != want || body.Status != "ok" {
+			t.Fatalf("GET %s = %d %q", path, resp.StatusCode, body.Status)
+		}
+	}
+}
+func uuidOf(t *testing.T, value string) *uuid.UUID {
+	t.Helper()
+	id, err := uuid.Parse(value)
+	if err != nil {
+		t.Fatalf("parse uuid %s: %v", value, err)
+	}
+	return &id
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Hook - подсистема приложения. Start возвращается, когда подсистема готова к работе, Stop останавливает ее
+// в пределах срока ctx. Любая из функций может быть nil
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// Lifecycle запускает подсистемы в порядке добавления, то есть зависимости добавляются раньше зависимых
+// подсистем, и останавливает запущенные подсистемы в обратном порядке
+type Lifecycle struct {
+	lg      *slog.Logger
+	mu      sync.Mutex
+	hooks   []Hook
+	started int
+}
+
+func NewLifecycle(lg *slog.Logger) *Lifecycle {
+	return &Lifecycle{lg: lg}
+}
+
+func (l *Lifecycle) Append(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Start запускает подсистемы. При ошибке запуска уже запущенные подсистемы останавливаются
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.started < len(l.hooks) {
+		hook := l.hooks[l.started]
+		if hook.Start != nil {
+			if err := hook.Start(ctx); err != nil {
+				err = fmt.Errorf("start %s: %w", hook.Name, err)
+				return errors.Join(err, l.stop(ctx))
+			}
+		}
+		l.lg.Debug("APP: " + hook.Name + " is started")
+		l.started++
+	}
+	return nil
+}
+
+// Stop останавливает запущенные подсистемы. Подсистема, не остановившаяся до истечения ctx, пропускается,
+// следующие подсистемы останавливаются с истекшим ctx и должны освободить ресурсы без ожидания
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stop(ctx)
+}
+func (l *Lifecycle) stop(ctx context.Context) error {
+	var errs []error
+	for ; l.started > 0; l.started-- {
+		hook := l.hooks[l.started-1]
+		if hook.Stop == nil {
+			continue
+		}
+		startedAt := time.Now()
+		if err := stopHook(ctx, hook); err != nil {
+			l.lg.Error("APP: "+hook.Name+" is not stopped", slog.Any("error", err))
+			errs = append(errs, fmt.Errorf("stop %s: %w", hook.Name, err))
+			continue
+		}
+		l.lg.Debug("APP: "+hook.Name+" is stopped", slog.Duration("duration", time.Since(startedAt)))
+	}
+	return errors.Join(errs...)
+}
+
+// stopHook не ждет Stop дольше ctx, даже если Stop не учитывает ctx
+func stopHook(ctx context.Context, hook Hook) error {
+	chErr := make(chan error, 1)
+	go func() {
+		chErr <- hook.Stop(ctx)
+	}()
+	select {
+	case err := <-chErr:
+		return err
+	case <-ctx.Done():
+		//Stop, который учитывает ctx, успевает вернуть результат
+		select {
+		case err := <-chErr:
+			return err
+		default:
+			return ctx.Err()
+		}
+	}
+}
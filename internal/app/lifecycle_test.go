@@ -0,0 +1,91 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/app"
+)
+
+func newLifecycle(calls *[]string, names ...string) *app.Lifecycle {
+	lifecycle := app.NewLifecycle(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, name := range names {
+		lifecycle.Append(app.Hook{
+			Name:  name,
+			Start: func(ctx context.Context) error { *calls = append(*calls, "start "+name); return nil },
+			Stop:  func(ctx context.Context) error { *calls = append(*calls, "stop "+name); return nil },
+		})
+	}
+	return lifecycle
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	var calls []string
+	lifecycle := newLifecycle(&calls, "store", "grpc", "http")
+	if err := lifecycle.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := lifecycle.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	//повторная остановка ничего не делает
+	if err := lifecycle.Stop(context.Background()); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+	want := []string{"start store", "start grpc", "start http", "stop http", "stop grpc", "stop store"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestLifecycleStartError(t *testing.T) {
+	var calls []string
+	lifecycle := newLifecycle(&calls, "store", "grpc")
+	errListen := errors.New("address already in use")
+	lifecycle.Append(app.Hook{
+		Name:  "http",
+		Start: func(ctx context.Context) error { return errListen },
+		Stop:  func(ctx context.Context) error { t.Fatal("stop of not started hook"); return nil },
+	})
+	if err := lifecycle.Start(context.Background()); !errors.Is(err, errListen) {
+		t.Fatalf("Start = %v, want %v", err, errListen)
+	}
+	want := []string{"start store", "start grpc", "stop grpc", "stop store"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestLifecycleStopTimeout(t *testing.T) {
+	lifecycle := app.NewLifecycle(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	chStoreStopped := make(chan struct{})
+	lifecycle.Append(app.Hook{
+		Name: "store",
+		Stop: func(ctx context.Context) error { close(chStoreStopped); return nil },
+	})
+	chRelease := make(chan struct{})
+	defer close(chRelease)
+	lifecycle.Append(app.Hook{
+		Name: "grpc",
+		Stop: func(ctx context.Context) error { <-chRelease; return nil },
+	})
+	if err := lifecycle.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	//зависшая подсистема не задерживает остановку остальных дольше срока ctx
+	if err := lifecycle.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-chStoreStopped:
+	case <-time.After(time.Second):
+		t.Fatal("store is not stopped after timeout")
+	}
+}
@@ -0,0 +1,207 @@
+// Package apptest запускает сервис авторизации в процессе теста для сценарных (end-to-end) тестов:
+// настоящие gRPC сервер и HTTP шлюз app.App работают на bufconn, данные хранятся в памяти
+package apptest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	auth "skillsRockGRPC/grpc/gen"
+	"skillsRockGRPC/internal/app"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/memstore"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/scheduler"
+	"skillsRockGRPC/pkg/jwt"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufSize = 1024 * 1024
+
+// generateKey создает ключ подписи один раз на процесс теста, генерация ключа RSA занимает заметное время
+var generateKey = sync.OnceValues(func() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+})
+
+// Harness - запущенный сервис. Auth вызывает gRPC сервер, HTTP - HTTP шлюз, Store - хранилище сервиса
+type Harness struct {
+	Auth      auth.AuthServiceClient
+	HTTP      *HTTPClient
+	Store     *Store
+	Config    *config.Config
+	PublicKey *rsa.PublicKey
+	dialer    func(ctx context.Context, _ string) (net.Conn, error)
+}
+
+// Option изменяет конфигурацию или хранилище сервиса до запуска
+type Option func(*options)
+type options struct {
+	store     repository.Repository
+	configure []func(cfg *config.Config)
+}
+
+// WithStore заменяет хранилище memstore
+func WithStore(store repository.Repository) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithConfig изменяет конфигурацию сервиса
+func WithConfig(fn func(cfg *config.Config)) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, fn)
+	}
+}
+
+// New запускает сервис со сгенерированным ключом подписи и останавливает его по завершении теста.
+// Задачи планировщика отключены, их можно запустить методом RunJob
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	o := &options{store: memstore.New()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	privateKey, err := generateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	cfg := newConfig(t, privateKey, o.configure)
+	store := NewStore(o.store)
+
+	grpcListener := bufconn.Listen(bufSize)
+	httpListener := bufconn.Listen(bufSize)
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return grpcListener.DialContext(ctx)
+	}
+	lg := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if testing.Verbose() {
+		lg = slog.New(slog.NewTextHandler(testWriter{t}, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	a := app.MustNew(lg, cfg,
+		app.WithStore(store),
+		app.WithGRPCListener(grpcListener, grpc.WithContextDialer(dialer)),
+		app.WithHTTPListener(httpListener),
+	)
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc client: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := a.Stop(ctx); err != nil {
+			t.Errorf("stop: %v", err)
+		}
+	})
+	return &Harness{
+		Auth: auth.NewAuthServiceClient(conn),
+		HTTP: &HTTPClient{
+			baseUrl: "http://bufnet",
+			client: &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return httpListener.DialContext(ctx)
+				},
+			}},
+		},
+		Store:     store,
+		Config:    cfg,
+		PublicKey: &privateKey.PublicKey,
+		dialer:    dialer,
+	}
+}
+
+// Dial создает отдельный клиент gRPC сервера с дополнительными опциями, например
+// grpc.WithPerRPCCredentials. Соединение закрывается по завершении теста
+func (h *Harness) Dial(t testing.TB, opts ...grpc.DialOption) auth.AuthServiceClient {
+	t.Helper()
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(h.dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	if err != nil {
+		t.Fatalf("grpc client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return auth.NewAuthServiceClient(conn)
+}
+
+// newConfig заполняет конфигурацию значениями по умолчанию. Адреса серверов не используются,
+// сервер метрик слушает свободный порт
+func newConfig(t testing.TB, privateKey *rsa.PrivateKey, configure []func(cfg *config.Config)) *config.Config {
+	t.Helper()
+	cfg := &config.Config{
+		ShutdownTimeout: 5 * time.Second,
+		Token: config.Token{
+			PrivateKey: config.Secret(pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+			})),
+		},
+		//подключение шлюза к gRPC серверу идет через bufconn, адрес не разрешается
+		Grpc:    config.Grpc{Addr: "passthrough:///bufnet", WriteTimeout: 5 * time.Second, Name: "authGrpc"},
+		Http:    config.Http{Addr: "bufnet", Name: "authHttp"},
+		Store:   config.Store{Driver: config.StoreDriverMemory},
+		Metrics: config.Metrics{Addr: "127.0.0.1:0"},
+		Tracing: config.Tracing{Exporter: "none"},
+		Outbox:  config.Outbox{Publishers: []string{"file"}, FilePath: t.TempDir() + "/outbox.jsonl"},
+		Scheduler: config.Scheduler{Jobs: map[string]config.Job{
+			scheduler.JobRemoveRefreshTokens: {Disabled: true},
+			scheduler.JobRemoveAuditEvents:   {Disabled: true},
+			scheduler.JobRelayOutbox:         {Disabled: true},
+			scheduler.JobDeliverWebhooks:     {Disabled: true},
+		}},
+	}
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	return cfg
+}
+
+// Claims разбирает и проверяет токен, выпущенный сервисом
+func (h *Harness) Claims(t testing.TB, token string) *jwt.TokenClaims {
+	t.Helper()
+	claims, err := jwt.ParseToken(token, h.PublicKey)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	return claims
+}
+
+// testWriter выводит журнал сервиса в журнал теста
+type testWriter struct {
+	t testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
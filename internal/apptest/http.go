@@ -0,0 +1,113 @@
+package apptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// HTTPClient вызывает методы AuthService через HTTP шлюз
+type HTTPClient struct {
+	baseUrl string
+	client  *http.Client
+}
+
+// HTTPError - ответ шлюза с ошибкой в формате {"error": {...}}
+type HTTPError struct {
+	StatusCode int         `json:"-"`
+	Header     http.Header `json:"-"`
+	Detail     struct {
+		Code            int               `json:"code"`
+		Status          string            `json:"status"`
+		Message         string            `json:"message"`
+		Reason          string            `json:"reason"`
+		Domain          string            `json:"domain"`
+		Metadata        map[string]string `json:"metadata"`
+		FieldViolations []struct {
+			Field       string `json:"field"`
+			Description string `json:"description"`
+		} `json:"fieldViolations"`
+		RetryDelay string `json:"retryDelay"`
+		RequestId  string `json:"requestId"`
+	} `json:"error"`
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s (%s)", e.StatusCode, e.Detail.Message, e.Detail.Reason)
+}
+
+// Call отправляет req методу AuthService method (например "Login") по адресу /api/v1/<method> и разбирает
+// ответ в resp. accessToken, если не пустой, передается в заголовке Authorization. Ответ с ошибкой
+// возвращается как *HTTPError
+func (c *HTTPClient) Call(ctx context.Context, method string, accessToken string, req proto.Message, resp proto.Message) error {
+	body, err := protojson.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseUrl+"/api/v1/"+strings.ToLower(method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		httpErr := &HTTPError{StatusCode: httpResp.StatusCode, Header: httpResp.Header}
+		if err := json.Unmarshal(data, httpErr); err != nil {
+			return fmt.Errorf("http status %d: %s", httpResp.StatusCode, data)
+		}
+		return httpErr
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, resp)
+}
+
+// Get выполняет GET запрос к служебным адресам шлюза, например /readyz
+func (c *HTTPClient) Get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseUrl+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// URL возвращает адрес path HTTP шлюза
+func (c *HTTPClient) URL(path string) string {
+	return c.baseUrl + path
+}
+
+// Transport возвращает транспорт, соединяющийся с HTTP шлюзом
+func (c *HTTPClient) Transport() http.RoundTripper {
+	return c.client.Transport
+}
+
+// Reason возвращает причину ошибки google.rpc.ErrorInfo из ошибки gRPC клиента или HTTPClient
+func Reason(err error) string {
+	if httpErr, ok := err.(*HTTPError); ok {
+		return httpErr.Detail.Reason
+	}
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package apptest
+
+import (
+	"context"
+	"sync"
+
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Store - хранилище сервиса с назначением роли admin. Репозиторий не изменяет роли пользователей,
+// поэтому роль подменяется при чтении пользователя
+type Store struct {
+	repository.Repository
+	mu     sync.RWMutex
+	admins map[uuid.UUID]bool
+}
+
+func NewStore(repo repository.Repository) *Store {
+	return &Store{
+		Repository: repo,
+		admins:     map[uuid.UUID]bool{},
+	}
+}
+
+// MakeAdmin назначает пользователю роль admin
+func (s *Store) MakeAdmin(userId *uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.admins[*userId] = true
+}
+func (s *Store) GetUser(ctx context.Context, userId *uuid.UUID) (*entity.User, error) {
+	user, err := s.Repository.GetUser(ctx, userId)
+	return s.withRole(user), err
+}
+func (s *Store) GetUserByLogin(ctx context.Context, login string) (*entity.User, error) {
+	user, err := s.Repository.GetUserByLogin(ctx, login)
+	return s.withRole(user), err
+}
+func (s *Store) withRole(user *entity.User) *entity.User {
+	if user == nil || user.UserId == nil {
+		return user
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.admins[*user.UserId] {
+		user.Role = entity.RoleAdmin
+	}
+	return user
+}
@@ -1,50 +1,219 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/robfig/cron/v3"
 )
 
+// Config. LogLevel переопределяет уровень логирования окружения Env: debug, info, warn, error.
+// ReloadInterval - период проверки изменения файла конфигурации (Watcher). ShutdownTimeout ограничивает время
+// остановки приложения, по его истечении выполняющиеся запросы прерываются.
+// Поля типа Secret принимают значение или ссылку на секрет (Secrets) и не выводятся в журнал
 type Config struct {
-	Env       string    `yaml:"env" env:"AUTH_ENV" env-default:"local"`
-	Token     Token     `yaml:"token" env:"AUTH_TOKEN" env-required:"true"`
-	Grpc      Grpc      `yaml:"grpc"`
-	Http      Http      `yaml:"http"`
-	Store     Store     `yaml:"store"`
-	Scheduler Scheduler `yaml:"scheduler"`
+	Env             string        `yaml:"env" env:"AUTH_ENV" env-default:"local"`
+	LogLevel        string        `yaml:"logLevel" env:"AUTH_LOG_LEVEL"`
+	ReloadInterval  time.Duration `yaml:"reloadInterval" env:"AUTH_CONFIG_RELOAD_INTERVAL" env-default:"10s"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"AUTH_SHUTDOWN_TIMEOUT" env-default:"30s"`
+	Token           Token         `yaml:"token" env:"AUTH_TOKEN" env-required:"true"`
+	Password        Password      `yaml:"password"`
+	Grpc            Grpc          `yaml:"grpc"`
+	Http            Http          `yaml:"http"`
+	Store           Store         `yaml:"store"`
+	Scheduler       Scheduler     `yaml:"scheduler"`
+	Purge           Purge         `yaml:"purge"`
+	Outbox          Outbox        `yaml:"outbox"`
+	Webhook         Webhook       `yaml:"webhook"`
+	Health          Health        `yaml:"health"`
+	Metrics         Metrics       `yaml:"metrics"`
+	Tracing         Tracing       `yaml:"tracing"`
+	Secrets         Secrets       `yaml:"secrets"`
+	//файл, из которого прочитана конфигурация, пустой при чтении из переменных окружения
+	path string
 }
+
+// Token. Ключ подписи задается файлом PrivateKeyPath или секретом PrivateKey в формате PEM, PrivateKey имеет приоритет
 type Token struct {
-	PrivateKeyPath  string        `yaml:"privateKeyPath" env:"AUTH_TOKEN_PRIVATE_KEY_PATH" env-required:"true"`
+	PrivateKeyPath  string        `yaml:"privateKeyPath" env:"AUTH_TOKEN_PRIVATE_KEY_PATH"`
+	PrivateKey      Secret        `yaml:"privateKey" env:"AUTH_TOKEN_PRIVATE_KEY"`
 	AccessLifetime  time.Duration `yaml:"accessLifetime" env:"AUTH_TOKEN_ACCEESS_LIFETIME" env-default:"3600s"`
 	RefreshLifetime time.Duration `yaml:"refreshLifetime" env:"AUTH_TOKEN_REFRESH_LIFETIME" env-default:"2592000s"`
+	Exchange        Exchange      `yaml:"exchange"`
+}
+type Exchange struct {
+	Lifetime time.Duration `yaml:"lifetime" env:"AUTH_TOKEN_EXCHANGE_LIFETIME" env-default:"300s"`
+	Actors   []Actor       `yaml:"actors"`
+}
+
+// Actor - сервис, которому разрешен обмен токенов пользователя на токены для перечисленных audience
+type Actor struct {
+	Name      string   `yaml:"name"`
+	Secret    Secret   `yaml:"secret"`
+	Audiences []string `yaml:"audiences"`
+	Scopes    []string `yaml:"scopes"`
+}
+
+// Границы длины нового пароля в правилах запросов auth.proto. Политика паролей только сужает их
+const (
+	PasswordMinLength = 8
+	PasswordMaxLength = 128
+)
+
+// Password - политика паролей. BreachedPath - каталог базы утекших паролей в формате k-anonymity
+// (файлы <первые 5 символов SHA-1>.txt), пустое значение отключает проверку
+type Password struct {
+	MinLength     int    `yaml:"minLength" env:"AUTH_PASSWORD_MIN_LENGTH" env-default:"8"`
+	MaxLength     int    `yaml:"maxLength" env:"AUTH_PASSWORD_MAX_LENGTH" env-default:"128"`
+	RequireUpper  bool   `yaml:"requireUpper" env:"AUTH_PASSWORD_REQUIRE_UPPER" env-default:"false"`
+	RequireLower  bool   `yaml:"requireLower" env:"AUTH_PASSWORD_REQUIRE_LOWER" env-default:"false"`
+	RequireDigit  bool   `yaml:"requireDigit" env:"AUTH_PASSWORD_REQUIRE_DIGIT" env-default:"false"`
+	RequireSymbol bool   `yaml:"requireSymbol" env:"AUTH_PASSWORD_REQUIRE_SYMBOL" env-default:"false"`
+	ForbidLogin   bool   `yaml:"forbidLogin" env:"AUTH_PASSWORD_FORBID_LOGIN" env-default:"true"`
+	HistorySize   int    `yaml:"historySize" env:"AUTH_PASSWORD_HISTORY_SIZE" env-default:"5"`
+	BreachedPath  string `yaml:"breachedPath" env:"AUTH_PASSWORD_BREACHED_PATH"`
 }
 
 type Grpc struct {
 	Addr         string        `yaml:"addr" env:"AUTH_GRPC_ADDR" env-required:"true"`
 	WriteTimeout time.Duration `yaml:"writeTimeout" env:"AUTH_GRPC_WRITE_TIMEOUT" env-required:"true"`
 	Name         string        `yaml:"name" env:"AUTH_GRPC_NAME" env-required:"true"`
+	TLS          TLS           `yaml:"tls" env-prefix:"AUTH_GRPC_TLS_"`
 }
 type Http struct {
-	Addr string `yaml:"addr" env:"AUTH_HTTP_ADDR" env-required:"true"`
-	Name string `yaml:"name" env:"AUTH_HTTP_NAME" env-required:"true"`
+	Addr     string `yaml:"addr" env:"AUTH_HTTP_ADDR" env-required:"true"`
+	Name     string `yaml:"name" env:"AUTH_HTTP_NAME" env-required:"true"`
+	TLS      TLS    `yaml:"tls" env-prefix:"AUTH_HTTP_TLS_"`
+	Upstream TLS    `yaml:"upstream" env-prefix:"AUTH_HTTP_UPSTREAM_"`
+}
+
+// TLS. Пустой CertPath отключает TLS сервера. ClientCAPath включает проверку сертификатов клиентов (mTLS),
+// на HTTP сервере /healthz и /readyz доступны без сертификата. Для подключения шлюза к gRPC серверу в нем указывается CA сервера. Файлы перечитываются при изменении
+type TLS struct {
+	CertPath       string        `yaml:"certPath" env:"CERT_PATH"`
+	KeyPath        string        `yaml:"keyPath" env:"KEY_PATH"`
+	ClientCAPath   string        `yaml:"clientCAPath" env:"CLIENT_CA_PATH"`
+	ServerName     string        `yaml:"serverName" env:"SERVER_NAME"`
+	ReloadInterval time.Duration `yaml:"reloadInterval" env:"RELOAD_INTERVAL" env-default:"10s"`
 }
+
+const (
+	StoreDriverPostgres = "postgres"
+	StoreDriverMemory   = "memory"
+	StoreDriverSQLite   = "sqlite"
+)
+
+// Store. Driver: postgres, sqlite или memory. Хранилище memory не сохраняет данные между запусками и
+// предназначено для тестов и локальной разработки, параметры подключения для него не используются.
+// Path - файл базы данных SQLite, схема создается миграциями из migration/sqlite.
+// AutoMigrate применяет встроенные миграции при запуске сервиса
 type Store struct {
-	Host                string        `yaml:"host" env:"AUTH_STORE_HOST" env-required:"true"`
-	Port                int           `yaml:"port" env:"AUTH_STORE_PORT" env-required:"true"`
-	Name                string        `yaml:"name" env:"AUTH_STORE_NAME" env-required:"true"`
-	User                string        `yaml:"user" env:"AUTH_STORE_USER" env-required:"true"`
-	Password            string        `yaml:"password" env:"AUTH_STORE_PASSWORD" env-required:"true"`
+	Driver              string        `yaml:"driver" env:"AUTH_STORE_DRIVER" env-default:"postgres"`
+	AutoMigrate         bool          `yaml:"autoMigrate" env:"AUTH_STORE_AUTO_MIGRATE" env-default:"false"`
+	Path                string        `yaml:"path" env:"AUTH_STORE_PATH" env-default:"./auth.db"`
+	Host                string        `yaml:"host" env:"AUTH_STORE_HOST" env-default:"localhost"`
+	Port                int           `yaml:"port" env:"AUTH_STORE_PORT" env-default:"5432"`
+	Name                string        `yaml:"name" env:"AUTH_STORE_NAME"`
+	User                string        `yaml:"user" env:"AUTH_STORE_USER"`
+	Password            Secret        `yaml:"password" env:"AUTH_STORE_PASSWORD"`
 	SSLMode             string        `yaml:"sslMode" env:"AUTH_STORE_SSL_MODE" env-default:"disable"`
 	PoolMaxConns        int           `yaml:"poolMaxConns" env:"AUTH_STORE_POOL_MAX_CONNS" env-default:"5"`
 	PoolMaxConnLifetime time.Duration `yaml:"poolMaxConnLifeTime" env:"AUTH_STORE_POOL_MAX_CONN_LIFETIME" env-default:"180s"`
 	PoolMaxConnIdleTime time.Duration `yaml:"poolMaxConnIidleTime" env:"AUTH_STORE_POOL_MAX_CONN_IDLE_TIME" env-default:"100s"`
 }
+
+// Scheduler. Timeout* - интервалы задач по умолчанию, Jobs переопределяет расписание и параметры запуска задач
 type Scheduler struct {
-	TimeoutRemoveRefreshTokens time.Duration `yaml:"timeoutRemoveRefreshTokens" env:"AUTH_SCHEDULER_TIMEOUT_REMOVE_REFRESH_TOKENS" env-default:"86400s"`
+	TimeoutRemoveRefreshTokens time.Duration  `yaml:"timeoutRemoveRefreshTokens" env:"AUTH_SCHEDULER_TIMEOUT_REMOVE_REFRESH_TOKENS" env-default:"86400s"`
+	TimeoutRemoveAuditEvents   time.Duration  `yaml:"timeoutRemoveAuditEvents" env:"AUTH_SCHEDULER_TIMEOUT_REMOVE_AUDIT_EVENTS" env-default:"86400s"`
+	AuditEventsRetention       time.Duration  `yaml:"auditEventsRetention" env:"AUTH_SCHEDULER_AUDIT_EVENTS_RETENTION" env-default:"7776000s"`
+	TimeoutRelayOutbox         time.Duration  `yaml:"timeoutRelayOutbox" env:"AUTH_SCHEDULER_TIMEOUT_RELAY_OUTBOX" env-default:"5s"`
+	TimeoutDeliverWebhooks     time.Duration  `yaml:"timeoutDeliverWebhooks" env:"AUTH_SCHEDULER_TIMEOUT_DELIVER_WEBHOOKS" env-default:"5s"`
+	Jobs                       map[string]Job `yaml:"jobs"`
+}
+
+// Job - настройки задачи планировщика из Scheduler.Jobs, ключ - имя задачи. Schedule - cron-выражение
+// ("0 3 * * *") или интервал ("@every 5s"), пустое значение - интервал Timeout* задачи. Timeout ограничивает
+// время выполнения, 0 - без ограничения. Jitter - случайная задержка запуска, разносит обращения экземпляров
+// сервиса к хранилищу. RunOnStart запускает задачу при старте сервиса, Disabled отключает запуск по расписанию
+type Job struct {
+	Schedule   string        `yaml:"schedule"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Jitter     time.Duration `yaml:"jitter"`
+	RunOnStart bool          `yaml:"runOnStart"`
+	Disabled   bool          `yaml:"disabled"`
+}
+
+// Health. Timeout ограничивает время выполнения всех проверок готовности
+type Health struct {
+	Timeout time.Duration `yaml:"timeout" env:"AUTH_HEALTH_TIMEOUT" env-default:"3s"`
+}
+
+// Metrics. Метрики Prometheus публикуются на отдельном адресе по пути /metrics
+type Metrics struct {
+	Addr string `yaml:"addr" env:"AUTH_METRICS_ADDR" env-default:":9090"`
+}
+
+// Tracing. Exporter: none, stdout или otlp. Endpoint - адрес OTLP gRPC коллектора
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"AUTH_TRACING_EXPORTER" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env:"AUTH_TRACING_ENDPOINT" env-default:"localhost:4317"`
+	Insecure    bool    `yaml:"insecure" env:"AUTH_TRACING_INSECURE" env-default:"true"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"AUTH_TRACING_SAMPLE_RATIO" env-default:"1"`
+	ServiceName string  `yaml:"serviceName" env:"AUTH_TRACING_SERVICE_NAME" env-default:"auth"`
+}
+
+// Secrets - источники секретов для полей типа Secret. Значение поля "file:///run/secrets/db_password" читается
+// из файла, "env://DB_PASSWORD" - из переменной окружения, "vault://secret/auth#dbPassword" - из хранилища KV
+// версии 2 Vault по адресу VaultAddr, другие схемы добавляются RegisterSecretProvider. Значение без схемы
+// используется как есть. VaultToken сам может быть ссылкой file или env
+type Secrets struct {
+	VaultAddr    string        `yaml:"vaultAddr" env:"AUTH_SECRETS_VAULT_ADDR"`
+	VaultToken   Secret        `yaml:"vaultToken" env:"AUTH_SECRETS_VAULT_TOKEN"`
+	VaultTimeout time.Duration `yaml:"vaultTimeout" env:"AUTH_SECRETS_VAULT_TIMEOUT" env-default:"5s"`
+}
+
+type Webhook struct {
+	BatchSize   int           `yaml:"batchSize" env:"AUTH_WEBHOOK_BATCH_SIZE" env-default:"100"`
+	MaxAttempts int           `yaml:"maxAttempts" env:"AUTH_WEBHOOK_MAX_ATTEMPTS" env-default:"10"`
+	BackoffBase time.Duration `yaml:"backoffBase" env:"AUTH_WEBHOOK_BACKOFF_BASE" env-default:"5s"`
+	BackoffMax  time.Duration `yaml:"backoffMax" env:"AUTH_WEBHOOK_BACKOFF_MAX" env-default:"3600s"`
+	LockTimeout time.Duration `yaml:"lockTimeout" env:"AUTH_WEBHOOK_LOCK_TIMEOUT" env-default:"60s"`
+	Timeout     time.Duration `yaml:"timeout" env:"AUTH_WEBHOOK_TIMEOUT" env-default:"10s"`
+}
+
+// Purge - удаление устаревших данных пакетами по BatchSize строк с паузой BatchDelay между пакетами, чтобы
+// очистка не вытесняла запросы пользователей. RevokedTokensRetention - срок хранения отозванных refresh токенов
+// для обнаружения их повторного использования
+type Purge struct {
+	BatchSize              int           `yaml:"batchSize" env:"AUTH_PURGE_BATCH_SIZE" env-default:"1000"`
+	BatchDelay             time.Duration `yaml:"batchDelay" env:"AUTH_PURGE_BATCH_DELAY" env-default:"100ms"`
+	RevokedTokensRetention time.Duration `yaml:"revokedTokensRetention" env:"AUTH_PURGE_REVOKED_TOKENS_RETENTION" env-default:"2592000s"`
+}
+
+// Outbox. Publishers - список издателей событий: file, webhook, nats. Для nats темы NatsSubject.>
+// должен принимать поток JetStream. WebhookSecret - ключ подписи запросов издателя webhook, пустое значение
+// отключает подпись
+type Outbox struct {
+	Publishers     []string      `yaml:"publishers" env:"AUTH_OUTBOX_PUBLISHERS" env-separator:"," env-default:"file"`
+	BatchSize      int           `yaml:"batchSize" env:"AUTH_OUTBOX_BATCH_SIZE" env-default:"100"`
+	MaxAttempts    int           `yaml:"maxAttempts" env:"AUTH_OUTBOX_MAX_ATTEMPTS" env-default:"10"`
+	BackoffBase    time.Duration `yaml:"backoffBase" env:"AUTH_OUTBOX_BACKOFF_BASE" env-default:"1s"`
+	BackoffMax     time.Duration `yaml:"backoffMax" env:"AUTH_OUTBOX_BACKOFF_MAX" env-default:"600s"`
+	LockTimeout    time.Duration `yaml:"lockTimeout" env:"AUTH_OUTBOX_LOCK_TIMEOUT" env-default:"60s"`
+	PublishTimeout time.Duration `yaml:"publishTimeout" env:"AUTH_OUTBOX_PUBLISH_TIMEOUT" env-default:"10s"`
+	FilePath       string        `yaml:"filePath" env:"AUTH_OUTBOX_FILE_PATH" env-default:"./outbox.jsonl"`
+	WebhookUrl     string        `yaml:"webhookUrl" env:"AUTH_OUTBOX_WEBHOOK_URL"`
+	WebhookSecret  Secret        `yaml:"webhookSecret" env:"AUTH_OUTBOX_WEBHOOK_SECRET"`
+	NatsUrl        string        `yaml:"natsUrl" env:"AUTH_OUTBOX_NATS_URL" env-default:"nats://localhost:4222"`
+	NatsSubject    string        `yaml:"natsSubject" env:"AUTH_OUTBOX_NATS_SUBJECT" env-default:"auth.events"`
 }
 
 func MustLoad() *Config {
@@ -57,22 +226,14 @@ func MustLoad() *Config {
 	//configPath = "./../../config/local.yml"//for debug
 	if configPath != "" {
 		log.Printf("CONFIG: the value of the 'config' flag: %s\n", configPath)
-		if err := cleanenv.ReadConfig(configPath, cfg); err != nil {
-			log.Fatalf("CONFIG: %v\n", err)
-		}
-		log.Printf("CONFIG: configuration file %+v\n", cfg)
-		return cfg
+		return mustRead(configPath, cfg)
 	}
 	log.Printf("CONFIG: the 'config' flag is not set\n")
 
 	configPath = os.Getenv("AUTH_CONFIG_PATH")
 	if configPath != "" {
 		log.Printf("CONFIG: the value of the environment variable: %s\n", configPath)
-		if err := cleanenv.ReadConfig(configPath, cfg); err != nil {
-			log.Fatalf("CONFIG: %v\n", err)
-		}
-		log.Printf("CONFIG: configuration file %+v\n", cfg)
-		return cfg
+		return mustRead(configPath, cfg)
 	}
 	log.Printf("CONFIG: environment variable 'AUTH_CONFIG_PATH' is not set\n")
 
@@ -80,6 +241,71 @@ func MustLoad() *Config {
 	if err := cleanenv.ReadEnv(cfg); err != nil {
 		log.Fatalf("CONFIG: %v\n", err)
 	}
-	log.Printf("CONFIG: configuration file %+v\n", cfg)
+	return mustPrepare(cfg)
+}
+func mustRead(configPath string, cfg *Config) *Config {
+	if err := cleanenv.ReadConfig(configPath, cfg); err != nil {
+		log.Fatalf("CONFIG: %v\n", err)
+	}
+	cfg.path = configPath
+	return mustPrepare(cfg)
+}
+
+// mustPrepare проверяет конфигурацию и заменяет ссылки на секреты их значениями
+func mustPrepare(cfg *Config) *Config {
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("CONFIG: %v\n", err)
+	}
+	if err := ResolveSecrets(context.Background(), cfg, &cfg.Secrets); err != nil {
+		log.Fatalf("CONFIG: %v\n", err)
+	}
+	log.Printf("CONFIG: configuration %v\n", cfg)
 	return cfg
 }
+
+// Validate проверяет значения, которые cleanenv не проверяет при чтении
+func (c *Config) Validate() error {
+	if c.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			return fmt.Errorf("logLevel: unknown level '%s'", c.LogLevel)
+		}
+	}
+	if c.Token.PrivateKeyPath == "" && c.Token.PrivateKey == "" {
+		return errors.New("token: privateKeyPath or privateKey is required")
+	}
+	if c.Token.AccessLifetime <= 0 || c.Token.RefreshLifetime <= 0 || c.Token.Exchange.Lifetime <= 0 {
+		return errors.New("token: lifetime must be positive")
+	}
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"timeoutRemoveRefreshTokens", c.Scheduler.TimeoutRemoveRefreshTokens},
+		{"timeoutRemoveAuditEvents", c.Scheduler.TimeoutRemoveAuditEvents},
+		{"timeoutRelayOutbox", c.Scheduler.TimeoutRelayOutbox},
+		{"timeoutDeliverWebhooks", c.Scheduler.TimeoutDeliverWebhooks},
+	} {
+		if interval.value <= 0 {
+			return fmt.Errorf("scheduler: %s must be positive, got %s", interval.name, interval.value)
+		}
+	}
+	for name, job := range c.Scheduler.Jobs {
+		if job.Schedule == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(job.Schedule); err != nil {
+			return fmt.Errorf("scheduler: job '%s' schedule: %w", name, err)
+		}
+	}
+	if c.Password.MinLength < PasswordMinLength || c.Password.MaxLength > PasswordMaxLength {
+		return fmt.Errorf("password: length limits must be within %d..%d", PasswordMinLength, PasswordMaxLength)
+	}
+	if c.Password.MaxLength > 0 && c.Password.MaxLength < c.Password.MinLength {
+		return errors.New("password: maxLength must not be less than minLength")
+	}
+	if c.Purge.BatchSize <= 0 {
+		return fmt.Errorf("purge: batch size must be positive, got %d", c.Purge.BatchSize)
+	}
+	return nil
+}
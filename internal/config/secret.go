@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"skillsRockGRPC/pkg/secret"
+)
+
+// Redacted заменяет значения секретов при выводе конфигурации
+const Redacted = "[REDACTED]"
+
+var (
+	secretProvidersMu sync.Mutex
+	secretProviders   = map[string]secret.Provider{}
+)
+
+// RegisterSecretProvider добавляет схему ссылок на секреты. Вызывается до загрузки конфигурации
+func RegisterSecretProvider(scheme string, provider secret.Provider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// Resolver возвращает Resolver со встроенными, зарегистрированными провайдерами и Vault, если задан VaultAddr
+func (s *Secrets) Resolver(ctx context.Context) (*secret.Resolver, error) {
+	resolver := secret.NewResolver()
+	if s.VaultAddr != "" {
+		token, err := resolver.Resolve(ctx, string(s.VaultToken))
+		if err != nil {
+			return nil, fmt.Errorf("secrets.vaultToken: %w", err)
+		}
+		resolver.Register("vault", secret.NewVaultProvider(s.VaultAddr, token, s.VaultTimeout))
+	}
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	for scheme, provider := range secretProviders {
+		resolver.Register(scheme, provider)
+	}
+	return resolver, nil
+}
+
+// Secret - значение или ссылка на секрет (file://, env://, vault://). String, LogValue и MarshalText
+// выводят Redacted вместо непустого значения, поэтому конфигурация печатается и записывается в журнал без секретов
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ResolveSecrets заменяет ссылки в полях типа Secret структуры cfg значениями секретов
+func ResolveSecrets(ctx context.Context, cfg any, secrets *Secrets) error {
+	resolver, err := secrets.Resolver(ctx)
+	if err != nil {
+		return err
+	}
+	return resolveSecrets(ctx, resolver, "", reflect.ValueOf(cfg))
+}
+func resolveSecrets(ctx context.Context, resolver *secret.Resolver, name string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return resolveSecrets(ctx, resolver, name, v.Elem())
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			if err := resolveSecrets(ctx, resolver, name+"["+strconv.Itoa(i)+"]", v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldName := fieldName(name, field)
+			if field.Type != secretType {
+				if err := resolveSecrets(ctx, resolver, fieldName, v.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := resolver.Resolve(ctx, v.Field(i).String())
+			if err != nil {
+				return fmt.Errorf("%s: %w", fieldName, err)
+			}
+			v.Field(i).SetString(value)
+		}
+	}
+	return nil
+}
+
+var secretType = reflect.TypeFor[Secret]()
+
+// fieldName возвращает имя поля в нотации yaml: "store.password"
+func fieldName(prefix string, field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	if prefix != "" {
+		name = prefix + "." + name
+	}
+	return name
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+var ErrNoConfigFile = errors.New("configuration is loaded from environment variables, there is no file to reload")
+
+// Watcher перечитывает файл конфигурации по сигналу SIGHUP и при изменении файла. Новая конфигурация
+// проверяется целиком и применяется только без ошибок: перезагружаемые разделы заменяются атомарно и
+// передаются подписчикам, изменения остальных параметров требуют перезапуска и сообщаются в журнал.
+// Перезагружаются LogLevel, время жизни токенов и участники обмена (Token кроме ключа подписи),
+// Scheduler и Purge. Ссылки на секреты разрешаются заново, поэтому смена секретов участников обмена
+// применяется без перезапуска
+type Watcher struct {
+	lg  *slog.Logger
+	cfg atomic.Pointer[Config]
+
+	mu          sync.Mutex
+	modTime     time.Time
+	subscribers []func(cfg *Config)
+
+	chStop chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewWatcher(lg *slog.Logger, cfg *Config) *Watcher {
+	w := &Watcher{
+		lg:     lg,
+		chStop: make(chan struct{}),
+	}
+	w.cfg.Store(cfg)
+	if info, err := os.Stat(cfg.path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	return w
+}
+
+// Config возвращает текущую конфигурацию
+func (w *Watcher) Config() *Config {
+	return w.cfg.Load()
+}
+
+// Subscribe добавляет получателя новой конфигурации. fn вызывается после каждой успешной перезагрузки
+func (w *Watcher) Subscribe(fn func(cfg *Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Watch ожидает SIGHUP и проверяет время изменения файла с периодом ReloadInterval до вызова Stop
+func (w *Watcher) Watch() {
+	chSignal := make(chan os.Signal, 1)
+	signal.Notify(chSignal, syscall.SIGHUP)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer signal.Stop(chSignal)
+		var chTick <-chan time.Time
+		if cfg := w.cfg.Load(); cfg.path != "" && cfg.ReloadInterval > 0 {
+			ticker := time.NewTicker(cfg.ReloadInterval)
+			defer ticker.Stop()
+			chTick = ticker.C
+		}
+		for {
+			select {
+			case <-w.chStop:
+				return
+			case <-chSignal:
+				w.reload("signal")
+			case <-chTick:
+				if w.changed() {
+					w.reload("file change")
+				}
+			}
+		}
+	}()
+}
+func (w *Watcher) Stop() {
+	close(w.chStop)
+	w.wg.Wait()
+}
+func (w *Watcher) reload(reason string) {
+	if err := w.Reload(); err != nil {
+		w.lg.Error("CONFIG: reload error", slog.String("reason", reason), slog.Any("error", err))
+		return
+	}
+	w.lg.Info("CONFIG: configuration reloaded", slog.String("reason", reason))
+}
+
+// Reload перечитывает файл конфигурации. При ошибке чтения или проверки продолжает действовать текущая конфигурация
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	current := w.cfg.Load()
+	if current.path == "" {
+		return ErrNoConfigFile
+	}
+	//время изменения запоминается и для ошибочного файла, чтобы не повторять ошибку до следующего изменения
+	if info, err := os.Stat(current.path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	loaded := new(Config)
+	if err := cleanenv.ReadConfig(current.path, loaded); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if err := loaded.Validate(); err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+	if err := ResolveSecrets(context.Background(), loaded, &loaded.Secrets); err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+	next := *current
+	next.LogLevel = loaded.LogLevel
+	next.Token.AccessLifetime = loaded.Token.AccessLifetime
+	next.Token.RefreshLifetime = loaded.Token.RefreshLifetime
+	next.Token.Exchange = loaded.Token.Exchange
+	next.Scheduler = loaded.Scheduler
+	next.Purge = loaded.Purge
+	if fields := diff("", reflect.ValueOf(next), reflect.ValueOf(*loaded)); len(fields) > 0 {
+		w.lg.Warn("CONFIG: changed fields require restart and are not applied", slog.Any("fields", fields))
+	}
+	w.cfg.Store(&next)
+	for _, fn := range w.subscribers {
+		fn(&next)
+	}
+	return nil
+}
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.cfg.Load().path)
+	if err != nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !info.ModTime().Equal(w.modTime)
+}
+
+// diff возвращает имена различающихся полей в нотации yaml: "store", "token.privateKeyPath"
+func diff(prefix string, a reflect.Value, b reflect.Value) []string {
+	var fields []string
+	for i := range a.NumField() {
+		field := a.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := fieldName(prefix, field)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			fields = append(fields, diff(name, a.Field(i), b.Field(i))...)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConfig - файл конфигурации теста, значения заменяет writeConfig
+const testConfig = `
+logLevel: info
+reloadInterval: 10ms
+token:
+  privateKey: test-key
+  accessLifetime: 3600s
+  refreshLifetime: 86400s
+  exchange:
+    actors:
+      - name: gateway
+        secret: gateway-secret
+grpc:
+  addr: :50051
+  writeTimeout: 15s
+  name: authGrpc
+http:
+  addr: :8081
+  name: authHttp
+store:
+  driver: memory
+scheduler:
+  jobs:
+    relayOutbox:
+      schedule: "@every 5s"
+purge:
+  batchSize: 1000
+`
+
+// writeConfig записывает файл конфигурации с заменами replacements (старое, новое значение) и сдвигает
+// время изменения, чтобы Watch заметил новый файл
+func writeConfig(t *testing.T, path string, modTime time.Time, replacements ...string) {
+	t.Helper()
+	data := strings.NewReplacer(replacements...).Replace(testConfig)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+// newTestWatcher читает файл конфигурации и возвращает Watcher и полученные подписчиком конфигурации
+func newTestWatcher(t *testing.T) (*Watcher, string, func() []*Config) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, time.Now().Add(-time.Minute))
+	w := NewWatcher(slog.New(slog.DiscardHandler), mustRead(path, new(Config)))
+	var mu sync.Mutex
+	var received []*Config
+	w.Subscribe(func(cfg *Config) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, cfg)
+	})
+	return w, path, func() []*Config {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	w, path, received := newTestWatcher(t)
+	writeConfig(t, path, time.Now(),
+		"logLevel: info", "logLevel: debug",
+		"accessLifetime: 3600s", "accessLifetime: 600s",
+		"refreshLifetime: 86400s", "refreshLifetime: 3600s",
+		"secret: gateway-secret", "secret: rotated-secret",
+		`schedule: "@every 5s"`, "schedule: \"@every 1m\"\n      disabled: true",
+		"batchSize: 1000", "batchSize: 50",
+		//адрес и хранилище применяются только после перезапуска
+		"addr: :50051", "addr: :50052",
+		"driver: memory", "driver: sqlite",
+	)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	cfg := w.Config()
+	if cfg.LogLevel != "debug" || cfg.Token.AccessLifetime != 10*time.Minute || cfg.Token.RefreshLifetime != time.Hour {
+		t.Fatalf("reloaded config: logLevel %q, token %+v", cfg.LogLevel, cfg.Token)
+	}
+	if actors := cfg.Token.Exchange.Actors; len(actors) != 1 || actors[0].Secret != "rotated-secret" {
+		t.Fatalf("reloaded exchange actors = %+v", actors)
+	}
+	if job := cfg.Scheduler.Jobs["relayOutbox"]; job.Schedule != "@every 1m" || !job.Disabled || cfg.Purge.BatchSize != 50 {
+		t.Fatalf("reloaded scheduler %+v, purge %+v", cfg.Scheduler, cfg.Purge)
+	}
+	if cfg.Grpc.Addr != ":50051" || cfg.Store.Driver != StoreDriverMemory || cfg.Token.PrivateKey != "test-key" {
+		t.Fatalf("restart-only fields are applied: grpc %+v, store driver %q", cfg.Grpc, cfg.Store.Driver)
+	}
+	if got := received(); len(got) != 1 || got[0] != cfg {
+		t.Fatalf("subscriber received %d configs", len(got))
+	}
+}
+
+func TestWatcherRejectsInvalidFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		replacements []string
+	}{
+		{name: "yaml", replacements: []string{"logLevel: info", "logLevel: [debug"}},
+		{name: "log level", replacements: []string{"logLevel: info", "logLevel: verbose"}},
+		{name: "schedule", replacements: []string{`schedule: "@every 5s"`, `schedule: "every minute"`}},
+		{name: "scheduler interval", replacements: []string{"scheduler:\n", "scheduler:\n  timeoutRelayOutbox: -1s\n"}},
+		{name: "lifetime", replacements: []string{"refreshLifetime: 86400s", "refreshLifetime: -1s"}},
+		{name: "purge", replacements: []string{"batchSize: 1000", "batchSize: -1"}},
+		{name: "secret", replacements: []string{"secret: gateway-secret", "secret: env://CONFIG_TEST_MISSING_SECRET"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, path, received := newTestWatcher(t)
+			current := w.Config()
+			//ошибочный файл меняет и перезагружаемые параметры: ни один из них не применяется
+			writeConfig(t, path, time.Now(), append([]string{"accessLifetime: 3600s", "accessLifetime: 60s"}, tt.replacements...)...)
+			if err := w.Reload(); err == nil {
+				t.Fatal("Reload of invalid file succeeded")
+			}
+			if w.Config() != current || current.Token.AccessLifetime != time.Hour || current.LogLevel != "info" {
+				t.Fatalf("invalid file is applied: %+v", w.Config().Token)
+			}
+			if len(received()) != 0 {
+				t.Fatal("subscriber received config from invalid file")
+			}
+		})
+	}
+}
+
+func TestWatcherWatch(t *testing.T) {
+	w, path, received := newTestWatcher(t)
+	w.Watch()
+	defer w.Stop()
+	wait := func(count int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(received()) < count {
+			if time.Now().After(deadline) {
+				t.Fatalf("file change is not reloaded, %d reloads", len(received()))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	//изменение файла применяется без сигнала
+	writeConfig(t, path, time.Now(), "logLevel: info", "logLevel: warn")
+	wait(1)
+	if w.Config().LogLevel != "warn" {
+		t.Fatalf("logLevel = %q", w.Config().LogLevel)
+	}
+	//ошибочный файл не применяется и не перечитывается до следующего изменения
+	writeConfig(t, path, time.Now().Add(time.Second), "logLevel: info", "logLevel: verbose")
+	time.Sleep(100 * time.Millisecond)
+	if len(received()) != 1 || w.Config().LogLevel != "warn" {
+		t.Fatalf("invalid file is applied: logLevel %q", w.Config().LogLevel)
+	}
+	writeConfig(t, path, time.Now().Add(2*time.Second), "logLevel: info", "logLevel: error")
+	wait(2)
+	if w.Config().LogLevel != "error" {
+		t.Fatalf("logLevel = %q", w.Config().LogLevel)
+	}
+}
+
+func TestWatcherWithoutFile(t *testing.T) {
+	w := NewWatcher(slog.New(slog.DiscardHandler), &Config{})
+	if err := w.Reload(); err != ErrNoConfigFile {
+		t.Fatalf("Reload without file error = %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditEventRegister          = "register"
+	AuditEventUnregister        = "unregister"
+	AuditEventLogin             = "login"
+	AuditEventLogout            = "logout"
+	AuditEventUpdatePassword    = "update_password"
+	AuditEventRefreshToken      = "refresh_token"
+	AuditEventRefreshTokenReuse = "refresh_token_reuse"
+	AuditEventImpersonate       = "impersonate"
+	AuditEventExchangeToken     = "exchange_token"
+
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+type AuditEvent struct {
+	AuditEventId *uuid.UUID `json:"audit_event_id" db:"audit_event_id"`
+	EventType    string     `json:"event_type" db:"event_type"`
+	UserId       *uuid.UUID `json:"user_id" db:"user_id"`
+	Login        string     `json:"login" db:"login"`
+	ActorId      string     `json:"actor_id" db:"actor_id"`
+	Ip           string     `json:"ip" db:"ip"`
+	UserAgent    string     `json:"user_agent" db:"user_agent"`
+	Outcome      string     `json:"outcome" db:"outcome"`
+	Details      string     `json:"details" db:"details"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
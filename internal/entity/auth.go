@@ -6,10 +6,16 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	UserId   *uuid.UUID `json:"user_id" db:"user_id"`
 	Login    string     `json:"login" db:"login"`
 	Password string     `json:"password" db:"password"`
+	Role     string     `json:"role" db:"role"`
 }
 
 type RefreshToken struct {
@@ -18,4 +24,14 @@ type RefreshToken struct {
 	DeviceCode     string     `json:"device_code" db:"device_code"`
 	ExpirationAt   time.Time  `json:"expiration_at" db:"expiration_at"`
 	IsRevoke       bool       `json:"is_revoke" db:"is_revoke"`
+	RevokedAt      *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+type Impersonation struct {
+	ImpersonationId *uuid.UUID `json:"impersonation_id" db:"impersonation_id"`
+	AdminId         *uuid.UUID `json:"admin_id" db:"admin_id"`
+	UserId          *uuid.UUID `json:"user_id" db:"user_id"`
+	Reason          string     `json:"reason" db:"reason"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	ExpirationAt    time.Time  `json:"expiration_at" db:"expiration_at"`
 }
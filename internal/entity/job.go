@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+const (
+	JobOutcomeSuccess = "success"
+	JobOutcomeFailure = "failure"
+)
+
+// JobRun - последний запуск задачи планировщика на любом из экземпляров сервиса
+type JobRun struct {
+	Name         string        `json:"name" db:"name"`
+	Instance     string        `json:"instance" db:"instance"`
+	StartedAt    time.Time     `json:"started_at" db:"started_at"`
+	Duration     time.Duration `json:"duration" db:"duration_ms"`
+	Outcome      string        `json:"outcome" db:"outcome"`
+	Error        string        `json:"error" db:"error"`
+	RowsAffected int64         `json:"rows_affected" db:"rows_affected"`
+}
+
+// Job - задача планировщика. NextRunAt - время следующего запуска по расписанию на этом экземпляре,
+// nil для отключенной задачи. LastRun - последний запуск на любом из экземпляров
+type Job struct {
+	Name      string     `json:"name"`
+	Schedule  string     `json:"schedule"`
+	Disabled  bool       `json:"disabled"`
+	Running   bool       `json:"running"`
+	NextRunAt *time.Time `json:"next_run_at"`
+	LastRun   *JobRun    `json:"last_run"`
+}
@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventUserRegistered  = "user.registered"
+	EventUserDeleted     = "user.deleted"
+	EventPasswordChanged = "password.changed"
+	EventSessionRevoked  = "session.revoked"
+
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+type OutboxEvent struct {
+	OutboxId      *uuid.UUID      `json:"outbox_id" db:"outbox_id"`
+	EventType     string          `json:"event_type" db:"event_type"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string          `json:"last_error" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+// UserEventPayload - данные событий user.*, password.changed, session.revoked
+type UserEventPayload struct {
+	UserId     *uuid.UUID `json:"userId"`
+	Login      string     `json:"login,omitempty"`
+	DeviceCode string     `json:"deviceCode,omitempty"`
+	OccurredAt time.Time  `json:"occurredAt"`
+}
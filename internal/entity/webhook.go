@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusDelivered = "delivered"
+	WebhookDeliveryStatusFailed    = "failed"
+)
+
+// WebhookEventTypes - события, на которые можно подписаться
+var WebhookEventTypes = []string{
+	EventUserRegistered,
+	EventUserDeleted,
+	EventSessionRevoked,
+	EventPasswordChanged,
+}
+
+type WebhookSubscription struct {
+	SubscriptionId *uuid.UUID `json:"subscription_id" db:"subscription_id"`
+	Url            string     `json:"url" db:"url"`
+	Secret         string     `json:"-" db:"secret"`
+	EventTypes     []string   `json:"event_types" db:"event_types"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// WebhookDelivery. Url и Secret заполняются из подписки при выборке доставок для отправки
+type WebhookDelivery struct {
+	DeliveryId     *uuid.UUID      `json:"delivery_id" db:"delivery_id"`
+	SubscriptionId *uuid.UUID      `json:"subscription_id" db:"subscription_id"`
+	EventId        *uuid.UUID      `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code" db:"last_status_code"`
+	LastError      string          `json:"last_error" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at" db:"delivered_at"`
+	Url            string          `json:"-" db:"url"`
+	Secret         string          `json:"-" db:"secret"`
+}
@@ -0,0 +1,54 @@
+package forwarded
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// MetadataKey - ключ метаданных, в котором шлюз передает gRPC серверу адрес HTTP клиента. Значение
+// начинается с ключа шлюза: клиент gRPC сервера может передать любые метаданные, в том числе
+// x-forwarded-for, и адрес из них не принимается
+const MetadataKey = "x-auth-gateway-client"
+
+// gatewayKey создается при запуске. Шлюз и gRPC сервер работают в одном процессе, поэтому ключ
+// известен только им
+var gatewayKey = rand.Text()
+
+// GatewayMetadata передает адрес HTTP клиента из соединения шлюза. Заголовок X-Forwarded-For
+// задается клиентом и не используется
+func GatewayMetadata(ctx context.Context, r *http.Request) metadata.MD {
+	ip := host(r.RemoteAddr)
+	if ip == "" {
+		return nil
+	}
+	return metadata.Pairs(MetadataKey, gatewayKey+" "+ip)
+}
+
+// ClientIp возвращает адрес, переданный шлюзом, а для остальных запросов адрес gRPC клиента
+func ClientIp(ctx context.Context) string {
+	if values := metadata.ValueFromIncomingContext(ctx, MetadataKey); len(values) != 0 {
+		key, ip, ok := strings.Cut(values[0], " ")
+		if ok && subtle.ConstantTimeCompare([]byte(key), []byte(gatewayKey)) == 1 {
+			return ip
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return host(p.Addr.String())
+	}
+	return ""
+}
+
+// host отбрасывает порт из адреса, адрес без порта возвращается как есть
+func host(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,39 @@
+package forwarded
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientIp(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/v1/login", nil)
+	r.RemoteAddr = "198.51.100.7:51234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+	gateway := GatewayMetadata(context.Background(), r)
+	p := &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000}}
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want string
+	}{
+		{name: "gateway", md: gateway, want: "198.51.100.7"},
+		{name: "grpc client", md: metadata.MD{}, want: "192.0.2.10"},
+		{name: "x-forwarded-for", md: metadata.Pairs("x-forwarded-for", "203.0.113.1"), want: "192.0.2.10"},
+		{name: "forged key", md: metadata.Pairs(MetadataKey, "guess 203.0.113.1"), want: "192.0.2.10"},
+		{name: "without key", md: metadata.Pairs(MetadataKey, "203.0.113.1"), want: "192.0.2.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(metadata.NewIncomingContext(context.Background(), tt.md), p)
+			if got := ClientIp(ctx); got != tt.want {
+				t.Fatalf("ClientIp = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
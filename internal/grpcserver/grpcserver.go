@@ -2,29 +2,47 @@ package grpcserver
 
 import (
 	"context"
+	"crypto/tls"
+	"log"
 	"log/slog"
 	"net"
-	"os"
-	"os/signal"
-	"syscall"
+	"sync"
+	"time"
 
 	auth "skillsRockGRPC/grpc/gen"
 	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/health"
+	"skillsRockGRPC/internal/metrics"
+	"skillsRockGRPC/internal/requestid"
 	"skillsRockGRPC/internal/service"
+	"skillsRockGRPC/internal/tlsreload"
+	"skillsRockGRPC/internal/validation"
 	"skillsRockGRPC/pkg/servererrors"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/recovery"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
+// Период обновления статусов сервиса grpc.health.v1 по проверкам готовности
+const healthCheckInterval = 5 * time.Second
+
 type GRPCServer struct {
-	lg         *slog.Logger
-	gRPCServer *grpc.Server
-	cfg        *config.Grpc
+	lg           *slog.Logger
+	gRPCServer   *grpc.Server
+	health       *health.Health
+	healthServer *grpchealth.Server
+	tls          *tlsreload.Reloader
+	cfg          *config.Grpc
+	chErr        chan error
+	chStop       chan struct{}
+	stopOnce     sync.Once
 }
 
 func InterceptorLogger(l *slog.Logger) logging.Logger {
@@ -32,52 +50,136 @@ func InterceptorLogger(l *slog.Logger) logging.Logger {
 		l.Log(ctx, slog.Level(lvl), msg, fields...)
 	})
 }
-func New(authServer *service.Service, lg *slog.Logger, cfg *config.Grpc) *GRPCServer {
+
+// New. При заданном сертификате сервер принимает только TLS соединения, при заданном CA клиентов - только
+// соединения с клиентским сертификатом. Ошибка загрузки сертификатов завершает приложение
+func New(authServer *service.Service, hc *health.Health, mt *metrics.Metrics, lg *slog.Logger, cfg *config.Grpc) *GRPCServer {
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(logging.FinishCall),
 	}
 	recoveryOpts := []recovery.Option{
 		recovery.WithRecoveryHandler(func(p interface{}) (err error) {
 			lg.Error("GRPC SERVER: recovered from panic", slog.Any("panic", p))
-			return status.Error(codes.Internal, servererrors.ErrInternalServerError.Error())
+			return servererrors.Internal()
 		}),
 	}
-	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
-		recovery.UnaryServerInterceptor(recoveryOpts...),
-		logging.UnaryServerInterceptor(InterceptorLogger(lg), loggingOpts...),
-	))
+	opts := []grpc.ServerOption{
+		//серверный спан создается до цепочки перехватчиков, поэтому записи журнала содержат идентификатор трассировки
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))),
+		grpc.ChainUnaryInterceptor(
+			requestid.UnaryServerInterceptor(),
+			mt.GRPCServerMetrics().UnaryServerInterceptor(),
+			recovery.UnaryServerInterceptor(recoveryOpts...),
+			logging.UnaryServerInterceptor(InterceptorLogger(lg), loggingOpts...),
+			validation.UnaryServerInterceptor(validation.MustNew(auth.File_grpc_proto_auth_proto)),
+		),
+	}
+	var reloader *tlsreload.Reloader
+	if cfg.TLS.CertPath != "" {
+		var err error
+		reloader, err = tlsreload.New(lg, cfg.TLS.CertPath, cfg.TLS.KeyPath, cfg.TLS.ClientCAPath)
+		if err != nil {
+			log.Fatalf("GRPC server: %v", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig(tls.RequireAndVerifyClientCert, "h2"))))
+	}
+	grpcServer := grpc.NewServer(opts...)
 	auth.RegisterAuthServiceServer(grpcServer, authServer)
 
+	//до первой проверки готовности сервис считается неготовым
+	healthServer := grpchealth.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(auth.AuthService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	mt.GRPCServerMetrics().InitializeMetrics(grpcServer)
+
 	return &GRPCServer{
-		lg:         lg,
-		gRPCServer: grpcServer,
-		cfg:        cfg,
+		lg:           lg,
+		gRPCServer:   grpcServer,
+		health:       hc,
+		healthServer: healthServer,
+		tls:          reloader,
+		cfg:          cfg,
+		chErr:        make(chan error, 1),
+		chStop:       make(chan struct{}),
 	}
 }
-func (g *GRPCServer) Run() {
-	chErr := make(chan error, 1)
-	defer close(chErr)
 
+// Start открывает адрес cfg.Addr и запускает обслуживание запросов
+func (g *GRPCServer) Start() error {
+	listener, err := net.Listen("tcp", g.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	g.Serve(listener)
+	return nil
+}
+
+// Serve обслуживает запросы на listener до вызова Stop. Ошибка обслуживания передается в Err
+func (g *GRPCServer) Serve(listener net.Listener) {
+	if g.tls != nil {
+		g.tls.Watch(g.cfg.TLS.ReloadInterval)
+	}
+	go g.watchHealth(g.chStop)
+	g.lg.Info("GRPC server start", slog.String("addr", listener.Addr().String()), slog.Bool("tls", g.tls != nil))
 	go func() {
-		g.lg.Info("GRPC server start", slog.String("addr", g.cfg.Addr))
-		listener, err := net.Listen("tcp", g.cfg.Addr)
-		if err != nil {
-			chErr <- err
-			return
+		if err := g.gRPCServer.Serve(listener); err != nil {
+			g.lg.Error("GRPC server error", slog.Any("error", err))
+			g.chErr <- err
 		}
-		chErr <- g.gRPCServer.Serve(listener)
 	}()
+}
+
+// Err возвращает ошибку, с которой сервер прекратил обслуживание запросов
+func (g *GRPCServer) Err() <-chan error {
+	return g.chErr
+}
+
+// Shutdown переводит сервис grpc.health.v1 в NOT_SERVING, чтобы клиенты перестали направлять запросы
+func (g *GRPCServer) Shutdown() {
+	g.stopOnce.Do(func() { close(g.chStop) })
+	g.healthServer.Shutdown()
+}
+
+// Stop дожидается завершения выполняющихся запросов. По истечении ctx соединения закрываются принудительно
+func (g *GRPCServer) Stop(ctx context.Context) error {
+	g.Shutdown()
+	defer func() {
+		if g.tls != nil {
+			g.tls.Stop()
+		}
+	}()
+	chDone := make(chan struct{})
 	go func() {
-		chQuit := make(chan os.Signal, 1)
-		signal.Notify(chQuit, syscall.SIGINT, syscall.SIGTERM)
-		<-chQuit
 		g.gRPCServer.GracefulStop()
-		chErr <- nil
+		close(chDone)
 	}()
-	if err := <-chErr; err != nil {
-		g.lg.Error("GRPC server error", slog.Any("error", err))
-		return
+	select {
+	case <-chDone:
+		g.lg.Info("GRPC server stop")
+		return nil
+	case <-ctx.Done():
+		g.gRPCServer.Stop()
+		<-chDone
+		g.lg.Warn("GRPC server stop, requests are interrupted", slog.Any("error", ctx.Err()))
+		return ctx.Err()
 	}
+}
 
-	g.lg.Info("GRPC server stop")
+// watchHealth переносит результат проверок готовности в статусы сервиса grpc.health.v1
+func (g *GRPCServer) watchHealth(chStop <-chan struct{}) {
+	for {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		if ready, results := g.health.Ready(context.Background()); !ready {
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+			g.lg.Warn("GRPC server is not ready", slog.Any("checks", results))
+		}
+		g.healthServer.SetServingStatus("", servingStatus)
+		g.healthServer.SetServingStatus(auth.AuthService_ServiceDesc.ServiceName, servingStatus)
+		select {
+		case <-chStop:
+			return
+		case <-time.After(healthCheckInterval):
+		}
+	}
 }
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// Checker проверяет готовность компонента приложения к обслуживанию запросов
+type Checker func(ctx context.Context) error
+
+// Health собирает проверки готовности компонентов. После Shutdown приложение считается неготовым,
+// чтобы балансировщик перестал направлять запросы до завершения обработки текущих
+type Health struct {
+	mu       sync.RWMutex
+	names    []string
+	checkers map[string]Checker
+	shutdown atomic.Bool
+	timeout  time.Duration
+	lg       *slog.Logger
+}
+
+func New(lg *slog.Logger, timeout time.Duration) *Health {
+	return &Health{
+		checkers: map[string]Checker{},
+		timeout:  timeout,
+		lg:       lg,
+	}
+}
+
+func (h *Health) AddChecker(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checkers[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checkers[name] = checker
+}
+func (h *Health) Shutdown() {
+	h.shutdown.Store(true)
+}
+func (h *Health) IsShutdown() bool {
+	return h.shutdown.Load()
+}
+
+// Ready выполняет все проверки и возвращает ошибки по именам компонентов, nil - компонент готов
+func (h *Health) Ready(ctx context.Context) (bool, map[string]error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ready := !h.shutdown.Load()
+	results := make(map[string]error, len(h.names))
+	for _, name := range h.names {
+		err := h.checkers[name](ctx)
+		if err != nil {
+			ready = false
+		}
+		results[name] = err
+	}
+	if h.shutdown.Load() {
+		results["shutdown"] = ErrShuttingDown
+	}
+	return ready, results
+}
+
+// LiveHandler - проверка живости процесса, не зависит от внешних компонентов
+func (h *Health) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// ReadyHandler отдает только результат проверок "ok" или "fail": адрес не требует авторизации, а текст
+// ошибки может содержать адреса и параметры подключений. Причина отказа записывается в журнал
+func (h *Health) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	ready, results := h.Ready(r.Context())
+	checks := make(map[string]string, len(results))
+	for name, err := range results {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = "fail"
+			if !errors.Is(err, ErrShuttingDown) {
+				h.lg.WarnContext(r.Context(), "HEALTH: readiness check failed", slog.String("check", name), slog.Any("error", err))
+			}
+		}
+	}
+	body := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: "ok",
+		Checks: checks,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		body.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(&body)
+}
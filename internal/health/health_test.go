@@ -0,0 +1,60 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/health"
+)
+
+func TestReadyHandler(t *testing.T) {
+	var logs strings.Builder
+	hc := health.New(slog.New(slog.NewTextHandler(&logs, nil)), time.Second)
+	hc.AddChecker("store", func(ctx context.Context) error {
+		return errors.New("dial tcp db.internal:5432: password authentication failed for user \"auth\"")
+	})
+	hc.AddChecker("signingKey", func(ctx context.Context) error { return nil })
+
+	ready := func() (int, string, map[string]string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		hc.ReadyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		data, _ := io.ReadAll(rec.Body)
+		var body struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("readyz body %s: %v", data, err)
+		}
+		//текст ошибки проверки не попадает в ответ
+		if strings.Contains(string(data), "db.internal") {
+			t.Fatalf("readyz body contains check error: %s", data)
+		}
+		return rec.Code, body.Status, body.Checks
+	}
+	code, status, checks := ready()
+	if code != http.StatusServiceUnavailable || status != "unavailable" || checks["store"] != "fail" || checks["signingKey"] != "ok" {
+		t.Fatalf("readyz = %d %s %v", code, status, checks)
+	}
+	if !strings.Contains(logs.String(), "db.internal:5432") {
+		t.Fatalf("check error is not logged: %s", logs.String())
+	}
+
+	hc.AddChecker("store", func(ctx context.Context) error { return nil })
+	if code, status, _ := ready(); code != http.StatusOK || status != "ok" {
+		t.Fatalf("readyz = %d %s", code, status)
+	}
+	hc.Shutdown()
+	if code, _, checks := ready(); code != http.StatusServiceUnavailable || checks["shutdown"] != "fail" {
+		t.Fatalf("readyz after shutdown = %d %v", code, checks)
+	}
+}
@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"skillsRockGRPC/internal/requestid"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorBody - JSON ответ шлюза при ошибке. Поля reason, fieldViolations и retryDelay заполняются из
+// деталей gRPC статуса google.rpc.ErrorInfo, google.rpc.BadRequest и google.rpc.RetryInfo
+type errorBody struct {
+	Error errorDetail `json:"error"`
+}
+type errorDetail struct {
+	Code            int               `json:"code"`
+	Status          string            `json:"status"`
+	Message         string            `json:"message"`
+	Reason          string            `json:"reason,omitempty"`
+	Domain          string            `json:"domain,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	FieldViolations []fieldViolation  `json:"fieldViolations,omitempty"`
+	RetryDelay      string            `json:"retryDelay,omitempty"`
+	RequestId       string            `json:"requestId,omitempty"`
+}
+type fieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// errorHandler отдает ошибки gRPC в едином JSON формате errorBody. При RetryInfo устанавливается
+// заголовок Retry-After
+func errorHandler(lg *slog.Logger) runtime.ErrorHandlerFunc {
+	return func(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+		st := status.Convert(err)
+		httpStatus := runtime.HTTPStatusFromCode(st.Code())
+		detail := errorDetail{
+			Code:      httpStatus,
+			Status:    code.Code(st.Code()).String(),
+			Message:   st.Message(),
+			RequestId: requestid.FromContext(ctx),
+		}
+		for _, d := range st.Details() {
+			switch d := d.(type) {
+			case *errdetails.ErrorInfo:
+				detail.Reason = d.Reason
+				detail.Domain = d.Domain
+				detail.Metadata = d.Metadata
+			case *errdetails.BadRequest:
+				for _, violation := range d.FieldViolations {
+					detail.FieldViolations = append(detail.FieldViolations, fieldViolation{
+						Field:       violation.Field,
+						Description: violation.Description,
+					})
+				}
+			case *errdetails.RetryInfo:
+				retryDelay := d.RetryDelay.AsDuration()
+				detail.RetryDelay = retryDelay.String()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryDelay.Seconds()))))
+			}
+		}
+		w.Header().Del("Trailer")
+		w.Header().Set("Content-Type", "application/json")
+		if st.Code() == codes.Unauthenticated {
+			w.Header().Set("WWW-Authenticate", authenticateChallenge(detail.Reason))
+		}
+		w.WriteHeader(httpStatus)
+		if err := json.NewEncoder(w).Encode(&errorBody{Error: detail}); err != nil {
+			lg.ErrorContext(ctx, "HTTP server: error response is not written", slog.Any("error", err))
+		}
+	}
+}
+
+// authenticateChallenge возвращает заголовок WWW-Authenticate по RFC 6750. Код ошибки invalid_token указывается
+// только для отклоненного токена доступа, остальные ответы 401 (неверный пароль, отозванный refresh токен)
+// сообщают лишь схему авторизации
+func authenticateChallenge(reason string) string {
+	if reason == servererrors.ReasonInvalidAccessToken {
+		return `Bearer realm="auth", error="invalid_token"`
+	}
+	return `Bearer realm="auth"`
+}
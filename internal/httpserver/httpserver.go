@@ -2,57 +2,183 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/forwarded"
+	"skillsRockGRPC/internal/health"
+	"skillsRockGRPC/internal/requestid"
+	"skillsRockGRPC/internal/tlsreload"
 
 	auth "skillsRockGRPC/grpc/gen"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 type HttpServer struct {
 	lg         *slog.Logger
 	httpServer *http.Server
+	tls        *tlsreload.Reloader
+	upstream   *tlsreload.Reloader
 	cfg        *config.Http
+	cancel     context.CancelFunc
+	chErr      chan error
 }
 
-func MustNew(lg *slog.Logger, cfgHttp *config.Http, cfgGrpc *config.Grpc) *HttpServer {
+// MustNew. Шлюз подключается к gRPC серверу по TLS, если TLS включен на gRPC сервере. Сертификат из
+// cfgHttp.Upstream предъявляется gRPC серверу при mTLS. Проверки живости и готовности доступны
+// по адресам /healthz и /readyz. dialOpts дополняют параметры подключения к gRPC серверу
+func MustNew(hc *health.Health, lg *slog.Logger, cfgHttp *config.Http, cfgGrpc *config.Grpc, dialOpts ...grpc.DialOption) *HttpServer {
 
-	ctx := context.Background()
-	mux := runtime.NewServeMux()
-	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	//соединение шлюза с gRPC сервером закрывается при отмене ctx в Stop
+	ctx, cancel := context.WithCancel(context.Background())
+	mux := runtime.NewServeMux(
+		runtime.WithMetadata(requestid.GatewayMetadata),
+		runtime.WithMetadata(forwarded.GatewayMetadata),
+		runtime.WithErrorHandler(errorHandler(lg)),
+	)
+	//контекст трассировки из HTTP запроса передается в gRPC метаданных
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	}
+	var upstream *tlsreload.Reloader
+	if cfgGrpc.TLS.CertPath != "" {
+		var err error
+		upstream, err = tlsreload.New(lg, cfgHttp.Upstream.CertPath, cfgHttp.Upstream.KeyPath, cfgHttp.Upstream.ClientCAPath)
+		if err != nil {
+			log.Fatalf("HTTP server: %v", err)
+		}
+		opts[0] = grpc.WithTransportCredentials(credentials.NewTLS(upstream.ClientConfig(cfgHttp.Upstream.ServerName)))
+	}
+	opts = append(opts, dialOpts...)
 	err := auth.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, cfgGrpc.Addr, opts)
 	if err != nil {
 		log.Fatalf("HTTP server: %v", err)
 	}
+	//при mTLS сертификат клиента обязателен для API, но не для проверок живости и готовности: оркестратор
+	//обращается к ним без сертификата
+	var api http.Handler = mux
+	if cfgHttp.TLS.ClientCAPath != "" {
+		api = requireClientCert(mux)
+	}
+	handler := http.NewServeMux()
+	handler.HandleFunc("GET /healthz", hc.LiveHandler)
+	handler.HandleFunc("GET /readyz", hc.ReadyHandler)
+	handler.Handle("/", otelhttp.NewHandler(requestid.Middleware(api), "gateway",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}),
+	))
 	httpServer := &http.Server{
 		Addr:    cfgHttp.Addr,
-		Handler: mux,
+		Handler: handler,
+	}
+	var reloader *tlsreload.Reloader
+	if cfgHttp.TLS.CertPath != "" {
+		reloader, err = tlsreload.New(lg, cfgHttp.TLS.CertPath, cfgHttp.TLS.KeyPath, cfgHttp.TLS.ClientCAPath)
+		if err != nil {
+			log.Fatalf("HTTP server: %v", err)
+		}
+		httpServer.TLSConfig = reloader.ServerConfig(tls.VerifyClientCertIfGiven, "h2", "http/1.1")
 	}
 
 	return &HttpServer{
 		lg:         lg,
 		httpServer: httpServer,
+		tls:        reloader,
+		upstream:   upstream,
 		cfg:        cfgHttp,
+		cancel:     cancel,
+		chErr:      make(chan error, 1),
+	}
+}
+
+// requireClientCert отклоняет запросы без сертификата клиента. Предъявленный сертификат уже проверен по CA
+// при установке соединения
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(&errorBody{Error: errorDetail{
+				Code:      http.StatusForbidden,
+				Status:    code.Code_PERMISSION_DENIED.String(),
+				Message:   "client certificate required",
+				RequestId: requestid.FromContext(r.Context()),
+			}})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start открывает адрес cfg.Addr и запускает обслуживание запросов
+func (h *HttpServer) Start() error {
+	listener, err := net.Listen("tcp", h.cfg.Addr)
+	if err != nil {
+		return err
 	}
+	h.Serve(listener)
+	return nil
 }
-func (h *HttpServer) Run() {
+
+// Serve обслуживает запросы на listener до вызова Stop. Ошибка обслуживания передается в Err
+func (h *HttpServer) Serve(listener net.Listener) {
+	if h.tls != nil {
+		h.tls.Watch(h.cfg.TLS.ReloadInterval)
+	}
+	if h.upstream != nil {
+		h.upstream.Watch(h.cfg.Upstream.ReloadInterval)
+	}
+	h.lg.Info("HTTP serever start", slog.String("addr", listener.Addr().String()), slog.Bool("tls", h.tls != nil))
 	go func() {
-		h.lg.Info("HTTP serever start", slog.String("addr", h.cfg.Addr))
-		if err := h.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if h.tls != nil {
+			//сертификат берется из TLSConfig
+			err = h.httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = h.httpServer.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			h.lg.Error("HTTP server error", slog.Any("error", err))
+			h.chErr <- err
 		}
 	}()
 }
-func (h *HttpServer) Stop() {
-	err := h.httpServer.Shutdown(context.Background())
+
+// Err возвращает ошибку, с которой сервер прекратил обслуживание запросов
+func (h *HttpServer) Err() <-chan error {
+	return h.chErr
+}
+
+// Stop дожидается завершения выполняющихся запросов не дольше ctx и закрывает соединение с gRPC сервером
+func (h *HttpServer) Stop(ctx context.Context) error {
+	err := h.httpServer.Shutdown(ctx)
+	if err != nil {
+		h.httpServer.Close()
+	}
+	h.cancel()
+	if h.tls != nil {
+		h.tls.Stop()
+	}
+	if h.upstream != nil {
+		h.upstream.Stop()
+	}
 	if err != nil {
 		h.lg.Error("HTTP server error", slog.Any("error", err))
-		return
+		return err
 	}
 	h.lg.Info("HTTP server stop")
+	return nil
 }
@@ -0,0 +1,49 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"skillsRockGRPC/internal/requestid"
+)
+
+func TestRequireClientCert(t *testing.T) {
+	handler := requestid.Middleware(requireClientCert(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		want  int
+	}{
+		{name: "plain http", state: nil, want: http.StatusForbidden},
+		{name: "no client certificate", state: &tls.ConnectionState{}, want: http.StatusForbidden},
+		{name: "verified client certificate", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+			r.TLS = tt.state
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusForbidden {
+				return
+			}
+			var body errorBody
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %s: %v", w.Body, err)
+			}
+			if body.Error.Status != "PERMISSION_DENIED" || body.Error.RequestId == "" || body.Error.RequestId != w.Header().Get(requestid.Header) {
+				t.Fatalf("error body = %+v", body.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"skillsRockGRPC/internal/requestid"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextHandler добавляет в записи идентификатор запроса и идентификаторы трассировки и спана из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestId := requestid.FromContext(ctx); requestId != "" {
+		r.AddAttrs(slog.String("requestId", requestId))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		r.AddAttrs(
+			slog.String("traceId", spanContext.TraceID().String()),
+			slog.String("spanId", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -6,27 +6,50 @@ import (
 	"os"
 )
 
-func MustNew(env string) *slog.Logger {
+// level - общий уровень логирования обработчиков, изменяется SetLevel без пересоздания логгера
+var level = new(slog.LevelVar)
+
+// MustNew создает логгер окружения env. logLevel переопределяет уровень окружения, пустое значение его не меняет
+func MustNew(env string, logLevel string) *slog.Logger {
 	var lg *slog.Logger
 	switch env {
 	case "local":
 		log.Printf("LOGGER: the logger is configured for deployment environment 'local'\n")
-		lg = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-		)
+		lg = slog.New(contextHandler{
+			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}),
+		})
 	case "dev":
 		log.Printf("LOGGER: the logger is configured for deployment environment 'dev'\n")
-		lg = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
-		)
+		lg = slog.New(contextHandler{
+			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}),
+		})
 	case "prod":
 		log.Printf("LOGGER: the logger is configured for deployment environment 'prod'\n")
-		lg = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}),
-		)
+		lg = slog.New(contextHandler{
+			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}),
+		})
 	default:
 		log.Fatalf("LOGGER: the application deployment environment is not defined\n")
 	}
+	if err := SetLevel(env, logLevel); err != nil {
+		log.Fatalf("LOGGER: %v\n", err)
+	}
 
 	return lg
 }
+
+// SetLevel устанавливает уровень логирования: debug, info, warn, error. Пустой logLevel - уровень окружения env:
+// debug для local и dev, info для prod
+func SetLevel(env string, logLevel string) error {
+	newLevel := slog.LevelDebug
+	if env == "prod" {
+		newLevel = slog.LevelInfo
+	}
+	if logLevel != "" {
+		if err := newLevel.UnmarshalText([]byte(logLevel)); err != nil {
+			return err
+		}
+	}
+	level.Set(newLevel)
+	return nil
+}
@@ -0,0 +1,652 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Store - потокобезопасная реализация repository.Repository в памяти для тестов и запуска на одном узле
+// без базы данных. Повторяет поведение internal/store: уникальность логина, каскадное удаление токенов,
+// истории паролей и имперсонаций вместе с пользователем, запись событий outbox в той же операции. Данные не
+// сохраняются между запусками
+type Store struct {
+	mu              sync.RWMutex
+	users           map[uuid.UUID]*entity.User
+	logins          map[string]uuid.UUID
+	passwordHistory []*passwordHistory
+	refreshTokens   map[uuid.UUID]*entity.RefreshToken
+	impersonations  []*entity.Impersonation
+	auditEvents     []*entity.AuditEvent
+	outboxEvents    []*outboxEvent
+	subscriptions   []*entity.WebhookSubscription
+	deliveries      []*webhookDelivery
+	attempts        []*webhookDeliveryAttempt
+	jobRuns         map[string]*entity.JobRun
+}
+
+type passwordHistory struct {
+	userId   uuid.UUID
+	password string
+}
+type outboxEvent struct {
+	entity.OutboxEvent
+	lockedUntil *time.Time
+	sentAt      *time.Time
+}
+type webhookDelivery struct {
+	entity.WebhookDelivery
+	lockedUntil *time.Time
+}
+type webhookDeliveryAttempt struct {
+	attemptId  uuid.UUID
+	deliveryId uuid.UUID
+	statusCode int
+	error      string
+	createdAt  time.Time
+}
+
+func New() *Store {
+	return &Store{
+		users:         map[uuid.UUID]*entity.User{},
+		logins:        map[string]uuid.UUID{},
+		refreshTokens: map[uuid.UUID]*entity.RefreshToken{},
+		jobRuns:       map[string]*entity.JobRun{},
+	}
+}
+
+// Ping - хранилище в памяти всегда доступно
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) AddUser(ctx context.Context, dto *dto.AddUser) (*uuid.UUID, error) {
+	const op = "memstore.AddUser"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.logins[dto.Login]; ok {
+		return nil, errors.Wrap(repository.ErrUniqueViolation, op)
+	}
+	userId := uuid.New()
+	s.users[userId] = &entity.User{UserId: &userId, Login: dto.Login, Password: dto.Password, Role: entity.RoleUser}
+	s.logins[dto.Login] = userId
+	s.passwordHistory = append(s.passwordHistory, &passwordHistory{userId: userId, password: dto.Password})
+	s.addOutboxEvent(entity.EventUserRegistered, &entity.UserEventPayload{UserId: &userId, Login: dto.Login})
+	return &userId, nil
+}
+func (s *Store) GetUser(ctx context.Context, userId *uuid.UUID) (*entity.User, error) {
+	const op = "memstore.GetUser"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[*userId]
+	if !ok {
+		return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	return copyUser(user), nil
+}
+func (s *Store) GetUserByLogin(ctx context.Context, login string) (*entity.User, error) {
+	const op = "memstore.GetUserByLogin"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userId, ok := s.logins[login]
+	if !ok {
+		return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	return copyUser(s.users[userId]), nil
+}
+func (s *Store) UpdateUser(ctx context.Context, dto *dto.UpdateUser) error {
+	const op = "memstore.UpdateUser"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[*dto.UserId]
+	if !ok {
+		return errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	if dto.Login != nil && *dto.Login != user.Login {
+		if _, ok := s.logins[*dto.Login]; ok {
+			return errors.Wrap(repository.ErrUniqueViolation, op)
+		}
+		delete(s.logins, user.Login)
+		s.logins[*dto.Login] = *user.UserId
+		user.Login = *dto.Login
+	}
+	if dto.Password != nil {
+		user.Password = *dto.Password
+		s.passwordHistory = append(s.passwordHistory, &passwordHistory{userId: *user.UserId, password: *dto.Password})
+		if dto.PasswordHistorySize > 0 {
+			s.prunePasswordHistory(*user.UserId, dto.PasswordHistorySize)
+		}
+		s.addOutboxEvent(entity.EventPasswordChanged, &entity.UserEventPayload{UserId: user.UserId})
+	}
+	return nil
+}
+func (s *Store) RemoveUser(ctx context.Context, userId *uuid.UUID) error {
+	const op = "memstore.RemoveUser"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[*userId]
+	if !ok {
+		return errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	delete(s.users, *userId)
+	delete(s.logins, user.Login)
+	//каскадное удаление, как внешние ключи refresh_token, password_history и impersonation
+	for refreshTokenId, refreshToken := range s.refreshTokens {
+		if *refreshToken.UserId == *userId {
+			delete(s.refreshTokens, refreshTokenId)
+		}
+	}
+	s.passwordHistory = slices.DeleteFunc(s.passwordHistory, func(p *passwordHistory) bool {
+		return p.userId == *userId
+	})
+	s.impersonations = slices.DeleteFunc(s.impersonations, func(impersonation *entity.Impersonation) bool {
+		return *impersonation.UserId == *userId
+	})
+	s.addOutboxEvent(entity.EventUserDeleted, &entity.UserEventPayload{UserId: userId})
+	return nil
+}
+
+// GetPasswordHistory возвращает хеши последних limit паролей пользователя, включая текущий
+func (s *Store) GetPasswordHistory(ctx context.Context, userId *uuid.UUID, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	passwords := []string{}
+	for i := len(s.passwordHistory) - 1; i >= 0 && len(passwords) < limit; i-- {
+		if s.passwordHistory[i].userId == *userId {
+			passwords = append(passwords, s.passwordHistory[i].password)
+		}
+	}
+	return passwords, nil
+}
+
+// prunePasswordHistory оставляет в истории пользователя последние size паролей
+func (s *Store) prunePasswordHistory(userId uuid.UUID, size int) {
+	kept := 0
+	for i := len(s.passwordHistory) - 1; i >= 0; i-- {
+		if s.passwordHistory[i].userId != userId {
+			continue
+		}
+		if kept++; kept > size {
+			s.passwordHistory = slices.Delete(s.passwordHistory, i, i+1)
+		}
+	}
+}
+
+func (s *Store) AddRefreshTokenWithRefreshTokenId(ctx context.Context, dto *dto.AddRefreshTokenWithRefreshTokenId) error {
+	const op = "memstore.AddRefreshTokenWithRefreshTokenId"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//нарушение внешнего ключа или первичного ключа - внутренняя ошибка, как в internal/store
+	if _, ok := s.users[*dto.UserId]; !ok {
+		return errors.Wrap(repository.ErrInternalServerError, op)
+	}
+	if _, ok := s.refreshTokens[*dto.RefreshTokenId]; ok {
+		return errors.Wrap(repository.ErrInternalServerError, op)
+	}
+	refreshTokenId, userId := *dto.RefreshTokenId, *dto.UserId
+	refreshToken := &entity.RefreshToken{
+		RefreshTokenId: &refreshTokenId,
+		UserId:         &userId,
+		DeviceCode:     dto.DeviceCode,
+		ExpirationAt:   dto.ExpirationAt,
+		IsRevoke:       dto.IsRevoke,
+	}
+	if dto.IsRevoke {
+		now := time.Now()
+		refreshToken.RevokedAt = &now
+	}
+	s.refreshTokens[refreshTokenId] = refreshToken
+	return nil
+}
+func (s *Store) GetRefreshToken(ctx context.Context, refreshTokenId *uuid.UUID) (*entity.RefreshToken, error) {
+	const op = "memstore.GetRefreshToken"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	refreshToken, ok := s.refreshTokens[*refreshTokenId]
+	if !ok {
+		return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	return copyRefreshToken(refreshToken), nil
+}
+func (s *Store) RevokeRefreshTokenByRefreshTokenId(ctx context.Context, refreshTokenId *uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if refreshToken, ok := s.refreshTokens[*refreshTokenId]; ok {
+		if refreshToken.RevokedAt == nil {
+			now := time.Now()
+			refreshToken.RevokedAt = &now
+		}
+		refreshToken.IsRevoke = true
+	}
+	return nil
+}
+func (s *Store) RevokeRefreshTokensByUserIdAndDeviceCode(ctx context.Context, dto *dto.RevokeRefreshTokensByUserIdAndDeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	now := time.Now()
+	for _, refreshToken := range s.refreshTokens {
+		if *refreshToken.UserId != *dto.UserId || refreshToken.IsRevoke {
+			continue
+		}
+		if dto.DeviceCode != nil && refreshToken.DeviceCode != *dto.DeviceCode {
+			continue
+		}
+		refreshToken.IsRevoke, refreshToken.RevokedAt = true, &now
+		count++
+	}
+	if count > 0 {
+		payload := &entity.UserEventPayload{UserId: dto.UserId}
+		if dto.DeviceCode != nil {
+			payload.DeviceCode = *dto.DeviceCode
+		}
+		s.addOutboxEvent(entity.EventSessionRevoked, payload)
+	}
+	return nil
+}
+func (s *Store) GetActiveRefreshTokensByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	refreshTokens := []*entity.RefreshToken{}
+	for _, refreshToken := range s.refreshTokens {
+		if *refreshToken.UserId == *userId && !refreshToken.IsRevoke && refreshToken.ExpirationAt.After(now) {
+			refreshTokens = append(refreshTokens, copyRefreshToken(refreshToken))
+		}
+	}
+	slices.SortFunc(refreshTokens, func(a, b *entity.RefreshToken) int {
+		return a.ExpirationAt.Compare(b.ExpirationAt)
+	})
+	return refreshTokens, nil
+}
+func (s *Store) RemoveRefreshTokensByExpirationAt(ctx context.Context, now time.Time, limit int) (int64, error) {
+	return s.removeRefreshTokens(limit, func(refreshToken *entity.RefreshToken) bool {
+		return refreshToken.ExpirationAt.Before(now)
+	}), nil
+}
+func (s *Store) RemoveRefreshTokensByRevokedAt(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return s.removeRefreshTokens(limit, func(refreshToken *entity.RefreshToken) bool {
+		return refreshToken.IsRevoke && refreshToken.RevokedAt != nil && refreshToken.RevokedAt.Before(before)
+	}), nil
+}
+func (s *Store) removeRefreshTokens(limit int, match func(*entity.RefreshToken) bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for refreshTokenId, refreshToken := range s.refreshTokens {
+		if count == int64(limit) {
+			break
+		}
+		if match(refreshToken) {
+			delete(s.refreshTokens, refreshTokenId)
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Store) AddImpersonation(ctx context.Context, dto *dto.AddImpersonation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	impersonationId, adminId, userId := *dto.ImpersonationId, *dto.AdminId, *dto.UserId
+	s.impersonations = append(s.impersonations, &entity.Impersonation{
+		ImpersonationId: &impersonationId,
+		AdminId:         &adminId,
+		UserId:          &userId,
+		Reason:          dto.Reason,
+		CreatedAt:       time.Now(),
+		ExpirationAt:    dto.ExpirationAt,
+	})
+	return nil
+}
+func (s *Store) GetActiveImpersonationsByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.Impersonation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	impersonations := []*entity.Impersonation{}
+	for _, impersonation := range s.impersonations {
+		if *impersonation.UserId == *userId && impersonation.ExpirationAt.After(now) {
+			copied := *impersonation
+			impersonations = append(impersonations, &copied)
+		}
+	}
+	return impersonations, nil
+}
+
+func (s *Store) AddAuditEvent(ctx context.Context, dto *dto.AddAuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	auditEventId := uuid.New()
+	s.auditEvents = append(s.auditEvents, &entity.AuditEvent{
+		AuditEventId: &auditEventId,
+		EventType:    dto.EventType,
+		UserId:       copyUuid(dto.UserId),
+		Login:        dto.Login,
+		ActorId:      dto.ActorId,
+		Ip:           dto.Ip,
+		UserAgent:    dto.UserAgent,
+		Outcome:      dto.Outcome,
+		Details:      dto.Details,
+		CreatedAt:    dto.CreatedAt,
+	})
+	return nil
+}
+func (s *Store) GetAuditEvents(ctx context.Context, dto *dto.GetAuditEvents) ([]*entity.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	auditEvents := []*entity.AuditEvent{}
+	for _, auditEvent := range s.auditEvents {
+		if dto.From != nil && auditEvent.CreatedAt.Before(*dto.From) {
+			continue
+		}
+		if dto.To != nil && !auditEvent.CreatedAt.Before(*dto.To) {
+			continue
+		}
+		if dto.UserId != nil && (auditEvent.UserId == nil || *auditEvent.UserId != *dto.UserId) {
+			continue
+		}
+		copied := *auditEvent
+		auditEvents = append(auditEvents, &copied)
+	}
+	slices.SortStableFunc(auditEvents, func(a, b *entity.AuditEvent) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return auditEvents[:min(len(auditEvents), dto.Limit)], nil
+}
+func (s *Store) RemoveAuditEventsByCreatedAt(ctx context.Context, before time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	s.auditEvents = slices.DeleteFunc(s.auditEvents, func(auditEvent *entity.AuditEvent) bool {
+		if count == limit || !auditEvent.CreatedAt.Before(before) {
+			return false
+		}
+		count++
+		return true
+	})
+	return int64(count), nil
+}
+
+// addOutboxEvent записывает событие в outbox под блокировкой изменения данных
+func (s *Store) addOutboxEvent(eventType string, payload *entity.UserEventPayload) {
+	now := time.Now()
+	payload.OccurredAt = now
+	data, _ := json.Marshal(payload)
+	outboxId := uuid.New()
+	s.outboxEvents = append(s.outboxEvents, &outboxEvent{OutboxEvent: entity.OutboxEvent{
+		OutboxId:      &outboxId,
+		EventType:     eventType,
+		Payload:       data,
+		Status:        entity.OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}})
+}
+func (s *Store) ClaimOutboxEvents(ctx context.Context, dto *dto.ClaimOutboxEvents) ([]*entity.OutboxEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	outboxEvents := []*entity.OutboxEvent{}
+	for _, event := range s.outboxEvents {
+		if len(outboxEvents) == dto.Limit {
+			break
+		}
+		if event.Status != entity.OutboxStatusPending || event.NextAttemptAt.After(dto.Now) || !unlocked(event.lockedUntil, dto.Now) {
+			continue
+		}
+		lockedUntil := dto.LockedUntil
+		event.lockedUntil = &lockedUntil
+		copied := event.OutboxEvent
+		copied.Payload = slices.Clone(event.Payload)
+		outboxEvents = append(outboxEvents, &copied)
+	}
+	return outboxEvents, nil
+}
+func (s *Store) UpdateOutboxEvent(ctx context.Context, dto *dto.UpdateOutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.outboxEvents {
+		if *event.OutboxId == *dto.OutboxId {
+			event.Status = dto.Status
+			event.Attempts = dto.Attempts
+			event.NextAttemptAt = dto.NextAttemptAt
+			event.LastError = dto.LastError
+			event.sentAt = dto.SentAt
+			event.lockedUntil = nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddWebhookSubscription(ctx context.Context, dto *dto.AddWebhookSubscription) (*uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscriptionId := uuid.New()
+	s.subscriptions = append(s.subscriptions, &entity.WebhookSubscription{
+		SubscriptionId: &subscriptionId,
+		Url:            dto.Url,
+		Secret:         dto.Secret,
+		EventTypes:     slices.Clone(dto.EventTypes),
+		CreatedAt:      time.Now(),
+	})
+	return &subscriptionId, nil
+}
+func (s *Store) GetWebhookSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subscriptions := []*entity.WebhookSubscription{}
+	for _, subscription := range s.subscriptions {
+		copied := *subscription
+		copied.EventTypes = slices.Clone(subscription.EventTypes)
+		subscriptions = append(subscriptions, &copied)
+	}
+	return subscriptions, nil
+}
+func (s *Store) RemoveWebhookSubscription(ctx context.Context, subscriptionId *uuid.UUID) error {
+	const op = "memstore.RemoveWebhookSubscription"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := slices.IndexFunc(s.subscriptions, func(subscription *entity.WebhookSubscription) bool {
+		return *subscription.SubscriptionId == *subscriptionId
+	})
+	if index == -1 {
+		return errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	s.subscriptions = slices.Delete(s.subscriptions, index, index+1)
+	//каскадное удаление доставок и попыток
+	removed := map[uuid.UUID]bool{}
+	s.deliveries = slices.DeleteFunc(s.deliveries, func(delivery *webhookDelivery) bool {
+		if *delivery.SubscriptionId == *subscriptionId {
+			removed[*delivery.DeliveryId] = true
+			return true
+		}
+		return false
+	})
+	s.attempts = slices.DeleteFunc(s.attempts, func(attempt *webhookDeliveryAttempt) bool {
+		return removed[attempt.deliveryId]
+	})
+	return nil
+}
+func (s *Store) AddWebhookDeliveries(ctx context.Context, dto *dto.AddWebhookDeliveries) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	now := time.Now()
+	for _, subscription := range s.subscriptions {
+		if !slices.Contains(subscription.EventTypes, dto.EventType) || s.hasDelivery(subscription.SubscriptionId, dto.EventId) {
+			continue
+		}
+		deliveryId, subscriptionId, eventId := uuid.New(), *subscription.SubscriptionId, *dto.EventId
+		s.deliveries = append(s.deliveries, &webhookDelivery{WebhookDelivery: entity.WebhookDelivery{
+			DeliveryId:     &deliveryId,
+			SubscriptionId: &subscriptionId,
+			EventId:        &eventId,
+			EventType:      dto.EventType,
+			Payload:        slices.Clone(dto.Payload),
+			Status:         entity.WebhookDeliveryStatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}})
+		count++
+	}
+	return count, nil
+}
+
+// hasDelivery - аналог ограничения уникальности (subscription_id, event_id): повторная публикация
+// события не создает доставку еще раз
+func (s *Store) hasDelivery(subscriptionId *uuid.UUID, eventId *uuid.UUID) bool {
+	return slices.ContainsFunc(s.deliveries, func(delivery *webhookDelivery) bool {
+		return *delivery.SubscriptionId == *subscriptionId && *delivery.EventId == *eventId
+	})
+}
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, dto *dto.ClaimWebhookDeliveries) ([]*entity.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := []*entity.WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if len(deliveries) == dto.Limit {
+			break
+		}
+		if delivery.Status != entity.WebhookDeliveryStatusPending || delivery.NextAttemptAt.After(dto.Now) || !unlocked(delivery.lockedUntil, dto.Now) {
+			continue
+		}
+		lockedUntil := dto.LockedUntil
+		delivery.lockedUntil = &lockedUntil
+		deliveries = append(deliveries, s.copyDelivery(delivery))
+	}
+	return deliveries, nil
+}
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, dto *dto.UpdateWebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, delivery := range s.deliveries {
+		if *delivery.DeliveryId == *dto.DeliveryId {
+			delivery.Status = dto.Status
+			delivery.Attempts = dto.Attempts
+			delivery.NextAttemptAt = dto.NextAttemptAt
+			delivery.LastStatusCode = dto.LastStatusCode
+			delivery.LastError = dto.LastError
+			delivery.DeliveredAt = copyTime(dto.DeliveredAt)
+			delivery.lockedUntil = nil
+		}
+	}
+	return nil
+}
+func (s *Store) AddWebhookDeliveryAttempt(ctx context.Context, dto *dto.AddWebhookDeliveryAttempt) error {
+	const op = "memstore.AddWebhookDeliveryAttempt"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//нарушение внешнего ключа - внутренняя ошибка, как в internal/store
+	if !slices.ContainsFunc(s.deliveries, func(delivery *webhookDelivery) bool {
+		return *delivery.DeliveryId == *dto.DeliveryId
+	}) {
+		return errors.Wrap(repository.ErrInternalServerError, op)
+	}
+	s.attempts = append(s.attempts, &webhookDeliveryAttempt{
+		attemptId:  uuid.New(),
+		deliveryId: *dto.DeliveryId,
+		statusCode: dto.StatusCode,
+		error:      dto.Error,
+		createdAt:  time.Now(),
+	})
+	return nil
+}
+func (s *Store) GetWebhookDeliveries(ctx context.Context, dto *dto.GetWebhookDeliveries) ([]*entity.WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deliveries := []*entity.WebhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < dto.Limit; i-- {
+		if dto.SubscriptionId == nil || *s.deliveries[i].SubscriptionId == *dto.SubscriptionId {
+			deliveries = append(deliveries, s.copyDelivery(s.deliveries[i]))
+		}
+	}
+	return deliveries, nil
+}
+func (s *Store) ReplayWebhookDelivery(ctx context.Context, deliveryId *uuid.UUID, now time.Time) error {
+	const op = "memstore.ReplayWebhookDelivery"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, delivery := range s.deliveries {
+		if *delivery.DeliveryId == *deliveryId {
+			delivery.Status = entity.WebhookDeliveryStatusPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = now
+			delivery.DeliveredAt = nil
+			delivery.lockedUntil = nil
+			return nil
+		}
+	}
+	return errors.Wrap(repository.ErrRecordNotFound, op)
+}
+
+func (s *Store) GetJobRun(ctx context.Context, name string) (*entity.JobRun, error) {
+	const op = "memstore.GetJobRun"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobRun, ok := s.jobRuns[name]
+	if !ok {
+		return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+	}
+	copied := *jobRun
+	return &copied, nil
+}
+func (s *Store) SaveJobRun(ctx context.Context, dto *dto.SaveJobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//длительность хранится с точностью до миллисекунд, как в internal/store
+	s.jobRuns[dto.Name] = &entity.JobRun{
+		Name:         dto.Name,
+		Instance:     dto.Instance,
+		StartedAt:    dto.StartedAt,
+		Duration:     dto.Duration.Truncate(time.Millisecond),
+		Outcome:      dto.Outcome,
+		Error:        dto.Error,
+		RowsAffected: dto.RowsAffected,
+	}
+	return nil
+}
+
+// copyDelivery копирует доставку и заполняет Url и Secret из подписки
+func (s *Store) copyDelivery(delivery *webhookDelivery) *entity.WebhookDelivery {
+	copied := delivery.WebhookDelivery
+	copied.Payload = slices.Clone(delivery.Payload)
+	copied.DeliveredAt = copyTime(delivery.DeliveredAt)
+	for _, subscription := range s.subscriptions {
+		if *subscription.SubscriptionId == *delivery.SubscriptionId {
+			copied.Url = subscription.Url
+			copied.Secret = subscription.Secret
+		}
+	}
+	return &copied
+}
+func unlocked(lockedUntil *time.Time, now time.Time) bool {
+	return lockedUntil == nil || lockedUntil.Before(now)
+}
+func copyUser(user *entity.User) *entity.User {
+	copied := *user
+	return &copied
+}
+func copyRefreshToken(refreshToken *entity.RefreshToken) *entity.RefreshToken {
+	copied := *refreshToken
+	copied.RevokedAt = copyTime(refreshToken.RevokedAt)
+	return &copied
+}
+func copyUuid(id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	copied := *id
+	return &copied
+}
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -0,0 +1,13 @@
+package memstore
+
+import (
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		return New()
+	})
+}
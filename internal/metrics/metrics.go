@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"skillsRockGRPC/internal/config"
+
+	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth"
+
+const (
+	TokenTypeAccess        = "access"
+	TokenTypeRefresh       = "refresh"
+	TokenTypeExchange      = "exchange"
+	TokenTypeImpersonation = "impersonation"
+)
+
+// Бизнес метрики сервиса. Обновляются из service, scheduler и purge, публикуются реестром Metrics
+var (
+	LoginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Number of login attempts by outcome.",
+	}, []string{"outcome"})
+	TokensIssuedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Number of issued tokens by type.",
+	}, []string{"type"})
+	RefreshTokenReuseTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_token_reuse_total",
+		Help:      "Number of detected reuses of revoked refresh tokens.",
+	})
+	RefreshTokensRemovedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_tokens_removed_total",
+		Help:      "Number of expired and revoked refresh tokens removed by the scheduler.",
+	})
+	PurgeRowsDeletedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purge_rows_deleted_total",
+		Help:      "Number of rows deleted by batched purge by target.",
+	}, []string{"target"})
+	PurgeBatchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "purge_batch_duration_seconds",
+		Help:      "Duration of a single purge batch delete by target.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"target"})
+)
+
+type Metrics struct {
+	lg          *slog.Logger
+	registry    *prometheus.Registry
+	grpcMetrics *grpcprom.ServerMetrics
+	httpServer  *http.Server
+	cfg         *config.Metrics
+}
+
+func New(lg *slog.Logger, cfg *config.Metrics) *Metrics {
+	registry := prometheus.NewRegistry()
+	grpcMetrics := grpcprom.NewServerMetrics(grpcprom.WithServerHandlingTimeHistogram())
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		grpcMetrics,
+		LoginsTotal,
+		TokensIssuedTotal,
+		RefreshTokenReuseTotal,
+		RefreshTokensRemovedTotal,
+		PurgeRowsDeletedTotal,
+		PurgeBatchDuration,
+	)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+
+	return &Metrics{
+		lg:          lg,
+		registry:    registry,
+		grpcMetrics: grpcMetrics,
+		httpServer: &http.Server{
+			Addr:    cfg.Addr,
+			Handler: mux,
+		},
+		cfg: cfg,
+	}
+}
+
+// GRPCServerMetrics - интерцептор и счетчики вызовов gRPC методов
+func (m *Metrics) GRPCServerMetrics() *grpcprom.ServerMetrics {
+	return m.grpcMetrics
+}
+
+// MustRegister добавляет сборщики метрик других компонентов
+func (m *Metrics) MustRegister(collectors ...prometheus.Collector) {
+	m.registry.MustRegister(collectors...)
+}
+
+// Start открывает адрес cfg.Addr и запускает сервер метрик
+func (m *Metrics) Start() error {
+	listener, err := net.Listen("tcp", m.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	m.lg.Info("METRICS server start", slog.String("addr", listener.Addr().String()))
+	go func() {
+		if err := m.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			m.lg.Error("METRICS server error", slog.Any("error", err))
+		}
+	}()
+	return nil
+}
+func (m *Metrics) Stop(ctx context.Context) error {
+	if err := m.httpServer.Shutdown(ctx); err != nil {
+		m.httpServer.Close()
+		m.lg.Error("METRICS server error", slog.Any("error", err))
+		return err
+	}
+	m.lg.Info("METRICS server stop")
+	return nil
+}
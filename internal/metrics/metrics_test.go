@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"skillsRockGRPC/internal/config"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// healthServer отвечает ошибкой Unavailable для сервиса "down"
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (s *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if req.Service == "down" {
+		return nil, status.Error(codes.Unavailable, "down")
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func TestGRPCServerMetrics(t *testing.T) {
+	mt := New(slog.New(slog.DiscardHandler), &config.Metrics{})
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(mt.GRPCServerMetrics().UnaryServerInterceptor()))
+	grpc_health_v1.RegisterHealthServer(server, &healthServer{})
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+	for _, service := range []string{"", "", "down"} {
+		client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+	}
+
+	//счетчики вызовов по методу и коду ответа
+	want := `
+# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_code="OK",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 2
+grpc_server_handled_total{grpc_code="Unavailable",grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 1
+# HELP grpc_server_started_total Total number of RPCs started on the server.
+# TYPE grpc_server_started_total counter
+grpc_server_started_total{grpc_method="Check",grpc_service="grpc.health.v1.Health",grpc_type="unary"} 3
+`
+	if err := testutil.CollectAndCompare(mt.GRPCServerMetrics(), strings.NewReader(want), "grpc_server_handled_total", "grpc_server_started_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	//гистограмма времени обработки учитывает каждый вызов
+	families, err := mt.registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	var count uint64
+	for _, family := range families {
+		if family.GetName() != "grpc_server_handling_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			count += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if count != 3 {
+		t.Fatalf("grpc_server_handling_seconds sample count = %d, want 3", count)
+	}
+}
+
+func TestPoolCollector(t *testing.T) {
+	want := `
+# HELP auth_store_pool_acquired_conns Number of currently acquired connections.
+# TYPE auth_store_pool_acquired_conns gauge
+auth_store_pool_acquired_conns 0
+# HELP auth_store_pool_max_conns Maximum size of the pool.
+# TYPE auth_store_pool_max_conns gauge
+auth_store_pool_max_conns 4
+# HELP auth_store_pool_acquire_total Number of successful acquires from the pool.
+# TYPE auth_store_pool_acquire_total counter
+auth_store_pool_acquire_total 0
+`
+	//пул не открывает соединений до первого запроса
+	pool, err := pgxpool.New(context.Background(), "postgres://auth@127.0.0.1:1/auth?pool_max_conns=4")
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	defer pool.Close()
+	collector := NewPoolCollector(pool.Stat)
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "auth_store_pool_acquired_conns", "auth_store_pool_max_conns", "auth_store_pool_acquire_total"); err != nil {
+		t.Fatal(err)
+	}
+	if count := testutil.CollectAndCount(collector); count != 10 {
+		t.Fatalf("pool collector exposes %d metrics, want 10", count)
+	}
+}
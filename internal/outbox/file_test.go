@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+func newOutboxEvent(eventType string, payload string) *entity.OutboxEvent {
+	outboxId := uuid.New()
+	return &entity.OutboxEvent{
+		OutboxId:  &outboxId,
+		EventType: eventType,
+		Payload:   json.RawMessage(payload),
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	publisher := NewFilePublisher(path)
+	outboxEvents := []*entity.OutboxEvent{
+		newOutboxEvent(entity.EventUserRegistered, `{"login":"alice"}`),
+		newOutboxEvent(entity.EventUserDeleted, `{"login":"bob"}`),
+	}
+	for _, outboxEvent := range outboxEvents {
+		if err := publisher.Publish(context.Background(), outboxEvent); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	//события дописываются в файл по одному в строке
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var messages []Message
+	for scanner.Scan() {
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		messages = append(messages, message)
+	}
+	if len(messages) != len(outboxEvents) {
+		t.Fatalf("file has %d messages, want %d", len(messages), len(outboxEvents))
+	}
+	for i, message := range messages {
+		outboxEvent := outboxEvents[i]
+		if message.Id != outboxEvent.OutboxId.String() || message.Type != outboxEvent.EventType || !message.CreatedAt.Equal(outboxEvent.CreatedAt) || string(message.Data) != string(outboxEvent.Payload) {
+			t.Fatalf("message %d = %+v, want event %+v", i, message, outboxEvent)
+		}
+	}
+
+	if err := NewFilePublisher(filepath.Join(t.TempDir(), "missing", "outbox.jsonl")).Publish(context.Background(), outboxEvents[0]); err == nil {
+		t.Fatal("Publish to missing directory: no error")
+	}
+}
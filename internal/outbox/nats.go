@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"skillsRockGRPC/internal/entity"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NatsPublisher публикует события в JetStream в тему <subject>.<тип события>. Тему должен принимать
+// поток JetStream: событие считается отправленным только после подтверждения записи в поток, id события
+// передается как Nats-Msg-Id, и поток отбрасывает повторы в окне дедупликации
+type NatsPublisher struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	subject string
+}
+
+func NewNatsPublisher(url string, subject string) (*NatsPublisher, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NatsPublisher{
+		conn:    conn,
+		js:      js,
+		subject: subject,
+	}, nil
+}
+
+func (n *NatsPublisher) Publish(ctx context.Context, outboxEvent *entity.OutboxEvent) error {
+	data, err := json.Marshal(NewMessage(outboxEvent))
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(n.subject + "." + outboxEvent.EventType)
+	msg.Data = data
+	//без потока для темы сервер не подтверждает запись, и событие будет отправлено повторно
+	_, err = n.js.PublishMsg(ctx, msg, jetstream.WithMsgID(outboxEvent.OutboxId.String()))
+	return err
+}
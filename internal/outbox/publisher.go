@@ -0,0 +1,69 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, outboxEvent *entity.OutboxEvent) error
+}
+
+// Message - формат сообщения, которое получают подписчики
+type Message struct {
+	Id        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func NewMessage(outboxEvent *entity.OutboxEvent) *Message {
+	return &Message{
+		Id:        outboxEvent.OutboxId.String(),
+		Type:      outboxEvent.EventType,
+		CreatedAt: outboxEvent.CreatedAt,
+		Data:      outboxEvent.Payload,
+	}
+}
+
+// MultiPublisher публикует событие всем издателям. Ошибка любого из них приводит к повторной
+// отправке события всем издателям
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, outboxEvent *entity.OutboxEvent) error {
+	var errs []error
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, outboxEvent); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MustNewPublisher создает издателей из cfg.Publishers. sign подписывает запросы издателя webhook
+func MustNewPublisher(cfg *config.Outbox, sign SignFunc) Publisher {
+	publishers := MultiPublisher{}
+	for _, name := range cfg.Publishers {
+		switch name {
+		case "file":
+			publishers = append(publishers, NewFilePublisher(cfg.FilePath))
+		case "webhook":
+			publishers = append(publishers, NewWebhookPublisher(cfg.WebhookUrl, string(cfg.WebhookSecret), sign))
+		case "nats":
+			publisher, err := NewNatsPublisher(cfg.NatsUrl, cfg.NatsSubject)
+			if err != nil {
+				log.Fatalf("OUTBOX: %v\n", err)
+			}
+			publishers = append(publishers, publisher)
+		default:
+			log.Fatalf("OUTBOX: unknown publisher '%s'\n", name)
+		}
+	}
+	return publishers
+}
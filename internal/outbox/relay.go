@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+)
+
+// Relay доставляет события из outbox издателю. Доставка "не менее одного раза": событие помечается
+// отправленным только после успешной публикации, получатели должны быть идемпотентны по id события
+type Relay struct {
+	store     repository.Repository
+	publisher Publisher
+	lg        *slog.Logger
+	cfg       *config.Outbox
+}
+
+func New(store repository.Repository, publisher Publisher, lg *slog.Logger, cfg *config.Outbox) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		lg:        lg,
+		cfg:       cfg,
+	}
+}
+
+// Relay публикует одну пачку готовых к отправке событий и возвращает количество опубликованных
+func (r *Relay) Relay(ctx context.Context, now time.Time) (int64, error) {
+	outboxEvents, err := r.store.ClaimOutboxEvents(ctx, &dto.ClaimOutboxEvents{
+		Now:         now,
+		LockedUntil: now.Add(r.cfg.LockTimeout),
+		Limit:       r.cfg.BatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, outboxEvent := range outboxEvents {
+		publishCtx, cancel := context.WithTimeout(ctx, r.cfg.PublishTimeout)
+		err := r.publisher.Publish(publishCtx, outboxEvent)
+		cancel()
+		if err != nil {
+			if err := r.fail(ctx, outboxEvent, err); err != nil {
+				return count, err
+			}
+			continue
+		}
+		sentAt := time.Now()
+		if err := r.store.UpdateOutboxEvent(ctx, &dto.UpdateOutboxEvent{
+			OutboxId:      outboxEvent.OutboxId,
+			Status:        entity.OutboxStatusSent,
+			Attempts:      outboxEvent.Attempts + 1,
+			NextAttemptAt: outboxEvent.NextAttemptAt,
+			SentAt:        &sentAt,
+		}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// fail планирует повторную попытку с экспоненциальной задержкой. После MaxAttempts попыток событие
+// переводится в состояние dead и больше не отправляется
+func (r *Relay) fail(ctx context.Context, outboxEvent *entity.OutboxEvent, publishErr error) error {
+	attempts := outboxEvent.Attempts + 1
+	status := entity.OutboxStatusPending
+	if attempts >= r.cfg.MaxAttempts {
+		status = entity.OutboxStatusDead
+		r.lg.Error("OUTBOX: event moved to dead letter", slog.String("outboxId", outboxEvent.OutboxId.String()), slog.String("eventType", outboxEvent.EventType), slog.Any("error", publishErr))
+	} else {
+		r.lg.Warn("OUTBOX: event publish error", slog.String("outboxId", outboxEvent.OutboxId.String()), slog.Int("attempts", attempts), slog.Any("error", publishErr))
+	}
+	return r.store.UpdateOutboxEvent(ctx, &dto.UpdateOutboxEvent{
+		OutboxId:      outboxEvent.OutboxId,
+		Status:        status,
+		Attempts:      attempts,
+		NextAttemptAt: time.Now().Add(Backoff(attempts, r.cfg.BackoffBase, r.cfg.BackoffMax)),
+		LastError:     publishErr.Error(),
+	})
+}
+
+// Backoff возвращает задержку перед попыткой attempts+1: base*2^(attempts-1), но не больше max
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return min(delay, max)
+}
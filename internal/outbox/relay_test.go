@@ -0,0 +1,204 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/memstore"
+	"skillsRockGRPC/internal/repository/dto"
+
+	"github.com/google/uuid"
+)
+
+// fakePublisher запоминает опубликованные события и возвращает ошибку для событий из fail
+type fakePublisher struct {
+	mu        sync.Mutex
+	published []*entity.OutboxEvent
+	fail      map[uuid.UUID]bool
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, outboxEvent *entity.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, outboxEvent)
+	if p.fail[*outboxEvent.OutboxId] {
+		return errors.New("publish failed")
+	}
+	return nil
+}
+func (p *fakePublisher) count(outboxId *uuid.UUID) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	count := 0
+	for _, outboxEvent := range p.published {
+		if *outboxEvent.OutboxId == *outboxId {
+			count++
+		}
+	}
+	return count
+}
+
+// recordingStore запоминает изменения событий outbox
+type recordingStore struct {
+	*memstore.Store
+	updates []*dto.UpdateOutboxEvent
+}
+
+func (s *recordingStore) UpdateOutboxEvent(ctx context.Context, dto *dto.UpdateOutboxEvent) error {
+	s.updates = append(s.updates, dto)
+	return s.Store.UpdateOutboxEvent(ctx, dto)
+}
+func (s *recordingStore) last(outboxId *uuid.UUID) *dto.UpdateOutboxEvent {
+	for i := len(s.updates) - 1; i >= 0; i-- {
+		if *s.updates[i].OutboxId == *outboxId {
+			return s.updates[i]
+		}
+	}
+	return nil
+}
+
+// newTestRelay создает Relay над хранилищем в памяти с count событиями user.registered
+func newTestRelay(t *testing.T, publisher Publisher, count int) (*Relay, *recordingStore, []*entity.OutboxEvent) {
+	t.Helper()
+	store := &recordingStore{Store: memstore.New()}
+	for i := range count {
+		if _, err := store.AddUser(context.Background(), &dto.AddUser{Login: "user" + string(rune('a'+i)), Password: "hash"}); err != nil {
+			t.Fatalf("AddUser: %v", err)
+		}
+	}
+	outboxEvents, err := store.ClaimOutboxEvents(context.Background(), &dto.ClaimOutboxEvents{Now: time.Now(), Limit: count})
+	if err != nil || len(outboxEvents) != count {
+		t.Fatalf("ClaimOutboxEvents = %d events, %v", len(outboxEvents), err)
+	}
+	relay := New(store, publisher, slog.New(slog.DiscardHandler), &config.Outbox{
+		BatchSize:      10,
+		MaxAttempts:    3,
+		BackoffBase:    time.Second,
+		BackoffMax:     4 * time.Second,
+		LockTimeout:    time.Minute,
+		PublishTimeout: time.Second,
+	})
+	return relay, store, outboxEvents
+}
+
+func TestRelay(t *testing.T) {
+	publisher := &fakePublisher{fail: map[uuid.UUID]bool{}}
+	relay, store, outboxEvents := newTestRelay(t, publisher, 3)
+	failing := outboxEvents[1]
+	publisher.fail[*failing.OutboxId] = true
+
+	now := time.Now()
+	count, err := relay.Relay(context.Background(), now)
+	if err != nil || count != 2 {
+		t.Fatalf("Relay = %d, %v", count, err)
+	}
+	for _, outboxEvent := range []*entity.OutboxEvent{outboxEvents[0], outboxEvents[2]} {
+		update := store.last(outboxEvent.OutboxId)
+		if update.Status != entity.OutboxStatusSent || update.Attempts != 1 || update.SentAt == nil || publisher.count(outboxEvent.OutboxId) != 1 {
+			t.Fatalf("sent event update = %+v", update)
+		}
+	}
+
+	//ошибка публикации планирует повтор с экспоненциальной задержкой
+	for attempt, delay := range []time.Duration{time.Second, 2 * time.Second} {
+		update := store.last(failing.OutboxId)
+		if update.Status != entity.OutboxStatusPending || update.Attempts != attempt+1 || update.LastError != "publish failed" || update.SentAt != nil {
+			t.Fatalf("failed event update = %+v", update)
+		}
+		if wait := time.Until(update.NextAttemptAt); wait > delay || wait < delay-time.Second {
+			t.Fatalf("attempt %d: next attempt in %v, want %v", attempt+1, wait, delay)
+		}
+		//до следующей попытки событие не отправляется
+		if count, err := relay.Relay(context.Background(), update.NextAttemptAt.Add(-time.Millisecond)); err != nil || count != 0 || publisher.count(failing.OutboxId) != attempt+1 {
+			t.Fatalf("Relay before next attempt = %d, %v", count, err)
+		}
+		if count, err := relay.Relay(context.Background(), update.NextAttemptAt); err != nil || count != 0 || publisher.count(failing.OutboxId) != attempt+2 {
+			t.Fatalf("Relay on next attempt = %d, %v", count, err)
+		}
+	}
+
+	//после MaxAttempts попыток событие переводится в dead и больше не отправляется
+	if update := store.last(failing.OutboxId); update.Status != entity.OutboxStatusDead || update.Attempts != 3 {
+		t.Fatalf("dead event update = %+v", update)
+	}
+	delete(publisher.fail, *failing.OutboxId)
+	if count, err := relay.Relay(context.Background(), now.Add(time.Hour)); err != nil || count != 0 || publisher.count(failing.OutboxId) != 3 {
+		t.Fatalf("Relay of dead event = %d, %v", count, err)
+	}
+}
+
+func TestRelayBatchSize(t *testing.T) {
+	publisher := &fakePublisher{}
+	relay, _, outboxEvents := newTestRelay(t, publisher, 3)
+	relay.cfg.BatchSize = 2
+
+	now := time.Now()
+	if count, err := relay.Relay(context.Background(), now); err != nil || count != 2 {
+		t.Fatalf("first Relay = %d, %v", count, err)
+	}
+	if count, err := relay.Relay(context.Background(), now); err != nil || count != 1 || publisher.count(outboxEvents[2].OutboxId) != 1 {
+		t.Fatalf("second Relay = %d, %v", count, err)
+	}
+	if count, err := relay.Relay(context.Background(), now); err != nil || count != 0 || len(publisher.published) != 3 {
+		t.Fatalf("Relay without pending events = %d, %v", count, err)
+	}
+}
+
+func TestMultiPublisher(t *testing.T) {
+	ok, failing := &fakePublisher{}, &fakePublisher{fail: map[uuid.UUID]bool{}}
+	relay, store, outboxEvents := newTestRelay(t, MultiPublisher{failing, ok}, 1)
+	outboxEvent := outboxEvents[0]
+	failing.fail[*outboxEvent.OutboxId] = true
+
+	//ошибка одного издателя не мешает публикации остальным, но событие отправляется повторно всем
+	now := time.Now()
+	if count, err := relay.Relay(context.Background(), now); err != nil || count != 0 {
+		t.Fatalf("Relay = %d, %v", count, err)
+	}
+	if ok.count(outboxEvent.OutboxId) != 1 || failing.count(outboxEvent.OutboxId) != 1 {
+		t.Fatal("event is not published to every publisher")
+	}
+	update := store.last(outboxEvent.OutboxId)
+	if update.Status != entity.OutboxStatusPending || !strings.Contains(update.LastError, "publish failed") {
+		t.Fatalf("event update = %+v", update)
+	}
+	delete(failing.fail, *outboxEvent.OutboxId)
+	if count, err := relay.Relay(context.Background(), update.NextAttemptAt); err != nil || count != 1 {
+		t.Fatalf("Relay retry = %d, %v", count, err)
+	}
+	if ok.count(outboxEvent.OutboxId) != 2 || failing.count(outboxEvent.OutboxId) != 2 {
+		t.Fatal("event is not republished to every publisher")
+	}
+
+	if err := (MultiPublisher{}).Publish(context.Background(), outboxEvent); err != nil {
+		t.Fatalf("empty MultiPublisher: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 3, want: 4 * time.Second},
+		{attempts: 4, want: 5 * time.Second},
+		{attempts: 100, want: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts, time.Second, 5*time.Second); got != tt.want {
+			t.Fatalf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+	if got := Backoff(1, time.Minute, time.Second); got != time.Second {
+		t.Fatalf("Backoff with base over max = %v", got)
+	}
+}
@@ -0,0 +1,62 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"skillsRockGRPC/internal/entity"
+)
+
+// SignFunc возвращает значение заголовка SignatureHeader для тела запроса, реализация - webhook.Sign
+type SignFunc func(secret string, timestamp time.Time, body []byte) string
+
+// SignatureHeader - заголовок подписи, формат описан в webhook.SignatureHeader
+const SignatureHeader = "X-Auth-Signature"
+
+// WebhookPublisher отправляет события POST запросом на заданный адрес. Успешным считается ответ 2xx.
+// Непустой secret добавляет подпись тела запроса в заголовок SignatureHeader
+type WebhookPublisher struct {
+	url    string
+	secret string
+	sign   SignFunc
+	client *http.Client
+}
+
+func NewWebhookPublisher(url string, secret string, sign SignFunc) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		secret: secret,
+		sign:   sign,
+		client: &http.Client{},
+	}
+}
+
+func (w *WebhookPublisher) Publish(ctx context.Context, outboxEvent *entity.OutboxEvent) error {
+	data, err := json.Marshal(NewMessage(outboxEvent))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Id", outboxEvent.OutboxId.String())
+	req.Header.Set("X-Event-Type", outboxEvent.EventType)
+	if w.secret != "" {
+		req.Header.Set(SignatureHeader, w.sign(w.secret, time.Now(), data))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/entity"
+)
+
+// testSign подписывает тело запроса ключом без криптографии, чтобы проверить передаваемые данные
+func testSign(secret string, timestamp time.Time, body []byte) string {
+	return secret + ":" + string(body)
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	chRequest := make(chan request, 1)
+	statusCode := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		chRequest <- request{header: r.Header, body: body}
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+	outboxEvent := newOutboxEvent(entity.EventUserRegistered, `{"login":"alice"}`)
+
+	if err := NewWebhookPublisher(server.URL, "outbox-secret", testSign).Publish(context.Background(), outboxEvent); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	req := <-chRequest
+	var message Message
+	if err := json.Unmarshal(req.body, &message); err != nil || message.Id != outboxEvent.OutboxId.String() || message.Type != outboxEvent.EventType {
+		t.Fatalf("request body = %s, %v", req.body, err)
+	}
+	if req.header.Get("X-Event-Id") != outboxEvent.OutboxId.String() || req.header.Get("X-Event-Type") != outboxEvent.EventType {
+		t.Fatalf("event headers = %v", req.header)
+	}
+	if got := req.header.Get(SignatureHeader); got != "outbox-secret:"+string(req.body) {
+		t.Fatalf("signature = %q", got)
+	}
+
+	//без ключа запрос не подписывается
+	if err := NewWebhookPublisher(server.URL, "", testSign).Publish(context.Background(), outboxEvent); err != nil {
+		t.Fatalf("Publish without secret: %v", err)
+	}
+	if req := <-chRequest; req.header.Get(SignatureHeader) != "" {
+		t.Fatalf("unsigned request has signature %q", req.header.Get(SignatureHeader))
+	}
+
+	//ответ не 2xx - ошибка публикации
+	statusCode = http.StatusInternalServerError
+	if err := NewWebhookPublisher(server.URL, "outbox-secret", testSign).Publish(context.Background(), outboxEvent); err == nil {
+		t.Fatal("Publish with status 500: no error")
+	}
+	<-chRequest
+}
@@ -0,0 +1,49 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Длина префикса хеша SHA-1, по которому выбирается файл базы
+const prefixLength = 5
+
+// Breached проверяет пароль по локальной базе утекших паролей в формате k-anonymity: каталог с файлами
+// <первые 5 символов SHA-1>.txt, строки которых содержат оставшиеся символы хеша и число утечек через
+// двоеточие, как в ответах api.pwnedpasswords.com/range. Читается только файл с префиксом хеша пароля
+type Breached struct {
+	dir string
+}
+
+// NewBreached. Пустой dir отключает проверку
+func NewBreached(dir string) *Breached {
+	return &Breached{dir: dir}
+}
+func (b *Breached) Contains(password string) (bool, error) {
+	if b.dir == "" {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	file, err := os.Open(filepath.Join(b.dir, hash[:prefixLength]+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(suffix, hash[prefixLength:]) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
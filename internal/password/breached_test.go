@@ -0,0 +1,56 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestBreached(t *testing.T) {
+	dir := t.TempDir()
+	writeRange(t, dir, "correct-horse-1", "password")
+	//файл того же префикса с другим хешем и хешем в нижнем регистре, как в ответах pwnedpasswords
+	lower := sha1Hex("letmein-123")
+	path := filepath.Join(dir, lower[:prefixLength]+".txt")
+	if err := os.WriteFile(path, []byte("0000000000000000000000000000000000A:1\n"+strings.ToLower(lower[prefixLength:])+":7\n"), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	breached := NewBreached(dir)
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "correct-horse-1", want: true},
+		{password: "password", want: true},
+		{password: "letmein-123", want: true},
+		{password: "battery-staple-2", want: false},
+		{password: "", want: false},
+	}
+	for _, tt := range tests {
+		got, err := breached.Contains(tt.password)
+		if err != nil || got != tt.want {
+			t.Fatalf("Contains(%q) = %v, %v, want %v", tt.password, got, err, tt.want)
+		}
+	}
+
+	//пустой каталог отключает проверку
+	if got, err := NewBreached("").Contains("password"); err != nil || got {
+		t.Fatalf("Contains without base = %v, %v", got, err)
+	}
+	//ошибка чтения базы, кроме отсутствия файла, возвращается
+	if err := os.Mkdir(filepath.Join(dir, sha1Hex("battery-staple-2")[:prefixLength]+".txt"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if _, err := breached.Contains("battery-staple-2"); err == nil {
+		t.Fatal("Contains with unreadable range file: no error")
+	}
+}
@@ -0,0 +1,88 @@
+package password
+
+import (
+	"fmt"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/pkg/secure"
+	"skillsRockGRPC/pkg/servererrors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy - политика паролей: длина, классы символов, запрет логина в пароле, история и проверка
+// по локальной базе утекших паролей
+type Policy struct {
+	cfg      *config.Password
+	breached *Breached
+}
+
+func New(cfg *config.Password) *Policy {
+	return &Policy{
+		cfg:      cfg,
+		breached: NewBreached(cfg.BreachedPath),
+	}
+}
+
+// HistorySize - количество последних паролей, которые нельзя использовать повторно
+func (p *Policy) HistorySize() int {
+	return p.cfg.HistorySize
+}
+
+// Validate возвращает нарушения политики для пароля в поле field. Ошибка возвращается только при
+// недоступности базы утекших паролей
+func (p *Policy) Validate(field string, login string, password string) ([]*servererrors.FieldViolation, error) {
+	var violations []*servererrors.FieldViolation
+	add := func(description string) {
+		violations = append(violations, &servererrors.FieldViolation{Field: field, Err: fmt.Errorf("%s %s", field, description)})
+	}
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		add(fmt.Sprintf("length must be at least %d characters", p.cfg.MinLength))
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		add(fmt.Sprintf("length must be at most %d characters", p.cfg.MaxLength))
+	}
+	if p.cfg.RequireUpper && !strings.ContainsFunc(password, unicode.IsUpper) {
+		add("must contain an uppercase letter")
+	}
+	if p.cfg.RequireLower && !strings.ContainsFunc(password, unicode.IsLower) {
+		add("must contain a lowercase letter")
+	}
+	if p.cfg.RequireDigit && !strings.ContainsFunc(password, unicode.IsDigit) {
+		add("must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !strings.ContainsFunc(password, isSymbol) {
+		add("must contain a symbol")
+	}
+	if p.cfg.ForbidLogin && login != "" && strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		add("must not contain the login")
+	}
+	if len(violations) != 0 {
+		return violations, nil
+	}
+	breached, err := p.breached.Contains(password)
+	if err != nil {
+		return nil, err
+	}
+	if breached {
+		add("has appeared in a data breach")
+	}
+	return violations, nil
+}
+
+// CheckHistory возвращает нарушение, если пароль совпадает с одним из хешей history
+func (p *Policy) CheckHistory(field string, password string, history []string) *servererrors.FieldViolation {
+	for _, hash := range history {
+		if secure.CheckHash(password, hash) {
+			return &servererrors.FieldViolation{
+				Field: field,
+				Err:   fmt.Errorf("%s must differ from the last %d passwords", field, p.cfg.HistorySize),
+			}
+		}
+	}
+	return nil
+}
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
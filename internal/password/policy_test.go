@@ -0,0 +1,116 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/pkg/secure"
+)
+
+func TestValidate(t *testing.T) {
+	strict := &config.Password{
+		MinLength:     10,
+		MaxLength:     16,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		ForbidLogin:   true,
+	}
+	tests := []struct {
+		name     string
+		cfg      *config.Password
+		login    string
+		password string
+		want     []string
+	}{
+		{name: "valid", cfg: strict, login: "alice", password: "Correct-Horse-1"},
+		{name: "too short", cfg: strict, login: "alice", password: "Ab-1", want: []string{"at least 10"}},
+		{name: "too long", cfg: strict, login: "alice", password: "Correct-Horse-Battery-1", want: []string{"at most 16"}},
+		{name: "length in runes", cfg: strict, login: "alice", password: "Пароль-Ёжика-1"},
+		{name: "no upper", cfg: strict, login: "alice", password: "correct-horse-1", want: []string{"uppercase"}},
+		{name: "no lower", cfg: strict, login: "alice", password: "CORRECT-HORSE-1", want: []string{"lowercase"}},
+		{name: "no digit", cfg: strict, login: "alice", password: "Correct-Horse-X", want: []string{"digit"}},
+		{name: "no symbol", cfg: strict, login: "alice", password: "CorrectHorse12", want: []string{"symbol"}},
+		{name: "contains login", cfg: strict, login: "Alice", password: "My-aLiCe-Pass-1", want: []string{"login"}},
+		{name: "several violations", cfg: strict, login: "alice", password: "alice", want: []string{"at least 10", "uppercase", "digit", "symbol", "login"}},
+		{name: "defaults", cfg: &config.Password{MinLength: 8}, login: "alice", password: "password"},
+		{name: "login allowed", cfg: &config.Password{MinLength: 8}, login: "alice", password: "alice-password"},
+		{name: "no max length", cfg: &config.Password{MinLength: 8}, login: "alice", password: strings.Repeat("x", 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := New(tt.cfg).Validate("password", tt.login, tt.password)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if len(violations) != len(tt.want) {
+				t.Fatalf("Validate = %v, want %v", violations, tt.want)
+			}
+			for i, violation := range violations {
+				if violation.Field != "password" || !strings.Contains(violation.Err.Error(), tt.want[i]) {
+					t.Fatalf("violation %d = %s: %v, want %q", i, violation.Field, violation.Err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateBreached(t *testing.T) {
+	dir := t.TempDir()
+	writeRange(t, dir, "correct-horse-1")
+	policy := New(&config.Password{MinLength: 8, BreachedPath: dir})
+
+	violations, err := policy.Validate("password", "alice", "correct-horse-1")
+	if err != nil || len(violations) != 1 || !strings.Contains(violations[0].Err.Error(), "data breach") {
+		t.Fatalf("Validate(breached) = %v, %v", violations, err)
+	}
+	violations, err = policy.Validate("password", "alice", "battery-staple-2")
+	if err != nil || len(violations) != 0 {
+		t.Fatalf("Validate(not breached) = %v, %v", violations, err)
+	}
+	//пароль, не прошедший правила политики, по базе не проверяется
+	violations, err = policy.Validate("password", "alice", "short")
+	if err != nil || len(violations) != 1 || strings.Contains(violations[0].Err.Error(), "data breach") {
+		t.Fatalf("Validate(short) = %v, %v", violations, err)
+	}
+}
+
+func TestCheckHistory(t *testing.T) {
+	policy := New(&config.Password{HistorySize: 3})
+	history := []string{secure.GetHash("battery-staple-2"), secure.GetHash("correct-horse-1")}
+
+	violation := policy.CheckHistory("newPassword", "correct-horse-1", history)
+	if violation == nil || violation.Field != "newPassword" || !strings.Contains(violation.Err.Error(), "last 3 passwords") {
+		t.Fatalf("CheckHistory(reused) = %v", violation)
+	}
+	if violation := policy.CheckHistory("newPassword", "tr0ub4dor-3", history); violation != nil {
+		t.Fatalf("CheckHistory(new) = %v", violation.Err)
+	}
+	if violation := policy.CheckHistory("newPassword", "correct-horse-1", nil); violation != nil {
+		t.Fatalf("CheckHistory(empty history) = %v", violation.Err)
+	}
+	if policy.HistorySize() != 3 {
+		t.Fatalf("HistorySize = %d", policy.HistorySize())
+	}
+}
+
+// writeRange добавляет хеши паролей в файл базы утекших паролей с их префиксом
+func writeRange(t *testing.T, dir string, passwords ...string) {
+	t.Helper()
+	for _, password := range passwords {
+		hash := sha1Hex(password)
+		path := filepath.Join(dir, hash[:prefixLength]+".txt")
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatalf("open %s: %v", path, err)
+		}
+		if _, err := file.WriteString(hash[prefixLength:] + ":42\r\n"); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		file.Close()
+	}
+}
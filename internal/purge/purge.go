@@ -0,0 +1,95 @@
+package purge
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/metrics"
+	"skillsRockGRPC/internal/repository"
+)
+
+// Цели очистки, метка target метрик purge
+const (
+	TargetExpiredRefreshTokens = "refresh_token_expired"
+	TargetRevokedRefreshTokens = "refresh_token_revoked"
+	TargetAuditEvents          = "audit_event"
+)
+
+// Purger удаляет устаревшие данные пакетами. Каждый пакет - отдельный короткий DELETE, поэтому блокировки
+// не удерживаются на время всей очистки, а пауза между пакетами оставляет хранилище запросам пользователей.
+// Прерванная очистка продолжается при следующем запуске
+type Purger struct {
+	store repository.Repository
+	lg    *slog.Logger
+	cfg   atomic.Pointer[config.Purge]
+}
+
+func MustNew(store repository.Repository, lg *slog.Logger, cfg *config.Purge) *Purger {
+	if cfg.BatchSize <= 0 {
+		log.Fatalf("PURGE: batch size must be positive, got %d\n", cfg.BatchSize)
+	}
+	p := &Purger{
+		store: store,
+		lg:    lg,
+	}
+	p.cfg.Store(cfg)
+	return p
+}
+
+// Reload применяет новые размер пакета, паузу и срок хранения со следующего пакета
+func (p *Purger) Reload(cfg *config.Purge) {
+	p.cfg.Store(cfg)
+}
+
+// RefreshTokens удаляет истекшие refresh токены и отозванные токены старше срока хранения
+func (p *Purger) RefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	expired, err := p.purge(ctx, TargetExpiredRefreshTokens, func(ctx context.Context, limit int) (int64, error) {
+		return p.store.RemoveRefreshTokensByExpirationAt(ctx, now, limit)
+	})
+	metrics.RefreshTokensRemovedTotal.Add(float64(expired))
+	if err != nil {
+		return expired, err
+	}
+	revoked, err := p.purge(ctx, TargetRevokedRefreshTokens, func(ctx context.Context, limit int) (int64, error) {
+		return p.store.RemoveRefreshTokensByRevokedAt(ctx, now.Add(-p.cfg.Load().RevokedTokensRetention), limit)
+	})
+	metrics.RefreshTokensRemovedTotal.Add(float64(revoked))
+	return expired + revoked, err
+}
+
+// AuditEvents удаляет события аудита, созданные раньше before
+func (p *Purger) AuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	return p.purge(ctx, TargetAuditEvents, func(ctx context.Context, limit int) (int64, error) {
+		return p.store.RemoveAuditEventsByCreatedAt(ctx, before, limit)
+	})
+}
+
+// purge вызывает remove, пока он удаляет полные пакеты. Возвращает количество удаленных записей,
+// в том числе при ошибке или отмене ctx
+func (p *Purger) purge(ctx context.Context, target string, remove func(ctx context.Context, limit int) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		cfg := p.cfg.Load()
+		startedAt := time.Now()
+		count, err := remove(ctx, cfg.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		metrics.PurgeBatchDuration.WithLabelValues(target).Observe(time.Since(startedAt).Seconds())
+		metrics.PurgeRowsDeletedTotal.WithLabelValues(target).Add(float64(count))
+		total += count
+		p.lg.DebugContext(ctx, "PURGE: batch is deleted", slog.String("target", target), slog.Int64("rows", count), slog.Int64("total", total))
+		if count < int64(cfg.BatchSize) {
+			return total, nil
+		}
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(cfg.BatchDelay):
+		}
+	}
+}
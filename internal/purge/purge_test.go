@@ -0,0 +1,160 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/memstore"
+	"skillsRockGRPC/internal/metrics"
+	"skillsRockGRPC/internal/repository/dto"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	clientmodel "github.com/prometheus/client_model/go"
+)
+
+// limitStore запоминает limit каждого пакета удаления refresh токенов
+type limitStore struct {
+	*memstore.Store
+	mu     sync.Mutex
+	limits []int
+}
+
+func (s *limitStore) RemoveRefreshTokensByExpirationAt(ctx context.Context, now time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	s.limits = append(s.limits, limit)
+	s.mu.Unlock()
+	return s.Store.RemoveRefreshTokensByExpirationAt(ctx, now, limit)
+}
+
+// addRefreshTokens добавляет count refresh токенов, истекающих в expirationAt, и возвращает их идентификаторы
+func addRefreshTokens(t *testing.T, store *limitStore, count int, expirationAt time.Time) []*uuid.UUID {
+	t.Helper()
+	userId, err := store.AddUser(context.Background(), &dto.AddUser{Login: uuid.NewString(), Password: "hash"})
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	var refreshTokenIds []*uuid.UUID
+	for range count {
+		refreshTokenId := uuid.New()
+		if err := store.AddRefreshTokenWithRefreshTokenId(context.Background(), &dto.AddRefreshTokenWithRefreshTokenId{
+			RefreshTokenId: &refreshTokenId,
+			UserId:         userId,
+			DeviceCode:     "phone",
+			ExpirationAt:   expirationAt,
+		}); err != nil {
+			t.Fatalf("AddRefreshTokenWithRefreshTokenId: %v", err)
+		}
+		refreshTokenIds = append(refreshTokenIds, &refreshTokenId)
+	}
+	return refreshTokenIds
+}
+
+// batches возвращает количество наблюдений purge_batch_duration_seconds по цели
+func batches(t *testing.T, target string) uint64 {
+	t.Helper()
+	var metric clientmodel.Metric
+	if err := metrics.PurgeBatchDuration.WithLabelValues(target).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatalf("purge_batch_duration_seconds: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func newTestPurger(cfg *config.Purge) (*Purger, *limitStore) {
+	store := &limitStore{Store: memstore.New()}
+	return MustNew(store, slog.New(slog.DiscardHandler), cfg), store
+}
+
+func TestRefreshTokensBatches(t *testing.T) {
+	purger, store := newTestPurger(&config.Purge{BatchSize: 2, BatchDelay: 50 * time.Millisecond, RevokedTokensRetention: time.Hour})
+	now := time.Now()
+	addRefreshTokens(t, store, 5, now.Add(-time.Minute))
+	active := addRefreshTokens(t, store, 1, now.Add(time.Hour))
+
+	rowsBefore := testutil.ToFloat64(metrics.PurgeRowsDeletedTotal.WithLabelValues(TargetExpiredRefreshTokens))
+	removedBefore := testutil.ToFloat64(metrics.RefreshTokensRemovedTotal)
+	batchesBefore := batches(t, TargetExpiredRefreshTokens)
+
+	//пять истекших токенов удаляются тремя пакетами с паузой между ними, последний неполный пакет завершает очистку
+	startedAt := time.Now()
+	count, err := purger.RefreshTokens(context.Background(), now)
+	if err != nil || count != 5 {
+		t.Fatalf("RefreshTokens = %d, %v", count, err)
+	}
+	if elapsed := time.Since(startedAt); elapsed < 100*time.Millisecond {
+		t.Fatalf("RefreshTokens took %v, want at least two batch delays", elapsed)
+	}
+	if len(store.limits) != 3 || store.limits[0] != 2 || store.limits[1] != 2 || store.limits[2] != 2 {
+		t.Fatalf("batch limits = %v, want [2 2 2]", store.limits)
+	}
+	if _, err := store.GetRefreshToken(context.Background(), active[0]); err != nil {
+		t.Fatalf("active refresh token: %v", err)
+	}
+
+	//метрики отражают удаленные строки по цели
+	if got := testutil.ToFloat64(metrics.PurgeRowsDeletedTotal.WithLabelValues(TargetExpiredRefreshTokens)) - rowsBefore; got != 5 {
+		t.Fatalf("purge_rows_deleted_total = %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(metrics.RefreshTokensRemovedTotal) - removedBefore; got != 5 {
+		t.Fatalf("refresh_tokens_removed_total = %v, want 5", got)
+	}
+	if got := batches(t, TargetExpiredRefreshTokens) - batchesBefore; got != 3 {
+		t.Fatalf("purge_batch_duration_seconds observed %d batches, want 3", got)
+	}
+}
+
+func TestRefreshTokensRevokedRetention(t *testing.T) {
+	purger, store := newTestPurger(&config.Purge{BatchSize: 10, BatchDelay: time.Millisecond, RevokedTokensRetention: time.Hour})
+	now := time.Now()
+	revoked := addRefreshTokens(t, store, 2, now.Add(24*time.Hour))
+	for _, refreshTokenId := range revoked {
+		if err := store.RevokeRefreshTokenByRefreshTokenId(context.Background(), refreshTokenId); err != nil {
+			t.Fatalf("RevokeRefreshTokenByRefreshTokenId: %v", err)
+		}
+	}
+
+	//отозванные токены хранятся RevokedTokensRetention
+	if count, err := purger.RefreshTokens(context.Background(), now.Add(59*time.Minute)); err != nil || count != 0 {
+		t.Fatalf("RefreshTokens within retention = %d, %v", count, err)
+	}
+	rowsBefore := testutil.ToFloat64(metrics.PurgeRowsDeletedTotal.WithLabelValues(TargetRevokedRefreshTokens))
+	if count, err := purger.RefreshTokens(context.Background(), now.Add(2*time.Hour)); err != nil || count != 2 {
+		t.Fatalf("RefreshTokens after retention = %d, %v", count, err)
+	}
+	if got := testutil.ToFloat64(metrics.PurgeRowsDeletedTotal.WithLabelValues(TargetRevokedRefreshTokens)) - rowsBefore; got != 2 {
+		t.Fatalf("purge_rows_deleted_total = %v, want 2", got)
+	}
+
+	//новый срок хранения применяется при следующем запуске
+	revoked = addRefreshTokens(t, store, 1, now.Add(24*time.Hour))
+	if err := store.RevokeRefreshTokenByRefreshTokenId(context.Background(), revoked[0]); err != nil {
+		t.Fatalf("RevokeRefreshTokenByRefreshTokenId: %v", err)
+	}
+	purger.Reload(&config.Purge{BatchSize: 10, RevokedTokensRetention: 3 * time.Hour})
+	if count, err := purger.RefreshTokens(context.Background(), now.Add(2*time.Hour)); err != nil || count != 0 {
+		t.Fatalf("RefreshTokens within reloaded retention = %d, %v", count, err)
+	}
+}
+
+func TestPurgeCanceled(t *testing.T) {
+	purger, store := newTestPurger(&config.Purge{BatchSize: 2, BatchDelay: time.Hour, RevokedTokensRetention: time.Hour})
+	now := time.Now()
+	addRefreshTokens(t, store, 3, now.Add(-time.Minute))
+
+	//отмена во время паузы между пакетами прерывает очистку, удаленное количество сохраняется
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	count, err := purger.RefreshTokens(ctx, now)
+	if !errors.Is(err, context.DeadlineExceeded) || count != 2 {
+		t.Fatalf("RefreshTokens = %d, %v", count, err)
+	}
+	if count, err := purger.RefreshTokens(context.Background(), now); err != nil || count != 1 {
+		t.Fatalf("RefreshTokens after cancel = %d, %v", count, err)
+	}
+}
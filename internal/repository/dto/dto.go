@@ -14,6 +14,9 @@ type UpdateUser struct {
 	UserId   *uuid.UUID
 	Login    *string
 	Password *string
+	// PasswordHistorySize - количество последних паролей, включая новый, которые остаются в истории.
+	// 0 не сокращает историю
+	PasswordHistorySize int
 }
 
 type AddRefreshTokenWithRefreshTokenId struct {
@@ -27,3 +30,82 @@ type RevokeRefreshTokensByUserIdAndDeviceCode struct {
 	UserId     *uuid.UUID
 	DeviceCode *string
 }
+type AddImpersonation struct {
+	ImpersonationId *uuid.UUID
+	AdminId         *uuid.UUID
+	UserId          *uuid.UUID
+	Reason          string
+	ExpirationAt    time.Time
+}
+type AddAuditEvent struct {
+	EventType string
+	UserId    *uuid.UUID
+	Login     string
+	ActorId   string
+	Ip        string
+	UserAgent string
+	Outcome   string
+	Details   string
+	CreatedAt time.Time
+}
+type GetAuditEvents struct {
+	From   *time.Time
+	To     *time.Time
+	UserId *uuid.UUID
+	Limit  int
+}
+type ClaimOutboxEvents struct {
+	Now         time.Time
+	LockedUntil time.Time
+	Limit       int
+}
+type UpdateOutboxEvent struct {
+	OutboxId      *uuid.UUID
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        *time.Time
+}
+type AddWebhookSubscription struct {
+	Url        string
+	Secret     string
+	EventTypes []string
+}
+type AddWebhookDeliveries struct {
+	EventId   *uuid.UUID
+	EventType string
+	Payload   []byte
+}
+type ClaimWebhookDeliveries struct {
+	Now         time.Time
+	LockedUntil time.Time
+	Limit       int
+}
+type UpdateWebhookDelivery struct {
+	DeliveryId     *uuid.UUID
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+	DeliveredAt    *time.Time
+}
+type AddWebhookDeliveryAttempt struct {
+	DeliveryId *uuid.UUID
+	StatusCode int
+	Error      string
+}
+type GetWebhookDeliveries struct {
+	SubscriptionId *uuid.UUID
+	Limit          int
+}
+type SaveJobRun struct {
+	Name         string
+	Instance     string
+	StartedAt    time.Time
+	Duration     time.Duration
+	Outcome      string
+	Error        string
+	RowsAffected int64
+}
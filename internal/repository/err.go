@@ -4,6 +4,7 @@ import "errors"
 
 var (
 	ErrInternalServerError = errors.New("internal server error")
+	ErrUnavailable         = errors.New("store is unavailable")
 
 	ErrRecordNotFound  = errors.New("record not found")
 	ErrUniqueViolation = errors.New("unique violation")
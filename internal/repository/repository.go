@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"skillsRockGRPC/internal/entity"
 	"skillsRockGRPC/internal/repository/dto"
 	"time"
@@ -8,17 +9,48 @@ import (
 	"github.com/google/uuid"
 )
 
+// Repository. Добавление, изменение и удаление пользователя записывают события user.registered,
+// password.changed и user.deleted в outbox в той же транзакции. Отзыв действующих refresh токенов
+// записывает событие session.revoked. Методы Remove*By* удаляют не больше limit записей за вызов, чтобы
+// очистка большой таблицы не удерживала блокировки надолго
 type Repository interface {
-	AddUser(dto *dto.AddUser) (*uuid.UUID, error)
-	GetUserByLogin(login string) (*entity.User, error)
-	UpdateUser(dto *dto.UpdateUser) error
-	RemoveUser(userId *uuid.UUID) error
-
-	AddRefreshTokenWithRefreshTokenId(dto *dto.AddRefreshTokenWithRefreshTokenId) error
-	GetRefreshToken(refreshTokenId *uuid.UUID) (*entity.RefreshToken, error)
-	RevokeRefreshTokenByRefreshTokenId(refreshTokenId *uuid.UUID) error
-	RevokeRefreshTokensByUserIdAndDeviceCode(dto *dto.RevokeRefreshTokensByUserIdAndDeviceCode) error
-	RemoveRefreshTokensByExpirationAt(now time.Time) (int64, error)
+	AddUser(ctx context.Context, dto *dto.AddUser) (*uuid.UUID, error)
+	GetUser(ctx context.Context, userId *uuid.UUID) (*entity.User, error)
+	GetUserByLogin(ctx context.Context, login string) (*entity.User, error)
+	UpdateUser(ctx context.Context, dto *dto.UpdateUser) error
+	RemoveUser(ctx context.Context, userId *uuid.UUID) error
+	GetPasswordHistory(ctx context.Context, userId *uuid.UUID, limit int) ([]string, error)
+
+	AddRefreshTokenWithRefreshTokenId(ctx context.Context, dto *dto.AddRefreshTokenWithRefreshTokenId) error
+	GetRefreshToken(ctx context.Context, refreshTokenId *uuid.UUID) (*entity.RefreshToken, error)
+	RevokeRefreshTokenByRefreshTokenId(ctx context.Context, refreshTokenId *uuid.UUID) error
+	RevokeRefreshTokensByUserIdAndDeviceCode(ctx context.Context, dto *dto.RevokeRefreshTokensByUserIdAndDeviceCode) error
+	GetActiveRefreshTokensByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.RefreshToken, error)
+	RemoveRefreshTokensByExpirationAt(ctx context.Context, now time.Time, limit int) (int64, error)
+	RemoveRefreshTokensByRevokedAt(ctx context.Context, before time.Time, limit int) (int64, error)
 	//RemoveRefreshToken(refreshTokenId *uuid.UUID) (*entity.RefreshToken, error)
 	//RemoveRefreshTokensByUserIdAndDeviceCode(dto *dto.RemoveRefreshTokensByUserIdAndDeviceCode) error
+
+	AddImpersonation(ctx context.Context, dto *dto.AddImpersonation) error
+	GetActiveImpersonationsByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.Impersonation, error)
+
+	AddAuditEvent(ctx context.Context, dto *dto.AddAuditEvent) error
+	GetAuditEvents(ctx context.Context, dto *dto.GetAuditEvents) ([]*entity.AuditEvent, error)
+	RemoveAuditEventsByCreatedAt(ctx context.Context, before time.Time, limit int) (int64, error)
+
+	ClaimOutboxEvents(ctx context.Context, dto *dto.ClaimOutboxEvents) ([]*entity.OutboxEvent, error)
+	UpdateOutboxEvent(ctx context.Context, dto *dto.UpdateOutboxEvent) error
+
+	AddWebhookSubscription(ctx context.Context, dto *dto.AddWebhookSubscription) (*uuid.UUID, error)
+	GetWebhookSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error)
+	RemoveWebhookSubscription(ctx context.Context, subscriptionId *uuid.UUID) error
+	AddWebhookDeliveries(ctx context.Context, dto *dto.AddWebhookDeliveries) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, dto *dto.ClaimWebhookDeliveries) ([]*entity.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, dto *dto.UpdateWebhookDelivery) error
+	AddWebhookDeliveryAttempt(ctx context.Context, dto *dto.AddWebhookDeliveryAttempt) error
+	GetWebhookDeliveries(ctx context.Context, dto *dto.GetWebhookDeliveries) ([]*entity.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, deliveryId *uuid.UUID, now time.Time) error
+
+	GetJobRun(ctx context.Context, name string) (*entity.JobRun, error)
+	SaveJobRun(ctx context.Context, dto *dto.SaveJobRun) error
 }
@@ -0,0 +1,814 @@
+// Package repositorytest - общий набор тестов, который должна проходить каждая реализация repository.Repository
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Run запускает набор тестов. newRepository вызывается для каждого теста и должна возвращать пустое хранилище
+func Run(t *testing.T, newRepository func(t *testing.T) repository.Repository) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.Repository)
+	}{
+		{"User", testUser},
+		{"UserUniqueLogin", testUserUniqueLogin},
+		{"UserNotFound", testUserNotFound},
+		{"RemoveUserCascade", testRemoveUserCascade},
+		{"PasswordHistory", testPasswordHistory},
+		{"RefreshToken", testRefreshToken},
+		{"RevokeRefreshTokens", testRevokeRefreshTokens},
+		{"RemoveRefreshTokensByExpirationAt", testRemoveRefreshTokensByExpirationAt},
+		{"RemoveRefreshTokensByRevokedAt", testRemoveRefreshTokensByRevokedAt},
+		{"Impersonation", testImpersonation},
+		{"AuditEvents", testAuditEvents},
+		{"Outbox", testOutbox},
+		{"OutboxSessionRevoked", testOutboxSessionRevoked},
+		{"WebhookSubscription", testWebhookSubscription},
+		{"WebhookDelivery", testWebhookDelivery},
+		{"JobRun", testJobRun},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newRepository(t))
+		})
+	}
+}
+
+// now - текущее время с точностью хранения PostgreSQL
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+func addUser(t *testing.T, repo repository.Repository, login string) *uuid.UUID {
+	t.Helper()
+	userId, err := repo.AddUser(context.Background(), &dto.AddUser{Login: login, Password: "hash-" + login})
+	if err != nil {
+		t.Fatalf("AddUser(%s): %v", login, err)
+	}
+	return userId
+}
+func addRefreshToken(t *testing.T, repo repository.Repository, userId *uuid.UUID, deviceCode string, expirationAt time.Time) *uuid.UUID {
+	t.Helper()
+	refreshTokenId := uuid.New()
+	if err := repo.AddRefreshTokenWithRefreshTokenId(context.Background(), &dto.AddRefreshTokenWithRefreshTokenId{
+		RefreshTokenId: &refreshTokenId,
+		UserId:         userId,
+		DeviceCode:     deviceCode,
+		ExpirationAt:   expirationAt,
+	}); err != nil {
+		t.Fatalf("AddRefreshTokenWithRefreshTokenId: %v", err)
+	}
+	return &refreshTokenId
+}
+func claimOutboxEvents(t *testing.T, repo repository.Repository) []*entity.OutboxEvent {
+	t.Helper()
+	events, err := repo.ClaimOutboxEvents(context.Background(), &dto.ClaimOutboxEvents{
+		Now:         now().Add(time.Second),
+		LockedUntil: now().Add(time.Minute),
+		Limit:       100,
+	})
+	if err != nil {
+		t.Fatalf("ClaimOutboxEvents: %v", err)
+	}
+	return events
+}
+func expectError(t *testing.T, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("error = %v, want %v", err, target)
+	}
+}
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testUser(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	user, err := repo.GetUser(ctx, userId)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if *user.UserId != *userId || user.Login != "alice" || user.Password != "hash-alice" || user.Role != entity.RoleUser {
+		t.Fatalf("GetUser = %+v", user)
+	}
+	user, err = repo.GetUserByLogin(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserByLogin: %v", err)
+	}
+	if *user.UserId != *userId {
+		t.Fatalf("GetUserByLogin userId = %s, want %s", user.UserId, userId)
+	}
+
+	if err := repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Login: ptr("alice2")}); err != nil {
+		t.Fatalf("UpdateUser login: %v", err)
+	}
+	if _, err := repo.GetUserByLogin(ctx, "alice"); !errors.Is(err, repository.ErrRecordNotFound) {
+		t.Fatalf("GetUserByLogin old login error = %v, want %v", err, repository.ErrRecordNotFound)
+	}
+	if err := repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Password: ptr("hash-new")}); err != nil {
+		t.Fatalf("UpdateUser password: %v", err)
+	}
+	user, err = repo.GetUserByLogin(ctx, "alice2")
+	if err != nil {
+		t.Fatalf("GetUserByLogin: %v", err)
+	}
+	if user.Login != "alice2" || user.Password != "hash-new" {
+		t.Fatalf("updated user = %+v", user)
+	}
+
+	if err := repo.RemoveUser(ctx, userId); err != nil {
+		t.Fatalf("RemoveUser: %v", err)
+	}
+	_, err = repo.GetUser(ctx, userId)
+	expectError(t, err, repository.ErrRecordNotFound)
+	//логин освобождается после удаления
+	addUser(t, repo, "alice2")
+}
+func testUserUniqueLogin(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	addUser(t, repo, "alice")
+	bobId := addUser(t, repo, "bob")
+	_, err := repo.AddUser(ctx, &dto.AddUser{Login: "alice", Password: "hash"})
+	expectError(t, err, repository.ErrUniqueViolation)
+	err = repo.UpdateUser(ctx, &dto.UpdateUser{UserId: bobId, Login: ptr("alice")})
+	expectError(t, err, repository.ErrUniqueViolation)
+	user, err := repo.GetUser(ctx, bobId)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.Login != "bob" {
+		t.Fatalf("login = %s after failed update, want bob", user.Login)
+	}
+}
+func testUserNotFound(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := ptr(uuid.New())
+	_, err := repo.GetUser(ctx, userId)
+	expectError(t, err, repository.ErrRecordNotFound)
+	_, err = repo.GetUserByLogin(ctx, "nobody")
+	expectError(t, err, repository.ErrRecordNotFound)
+	err = repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Password: ptr("hash")})
+	expectError(t, err, repository.ErrRecordNotFound)
+	err = repo.RemoveUser(ctx, userId)
+	expectError(t, err, repository.ErrRecordNotFound)
+	_, err = repo.GetRefreshToken(ctx, userId)
+	expectError(t, err, repository.ErrRecordNotFound)
+}
+func testRemoveUserCascade(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	otherId := addUser(t, repo, "bob")
+	refreshTokenId := addRefreshToken(t, repo, userId, "phone", now().Add(time.Hour))
+	otherRefreshTokenId := addRefreshToken(t, repo, otherId, "phone", now().Add(time.Hour))
+	if err := repo.AddImpersonation(ctx, &dto.AddImpersonation{
+		ImpersonationId: ptr(uuid.New()),
+		AdminId:         otherId,
+		UserId:          userId,
+		ExpirationAt:    now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("AddImpersonation: %v", err)
+	}
+	if err := repo.RemoveUser(ctx, userId); err != nil {
+		t.Fatalf("RemoveUser: %v", err)
+	}
+	_, err := repo.GetRefreshToken(ctx, refreshTokenId)
+	expectError(t, err, repository.ErrRecordNotFound)
+	if _, err := repo.GetRefreshToken(ctx, otherRefreshTokenId); err != nil {
+		t.Fatalf("refresh token of another user: %v", err)
+	}
+	history, err := repo.GetPasswordHistory(ctx, userId, 10)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory: %v", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("password history after remove = %v, want empty", history)
+	}
+	impersonations, err := repo.GetActiveImpersonationsByUserId(ctx, userId, now())
+	if err != nil {
+		t.Fatalf("GetActiveImpersonationsByUserId: %v", err)
+	}
+	if len(impersonations) != 0 {
+		t.Fatalf("impersonations after remove = %d, want 0", len(impersonations))
+	}
+}
+func testPasswordHistory(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	bobId := addUser(t, repo, "bob")
+	for _, password := range []string{"hash-1", "hash-2", "hash-3"} {
+		if err := repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Password: ptr(password)}); err != nil {
+			t.Fatalf("UpdateUser: %v", err)
+		}
+	}
+	//изменение логина не пополняет историю
+	if err := repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Login: ptr("alice2")}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	history, err := repo.GetPasswordHistory(ctx, userId, 10)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory: %v", err)
+	}
+	if want := []string{"hash-3", "hash-2", "hash-1", "hash-alice"}; !reflect.DeepEqual(history, want) {
+		t.Fatalf("GetPasswordHistory = %v, want %v", history, want)
+	}
+	history, err = repo.GetPasswordHistory(ctx, userId, 2)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory: %v", err)
+	}
+	if want := []string{"hash-3", "hash-2"}; !reflect.DeepEqual(history, want) {
+		t.Fatalf("GetPasswordHistory limit 2 = %v, want %v", history, want)
+	}
+
+	//история сокращается до заданного размера, история других пользователей не меняется
+	if err := repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Password: ptr("hash-4"), PasswordHistorySize: 2}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	history, err = repo.GetPasswordHistory(ctx, userId, 10)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory: %v", err)
+	}
+	if want := []string{"hash-4", "hash-3"}; !reflect.DeepEqual(history, want) {
+		t.Fatalf("GetPasswordHistory after prune = %v, want %v", history, want)
+	}
+	history, err = repo.GetPasswordHistory(ctx, bobId, 10)
+	if err != nil {
+		t.Fatalf("GetPasswordHistory: %v", err)
+	}
+	if want := []string{"hash-bob"}; !reflect.DeepEqual(history, want) {
+		t.Fatalf("GetPasswordHistory of other user = %v, want %v", history, want)
+	}
+}
+func testRefreshToken(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	expirationAt := now().Add(time.Hour)
+	refreshTokenId := addRefreshToken(t, repo, userId, "phone", expirationAt)
+	refreshToken, err := repo.GetRefreshToken(ctx, refreshTokenId)
+	if err != nil {
+		t.Fatalf("GetRefreshToken: %v", err)
+	}
+	if *refreshToken.RefreshTokenId != *refreshTokenId || *refreshToken.UserId != *userId || refreshToken.DeviceCode != "phone" ||
+		!refreshToken.ExpirationAt.Equal(expirationAt) || refreshToken.IsRevoke || refreshToken.RevokedAt != nil {
+		t.Fatalf("GetRefreshToken = %+v", refreshToken)
+	}
+	if err := repo.RevokeRefreshTokenByRefreshTokenId(ctx, refreshTokenId); err != nil {
+		t.Fatalf("RevokeRefreshTokenByRefreshTokenId: %v", err)
+	}
+	//отозванный токен остается доступным для обнаружения повторного использования
+	refreshToken, err = repo.GetRefreshToken(ctx, refreshTokenId)
+	if err != nil {
+		t.Fatalf("GetRefreshToken: %v", err)
+	}
+	if !refreshToken.IsRevoke || refreshToken.RevokedAt == nil {
+		t.Fatalf("refresh token is not revoked: %+v", refreshToken)
+	}
+	if err := repo.RevokeRefreshTokenByRefreshTokenId(ctx, ptr(uuid.New())); err != nil {
+		t.Fatalf("RevokeRefreshTokenByRefreshTokenId unknown token: %v", err)
+	}
+}
+func testRevokeRefreshTokens(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	otherId := addUser(t, repo, "bob")
+	later := addRefreshToken(t, repo, userId, "laptop", now().Add(2*time.Hour))
+	phone := addRefreshToken(t, repo, userId, "phone", now().Add(time.Hour))
+	addRefreshToken(t, repo, userId, "tablet", now().Add(-time.Hour))
+	other := addRefreshToken(t, repo, otherId, "phone", now().Add(time.Hour))
+
+	active, err := repo.GetActiveRefreshTokensByUserId(ctx, userId, now())
+	if err != nil {
+		t.Fatalf("GetActiveRefreshTokensByUserId: %v", err)
+	}
+	if len(active) != 2 || *active[0].RefreshTokenId != *phone || *active[1].RefreshTokenId != *later {
+		t.Fatalf("active refresh tokens = %v, want [%s %s] ordered by expiration", refreshTokenIds(active), phone, later)
+	}
+
+	if err := repo.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, &dto.RevokeRefreshTokensByUserIdAndDeviceCode{UserId: userId, DeviceCode: ptr("phone")}); err != nil {
+		t.Fatalf("RevokeRefreshTokensByUserIdAndDeviceCode: %v", err)
+	}
+	active, err = repo.GetActiveRefreshTokensByUserId(ctx, userId, now())
+	if err != nil {
+		t.Fatalf("GetActiveRefreshTokensByUserId: %v", err)
+	}
+	if len(active) != 1 || *active[0].RefreshTokenId != *later {
+		t.Fatalf("active refresh tokens = %v, want [%s]", refreshTokenIds(active), later)
+	}
+
+	if err := repo.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, &dto.RevokeRefreshTokensByUserIdAndDeviceCode{UserId: userId}); err != nil {
+		t.Fatalf("RevokeRefreshTokensByUserIdAndDeviceCode: %v", err)
+	}
+	active, err = repo.GetActiveRefreshTokensByUserId(ctx, userId, now())
+	if err != nil {
+		t.Fatalf("GetActiveRefreshTokensByUserId: %v", err)
+	}
+	if len(active) != 0 {
+		t.Fatalf("active refresh tokens = %v, want empty", refreshTokenIds(active))
+	}
+	refreshToken, err := repo.GetRefreshToken(ctx, other)
+	if err != nil {
+		t.Fatalf("GetRefreshToken: %v", err)
+	}
+	if refreshToken.IsRevoke {
+		t.Fatal("refresh token of another user is revoked")
+	}
+}
+func refreshTokenIds(refreshTokens []*entity.RefreshToken) []string {
+	ids := []string{}
+	for _, refreshToken := range refreshTokens {
+		ids = append(ids, refreshToken.RefreshTokenId.String())
+	}
+	return ids
+}
+func testRemoveRefreshTokensByExpirationAt(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	boundary := now()
+	var expired []*uuid.UUID
+	for i := range 4 {
+		expired = append(expired, addRefreshToken(t, repo, userId, "phone", boundary.Add(-time.Duration(i+1)*time.Minute)))
+	}
+	expiredRevoked := addRefreshToken(t, repo, userId, "laptop", boundary.Add(-time.Microsecond))
+	if err := repo.RevokeRefreshTokenByRefreshTokenId(ctx, expiredRevoked); err != nil {
+		t.Fatalf("RevokeRefreshTokenByRefreshTokenId: %v", err)
+	}
+	expired = append(expired, expiredRevoked)
+	//токен, истекающий ровно на границе, еще действителен
+	onBoundary := addRefreshToken(t, repo, userId, "tablet", boundary)
+	active := addRefreshToken(t, repo, userId, "desktop", boundary.Add(time.Hour))
+	//удаление ограничено limit, оставшиеся записи удаляются следующими пакетами
+	for _, want := range []int64{2, 2, 1, 0} {
+		count, err := repo.RemoveRefreshTokensByExpirationAt(ctx, boundary, 2)
+		if err != nil {
+			t.Fatalf("RemoveRefreshTokensByExpirationAt: %v", err)
+		}
+		if count != want {
+			t.Fatalf("RemoveRefreshTokensByExpirationAt = %d, want %d", count, want)
+		}
+	}
+	for _, refreshTokenId := range expired {
+		_, err := repo.GetRefreshToken(ctx, refreshTokenId)
+		expectError(t, err, repository.ErrRecordNotFound)
+	}
+	for _, refreshTokenId := range []*uuid.UUID{onBoundary, active} {
+		if _, err := repo.GetRefreshToken(ctx, refreshTokenId); err != nil {
+			t.Fatalf("refresh token %s: %v", refreshTokenId, err)
+		}
+	}
+}
+func testRemoveRefreshTokensByRevokedAt(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	var revoked []*uuid.UUID
+	for range 3 {
+		refreshTokenId := addRefreshToken(t, repo, userId, "phone", now().Add(time.Hour))
+		if err := repo.RevokeRefreshTokenByRefreshTokenId(ctx, refreshTokenId); err != nil {
+			t.Fatalf("RevokeRefreshTokenByRefreshTokenId: %v", err)
+		}
+		revoked = append(revoked, refreshTokenId)
+	}
+	active := addRefreshToken(t, repo, userId, "tablet", now().Add(time.Hour))
+	//время отзыва задает хранилище, границы берутся из сохраненных значений
+	var first, last time.Time
+	for i, refreshTokenId := range revoked {
+		refreshToken, err := repo.GetRefreshToken(ctx, refreshTokenId)
+		if err != nil || refreshToken.RevokedAt == nil {
+			t.Fatalf("GetRefreshToken = %+v, %v", refreshToken, err)
+		}
+		if i == 0 || refreshToken.RevokedAt.Before(first) {
+			first = *refreshToken.RevokedAt
+		}
+		if refreshToken.RevokedAt.After(last) {
+			last = *refreshToken.RevokedAt
+		}
+	}
+	//токены, отозванные позже границы срока хранения или ровно на ней, сохраняются
+	for _, before := range []time.Time{first.Add(-time.Hour), first} {
+		count, err := repo.RemoveRefreshTokensByRevokedAt(ctx, before, 10)
+		if err != nil {
+			t.Fatalf("RemoveRefreshTokensByRevokedAt: %v", err)
+		}
+		if count != 0 {
+			t.Fatalf("RemoveRefreshTokensByRevokedAt(%v) = %d, want 0", before, count)
+		}
+	}
+	//удаление ограничено limit, оставшиеся записи удаляются следующими пакетами
+	for _, want := range []int64{2, 1, 0} {
+		count, err := repo.RemoveRefreshTokensByRevokedAt(ctx, last.Add(time.Microsecond), 2)
+		if err != nil {
+			t.Fatalf("RemoveRefreshTokensByRevokedAt: %v", err)
+		}
+		if count != want {
+			t.Fatalf("RemoveRefreshTokensByRevokedAt = %d, want %d", count, want)
+		}
+	}
+	for _, refreshTokenId := range revoked {
+		_, err := repo.GetRefreshToken(ctx, refreshTokenId)
+		expectError(t, err, repository.ErrRecordNotFound)
+	}
+	if _, err := repo.GetRefreshToken(ctx, active); err != nil {
+		t.Fatalf("active refresh token: %v", err)
+	}
+}
+func testImpersonation(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	adminId := addUser(t, repo, "admin")
+	userId := addUser(t, repo, "alice")
+	var ids []uuid.UUID
+	for _, expirationAt := range []time.Time{now().Add(time.Hour), now().Add(-time.Hour), now().Add(time.Minute)} {
+		impersonationId := uuid.New()
+		if err := repo.AddImpersonation(ctx, &dto.AddImpersonation{
+			ImpersonationId: &impersonationId,
+			AdminId:         adminId,
+			UserId:          userId,
+			Reason:          "support",
+			ExpirationAt:    expirationAt,
+		}); err != nil {
+			t.Fatalf("AddImpersonation: %v", err)
+		}
+		ids = append(ids, impersonationId)
+		//created_at различается у последовательных записей
+		time.Sleep(2 * time.Millisecond)
+	}
+	impersonations, err := repo.GetActiveImpersonationsByUserId(ctx, userId, now())
+	if err != nil {
+		t.Fatalf("GetActiveImpersonationsByUserId: %v", err)
+	}
+	if len(impersonations) != 2 || *impersonations[0].ImpersonationId != ids[0] || *impersonations[1].ImpersonationId != ids[2] {
+		t.Fatalf("active impersonations = %d, want [%s %s] ordered by creation", len(impersonations), ids[0], ids[2])
+	}
+	if impersonation := impersonations[0]; *impersonation.AdminId != *adminId || impersonation.Reason != "support" {
+		t.Fatalf("impersonation = %+v", impersonation)
+	}
+	impersonations, err = repo.GetActiveImpersonationsByUserId(ctx, adminId, now())
+	if err != nil {
+		t.Fatalf("GetActiveImpersonationsByUserId: %v", err)
+	}
+	if len(impersonations) != 0 {
+		t.Fatalf("active impersonations of admin = %d, want 0", len(impersonations))
+	}
+}
+func testAuditEvents(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId, otherId := ptr(uuid.New()), ptr(uuid.New())
+	base := now().Add(-time.Hour)
+	events := []struct {
+		userId    *uuid.UUID
+		createdAt time.Time
+	}{
+		{userId, base},
+		{otherId, base.Add(time.Minute)},
+		{userId, base.Add(2 * time.Minute)},
+		{nil, base.Add(3 * time.Minute)},
+	}
+	for _, event := range events {
+		if err := repo.AddAuditEvent(ctx, &dto.AddAuditEvent{
+			EventType: entity.AuditEventLogin,
+			UserId:    event.userId,
+			Login:     "alice",
+			ActorId:   "actor",
+			Ip:        "127.0.0.1",
+			UserAgent: "test",
+			Outcome:   entity.AuditOutcomeSuccess,
+			CreatedAt: event.createdAt,
+		}); err != nil {
+			t.Fatalf("AddAuditEvent: %v", err)
+		}
+	}
+	got, err := repo.GetAuditEvents(ctx, &dto.GetAuditEvents{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(got) != 4 || !got[0].CreatedAt.Equal(events[3].createdAt) || !got[3].CreatedAt.Equal(events[0].createdAt) {
+		t.Fatalf("GetAuditEvents returned %d events, want 4 newest first", len(got))
+	}
+	if event := got[3]; event.AuditEventId == nil || event.EventType != entity.AuditEventLogin || *event.UserId != *userId ||
+		event.Login != "alice" || event.ActorId != "actor" || event.Ip != "127.0.0.1" || event.UserAgent != "test" || event.Outcome != entity.AuditOutcomeSuccess {
+		t.Fatalf("audit event = %+v", event)
+	}
+	if got[0].UserId != nil {
+		t.Fatalf("audit event without user has userId %s", got[0].UserId)
+	}
+	//from включительно, to не включительно
+	got, err = repo.GetAuditEvents(ctx, &dto.GetAuditEvents{From: ptr(events[1].createdAt), To: ptr(events[3].createdAt), Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(got) != 2 || !got[0].CreatedAt.Equal(events[2].createdAt) || !got[1].CreatedAt.Equal(events[1].createdAt) {
+		t.Fatalf("GetAuditEvents from/to returned %d events, want 2", len(got))
+	}
+	got, err = repo.GetAuditEvents(ctx, &dto.GetAuditEvents{UserId: userId, Limit: 1})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(got) != 1 || !got[0].CreatedAt.Equal(events[2].createdAt) {
+		t.Fatalf("GetAuditEvents by user with limit returned %d events, want the newest one", len(got))
+	}
+
+	for _, want := range []int64{1, 1, 0} {
+		count, err := repo.RemoveAuditEventsByCreatedAt(ctx, events[2].createdAt, 1)
+		if err != nil {
+			t.Fatalf("RemoveAuditEventsByCreatedAt: %v", err)
+		}
+		if count != want {
+			t.Fatalf("RemoveAuditEventsByCreatedAt = %d, want %d", count, want)
+		}
+	}
+	got, err = repo.GetAuditEvents(ctx, &dto.GetAuditEvents{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEvents: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("GetAuditEvents after remove returned %d events, want 2", len(got))
+	}
+}
+func testOutbox(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	if err := repo.UpdateUser(ctx, &dto.UpdateUser{UserId: userId, Password: ptr("hash-new")}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if err := repo.RemoveUser(ctx, userId); err != nil {
+		t.Fatalf("RemoveUser: %v", err)
+	}
+	events := claimOutboxEvents(t, repo)
+	var eventTypes []string
+	for _, event := range events {
+		eventTypes = append(eventTypes, event.EventType)
+	}
+	if want := []string{entity.EventUserRegistered, entity.EventPasswordChanged, entity.EventUserDeleted}; !reflect.DeepEqual(eventTypes, want) {
+		t.Fatalf("outbox events = %v, want %v", eventTypes, want)
+	}
+	payload := new(entity.UserEventPayload)
+	if err := json.Unmarshal(events[0].Payload, payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if payload.UserId == nil || *payload.UserId != *userId || payload.Login != "alice" {
+		t.Fatalf("user.registered payload = %+v", payload)
+	}
+	if event := events[0]; event.OutboxId == nil || event.Status != entity.OutboxStatusPending || event.Attempts != 0 {
+		t.Fatalf("outbox event = %+v", event)
+	}
+
+	//захваченные события недоступны до истечения блокировки
+	if events := claimOutboxEvents(t, repo); len(events) != 0 {
+		t.Fatalf("claimed locked events: %d", len(events))
+	}
+	if err := repo.UpdateOutboxEvent(ctx, &dto.UpdateOutboxEvent{
+		OutboxId:      events[0].OutboxId,
+		Status:        entity.OutboxStatusSent,
+		Attempts:      1,
+		NextAttemptAt: now(),
+		SentAt:        ptr(now()),
+	}); err != nil {
+		t.Fatalf("UpdateOutboxEvent: %v", err)
+	}
+	if err := repo.UpdateOutboxEvent(ctx, &dto.UpdateOutboxEvent{
+		OutboxId:      events[1].OutboxId,
+		Status:        entity.OutboxStatusPending,
+		Attempts:      1,
+		NextAttemptAt: now().Add(time.Hour),
+		LastError:     "unavailable",
+	}); err != nil {
+		t.Fatalf("UpdateOutboxEvent: %v", err)
+	}
+	if err := repo.UpdateOutboxEvent(ctx, &dto.UpdateOutboxEvent{
+		OutboxId:      events[2].OutboxId,
+		Status:        entity.OutboxStatusPending,
+		Attempts:      1,
+		NextAttemptAt: now(),
+		LastError:     "unavailable",
+	}); err != nil {
+		t.Fatalf("UpdateOutboxEvent: %v", err)
+	}
+	claimed := claimOutboxEvents(t, repo)
+	if len(claimed) != 1 || *claimed[0].OutboxId != *events[2].OutboxId || claimed[0].Attempts != 1 || claimed[0].LastError != "unavailable" {
+		t.Fatalf("claimed %d events after update, want only the retried one", len(claimed))
+	}
+
+	//limit
+	addUser(t, repo, "bob")
+	addUser(t, repo, "carol")
+	claimed, err := repo.ClaimOutboxEvents(ctx, &dto.ClaimOutboxEvents{Now: now().Add(time.Second), LockedUntil: now().Add(time.Minute), Limit: 1})
+	if err != nil {
+		t.Fatalf("ClaimOutboxEvents: %v", err)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("claimed %d events, want 1", len(claimed))
+	}
+}
+func testOutboxSessionRevoked(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	userId := addUser(t, repo, "alice")
+	addRefreshToken(t, repo, userId, "phone", now().Add(time.Hour))
+	claimOutboxEvents(t, repo)
+	revoke := &dto.RevokeRefreshTokensByUserIdAndDeviceCode{UserId: userId, DeviceCode: ptr("phone")}
+	if err := repo.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, revoke); err != nil {
+		t.Fatalf("RevokeRefreshTokensByUserIdAndDeviceCode: %v", err)
+	}
+	events := claimOutboxEvents(t, repo)
+	if len(events) != 1 || events[0].EventType != entity.EventSessionRevoked {
+		t.Fatalf("outbox events after revoke = %d, want one session.revoked", len(events))
+	}
+	payload := new(entity.UserEventPayload)
+	if err := json.Unmarshal(events[0].Payload, payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if payload.UserId == nil || *payload.UserId != *userId || payload.DeviceCode != "phone" {
+		t.Fatalf("session.revoked payload = %+v", payload)
+	}
+	//повторный отзыв ничего не меняет и не записывает событие
+	if err := repo.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, revoke); err != nil {
+		t.Fatalf("RevokeRefreshTokensByUserIdAndDeviceCode: %v", err)
+	}
+	if events := claimOutboxEvents(t, repo); len(events) != 0 {
+		t.Fatalf("outbox events after repeated revoke = %d, want 0", len(events))
+	}
+}
+func testWebhookSubscription(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	first, err := repo.AddWebhookSubscription(ctx, &dto.AddWebhookSubscription{Url: "http://first", Secret: "s1", EventTypes: []string{entity.EventUserRegistered}})
+	if err != nil {
+		t.Fatalf("AddWebhookSubscription: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	second, err := repo.AddWebhookSubscription(ctx, &dto.AddWebhookSubscription{Url: "http://second", Secret: "s2", EventTypes: []string{entity.EventUserRegistered, entity.EventUserDeleted}})
+	if err != nil {
+		t.Fatalf("AddWebhookSubscription: %v", err)
+	}
+	subscriptions, err := repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("GetWebhookSubscriptions: %v", err)
+	}
+	if len(subscriptions) != 2 || *subscriptions[0].SubscriptionId != *first || *subscriptions[1].SubscriptionId != *second {
+		t.Fatalf("GetWebhookSubscriptions returned %d subscriptions, want 2 ordered by creation", len(subscriptions))
+	}
+	if subscription := subscriptions[1]; subscription.Url != "http://second" || subscription.Secret != "s2" ||
+		!reflect.DeepEqual(subscription.EventTypes, []string{entity.EventUserRegistered, entity.EventUserDeleted}) {
+		t.Fatalf("subscription = %+v", subscription)
+	}
+	if err := repo.RemoveWebhookSubscription(ctx, first); err != nil {
+		t.Fatalf("RemoveWebhookSubscription: %v", err)
+	}
+	err = repo.RemoveWebhookSubscription(ctx, first)
+	expectError(t, err, repository.ErrRecordNotFound)
+	subscriptions, err = repo.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("GetWebhookSubscriptions: %v", err)
+	}
+	if len(subscriptions) != 1 {
+		t.Fatalf("GetWebhookSubscriptions after remove returned %d subscriptions, want 1", len(subscriptions))
+	}
+}
+func testWebhookDelivery(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	first, err := repo.AddWebhookSubscription(ctx, &dto.AddWebhookSubscription{Url: "http://first", Secret: "s1", EventTypes: []string{entity.EventUserRegistered}})
+	if err != nil {
+		t.Fatalf("AddWebhookSubscription: %v", err)
+	}
+	second, err := repo.AddWebhookSubscription(ctx, &dto.AddWebhookSubscription{Url: "http://second", Secret: "s2", EventTypes: []string{entity.EventUserRegistered, entity.EventUserDeleted}})
+	if err != nil {
+		t.Fatalf("AddWebhookSubscription: %v", err)
+	}
+	eventId := ptr(uuid.New())
+	payload := []byte(`{"userId":"1"}`)
+	count, err := repo.AddWebhookDeliveries(ctx, &dto.AddWebhookDeliveries{EventId: eventId, EventType: entity.EventUserRegistered, Payload: payload})
+	if err != nil {
+		t.Fatalf("AddWebhookDeliveries: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("AddWebhookDeliveries = %d, want 2", count)
+	}
+	//повтор публикации события реле не создает доставки повторно
+	count, err = repo.AddWebhookDeliveries(ctx, &dto.AddWebhookDeliveries{EventId: eventId, EventType: entity.EventUserRegistered, Payload: payload})
+	if err != nil {
+		t.Fatalf("AddWebhookDeliveries again: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("AddWebhookDeliveries again = %d, want 0", count)
+	}
+	count, err = repo.AddWebhookDeliveries(ctx, &dto.AddWebhookDeliveries{EventId: ptr(uuid.New()), EventType: entity.EventPasswordChanged, Payload: payload})
+	if err != nil {
+		t.Fatalf("AddWebhookDeliveries: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("AddWebhookDeliveries without subscribers = %d, want 0", count)
+	}
+
+	claim := &dto.ClaimWebhookDeliveries{Now: now().Add(time.Second), LockedUntil: now().Add(time.Minute), Limit: 100}
+	deliveries, err := repo.ClaimWebhookDeliveries(ctx, claim)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("ClaimWebhookDeliveries returned %d deliveries, want 2", len(deliveries))
+	}
+	var delivery *entity.WebhookDelivery
+	for _, d := range deliveries {
+		if *d.SubscriptionId == *second {
+			delivery = d
+		}
+	}
+	if delivery == nil || delivery.Url != "http://second" || delivery.Secret != "s2" || *delivery.EventId != *eventId ||
+		delivery.EventType != entity.EventUserRegistered || delivery.Status != entity.WebhookDeliveryStatusPending || !jsonEqual(delivery.Payload, payload) {
+		t.Fatalf("delivery = %+v", delivery)
+	}
+	if deliveries, err := repo.ClaimWebhookDeliveries(ctx, claim); err != nil || len(deliveries) != 0 {
+		t.Fatalf("ClaimWebhookDeliveries of locked deliveries = %d, %v", len(deliveries), err)
+	}
+
+	if err := repo.AddWebhookDeliveryAttempt(ctx, &dto.AddWebhookDeliveryAttempt{DeliveryId: delivery.DeliveryId, StatusCode: 200}); err != nil {
+		t.Fatalf("AddWebhookDeliveryAttempt: %v", err)
+	}
+	if err := repo.UpdateWebhookDelivery(ctx, &dto.UpdateWebhookDelivery{
+		DeliveryId:     delivery.DeliveryId,
+		Status:         entity.WebhookDeliveryStatusDelivered,
+		Attempts:       1,
+		NextAttemptAt:  now(),
+		LastStatusCode: 200,
+		DeliveredAt:    ptr(now()),
+	}); err != nil {
+		t.Fatalf("UpdateWebhookDelivery: %v", err)
+	}
+	got, err := repo.GetWebhookDeliveries(ctx, &dto.GetWebhookDeliveries{SubscriptionId: second, Limit: 10})
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries: %v", err)
+	}
+	if len(got) != 1 || got[0].Status != entity.WebhookDeliveryStatusDelivered || got[0].Attempts != 1 ||
+		got[0].LastStatusCode != 200 || got[0].DeliveredAt == nil || got[0].Url != "http://second" {
+		t.Fatalf("GetWebhookDeliveries = %d deliveries, first %+v", len(got), got)
+	}
+	got, err = repo.GetWebhookDeliveries(ctx, &dto.GetWebhookDeliveries{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("GetWebhookDeliveries with limit = %d deliveries, want 1", len(got))
+	}
+
+	if err := repo.ReplayWebhookDelivery(ctx, delivery.DeliveryId, now()); err != nil {
+		t.Fatalf("ReplayWebhookDelivery: %v", err)
+	}
+	err = repo.ReplayWebhookDelivery(ctx, ptr(uuid.New()), now())
+	expectError(t, err, repository.ErrRecordNotFound)
+	deliveries, err = repo.ClaimWebhookDeliveries(ctx, claim)
+	if err != nil {
+		t.Fatalf("ClaimWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) != 1 || *deliveries[0].DeliveryId != *delivery.DeliveryId || deliveries[0].Attempts != 0 || deliveries[0].DeliveredAt != nil {
+		t.Fatalf("ClaimWebhookDeliveries after replay = %d deliveries, want the replayed one reset", len(deliveries))
+	}
+
+	//удаление подписки удаляет ее доставки
+	if err := repo.RemoveWebhookSubscription(ctx, second); err != nil {
+		t.Fatalf("RemoveWebhookSubscription: %v", err)
+	}
+	got, err = repo.GetWebhookDeliveries(ctx, &dto.GetWebhookDeliveries{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries: %v", err)
+	}
+	if len(got) != 1 || *got[0].SubscriptionId != *first {
+		t.Fatalf("GetWebhookDeliveries after subscription remove = %d deliveries, want 1 of the first subscription", len(got))
+	}
+}
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+func testJobRun(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	_, err := repo.GetJobRun(ctx, "RemoveRefreshTokens")
+	expectError(t, err, repository.ErrRecordNotFound)
+	runs := []*dto.SaveJobRun{
+		{Name: "RemoveRefreshTokens", Instance: "a", StartedAt: now().Add(-time.Minute), Duration: 1500 * time.Millisecond, Outcome: entity.JobOutcomeFailure, Error: "timeout"},
+		{Name: "RemoveRefreshTokens", Instance: "b", StartedAt: now(), Duration: 20 * time.Millisecond, Outcome: entity.JobOutcomeSuccess, RowsAffected: 7},
+	}
+	for _, run := range runs {
+		if err := repo.SaveJobRun(ctx, run); err != nil {
+			t.Fatalf("SaveJobRun: %v", err)
+		}
+		jobRun, err := repo.GetJobRun(ctx, run.Name)
+		if err != nil {
+			t.Fatalf("GetJobRun: %v", err)
+		}
+		if jobRun.Name != run.Name || jobRun.Instance != run.Instance || !jobRun.StartedAt.Equal(run.StartedAt) || jobRun.Duration != run.Duration ||
+			jobRun.Outcome != run.Outcome || jobRun.Error != run.Error || jobRun.RowsAffected != run.RowsAffected {
+			t.Fatalf("GetJobRun = %+v, want %+v", jobRun, run)
+		}
+	}
+	_, err = repo.GetJobRun(ctx, "RemoveAuditEvents")
+	expectError(t, err, repository.ErrRecordNotFound)
+}
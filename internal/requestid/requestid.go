@@ -0,0 +1,91 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Header - заголовок HTTP запроса и ответа шлюза
+	Header = "X-Request-Id"
+	// MetadataKey - ключ метаданных gRPC запроса и заголовков ответа
+	MetadataKey = "x-request-id"
+
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestId)
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку
+func FromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(contextKey{}).(string)
+	return requestId
+}
+
+// resolve возвращает идентификатор клиента, если он допустим, иначе новый идентификатор
+func resolve(requestId string) string {
+	if valid(requestId) {
+		return requestId
+	}
+	return uuid.NewString()
+}
+
+// valid допускает непустой идентификатор до 128 символов из латинских букв, цифр и -_.:
+func valid(requestId string) bool {
+	if requestId == "" || len(requestId) > maxLength {
+		return false
+	}
+	for _, r := range requestId {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware принимает X-Request-Id клиента или создает новый, возвращает его в заголовке ответа
+// и сохраняет в контексте запроса
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := resolve(r.Header.Get(Header))
+		w.Header().Set(Header, requestId)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), requestId)))
+	})
+}
+
+// GatewayMetadata передает идентификатор запроса из контекста шлюза в метаданные gRPC запроса
+func GatewayMetadata(ctx context.Context, r *http.Request) metadata.MD {
+	requestId := FromContext(ctx)
+	if requestId == "" {
+		return nil
+	}
+	return metadata.Pairs(MetadataKey, requestId)
+}
+
+// UnaryServerInterceptor берет идентификатор из метаданных или создает новый, сохраняет его в контексте
+// обработчика и возвращает клиенту в заголовках ответа, в том числе при ошибке
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var requestId string
+		if values := metadata.ValueFromIncomingContext(ctx, MetadataKey); len(values) != 0 {
+			requestId = values[0]
+		}
+		requestId = resolve(requestId)
+		grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, requestId))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", requestId))
+		return handler(NewContext(ctx, requestId), req)
+	}
+}
@@ -0,0 +1,145 @@
+package requestid
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		generate bool
+	}{
+		{name: "kept", header: "client-request.1:a_b"},
+		{name: "missing", header: "", generate: true},
+		{name: "too long", header: strings.Repeat("a", maxLength+1), generate: true},
+		{name: "invalid characters", header: "id with spaces", generate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			var md metadata.MD
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = FromContext(r.Context())
+				md = GatewayMetadata(r.Context(), r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			got := w.Header().Get(Header)
+			if tt.generate {
+				if _, err := uuid.Parse(got); err != nil {
+					t.Fatalf("generated request id %q: %v", got, err)
+				}
+			} else if got != tt.header {
+				t.Fatalf("response request id = %q, want %q", got, tt.header)
+			}
+			//обработчик и метаданные gRPC запроса получают тот же идентификатор, что и клиент
+			if fromContext != got {
+				t.Fatalf("request id in context = %q, want %q", fromContext, got)
+			}
+			if values := md.Get(MetadataKey); len(values) != 1 || values[0] != got {
+				t.Fatalf("gateway metadata = %v, want %q", md, got)
+			}
+		})
+	}
+}
+
+func TestGatewayMetadataWithoutRequestId(t *testing.T) {
+	if md := GatewayMetadata(context.Background(), httptest.NewRequest(http.MethodGet, "/", nil)); md != nil {
+		t.Fatalf("GatewayMetadata = %v, want nil", md)
+	}
+}
+
+// healthServer запоминает идентификатор запроса из контекста обработчика и возвращает ошибку при fail
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	requestId string
+	fail      bool
+}
+
+func (s *healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.requestId = FromContext(ctx)
+	if s.fail {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor()))
+	health := &healthServer{}
+	grpc_health_v1.RegisterHealthServer(server, health)
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	tests := []struct {
+		name      string
+		requestId string
+		fail      bool
+		generate  bool
+	}{
+		{name: "kept", requestId: "client-request-1"},
+		{name: "missing", generate: true},
+		{name: "invalid", requestId: "id with spaces", generate: true},
+		{name: "kept on error", requestId: "client-request-2", fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health.fail = tt.fail
+			ctx := context.Background()
+			if tt.requestId != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, tt.requestId)
+			}
+			var header metadata.MD
+			_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Header(&header))
+			if tt.fail != (err != nil) {
+				t.Fatalf("Check: %v", err)
+			}
+
+			//идентификатор возвращается в заголовках ответа, в том числе при ошибке
+			values := header.Get(MetadataKey)
+			if len(values) != 1 {
+				t.Fatalf("response header = %v", header)
+			}
+			if tt.generate {
+				if _, err := uuid.Parse(values[0]); err != nil {
+					t.Fatalf("generated request id %q: %v", values[0], err)
+				}
+			} else if values[0] != tt.requestId {
+				t.Fatalf("response request id = %q, want %q", values[0], tt.requestId)
+			}
+			if health.requestId != values[0] {
+				t.Fatalf("request id in handler context = %q, want %q", health.requestId, values[0])
+			}
+		})
+	}
+}
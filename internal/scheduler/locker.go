@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+)
+
+// Locker - блокировка задач планировщика. Несколько экземпляров сервиса запускают одни и те же задачи,
+// блокировка гарантирует, что задача не выполняется одновременно на двух экземплярах.
+// В PostgreSQL реализуется advisory lock (store.Store), для одного узла достаточно MemoryLocker
+type Locker interface {
+	// TryLock захватывает блокировку задачи name без ожидания. ok=false, если ее удерживает другой экземпляр
+	TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error)
+}
+
+// MemoryLocker - блокировка в пределах процесса для запуска на одном узле
+type MemoryLocker struct {
+	mu     sync.Mutex
+	locked map[string]bool
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locked: map[string]bool{},
+	}
+}
+
+func (l *MemoryLocker) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locked[name] {
+		return nil, false, nil
+	}
+	l.locked[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.locked, name)
+	}, true, nil
+}
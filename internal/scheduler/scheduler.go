@@ -1,49 +1,381 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"log/slog"
+	"math/rand/v2"
+	"os"
 	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+	"skillsRockGRPC/internal/tracing"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrStopped     = errors.New("scheduler is stopped")
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job is already running")
+)
+
+// Имена задач, по ним задаются настройки config.Scheduler.Jobs
+const (
+	JobRemoveRefreshTokens = "removeRefreshTokens"
+	JobRemoveAuditEvents   = "removeAuditEvents"
+	JobRelayOutbox         = "relayOutbox"
+	JobDeliverWebhooks     = "deliverWebhooks"
 )
 
+// JobFunc - задача планировщика. now - время запуска, возвращается количество обработанных записей
+type JobFunc func(ctx context.Context, now time.Time) (int64, error)
+
+// JobRunStore хранит последний запуск каждой задачи, общий для всех экземпляров сервиса
+type JobRunStore interface {
+	GetJobRun(ctx context.Context, name string) (*entity.JobRun, error)
+	SaveJobRun(ctx context.Context, dto *dto.SaveJobRun) error
+}
+
+type job struct {
+	name      string
+	interval  func(cfg *config.Scheduler) time.Duration
+	fn        JobFunc
+	settings  atomic.Pointer[jobSettings]
+	running   atomic.Bool
+	nextRunAt atomic.Pointer[time.Time]
+	chReload  chan struct{}
+}
+
+// jobSettings - расписание и параметры запуска задачи, заменяются целиком при перезагрузке конфигурации
+type jobSettings struct {
+	spec     string
+	schedule cron.Schedule
+	cfg      config.Job
+}
+
+// newJobSettings возвращает настройки задачи из cfg.Jobs, без расписания задача выполняется с интервалом по умолчанию
+func newJobSettings(cfg *config.Scheduler, j *job) (*jobSettings, error) {
+	jobCfg := cfg.Jobs[j.name]
+	spec := jobCfg.Schedule
+	if spec == "" {
+		spec = "@every " + j.interval(cfg).String()
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("job '%s' schedule: %w", j.name, err)
+	}
+	return &jobSettings{
+		spec:     spec,
+		schedule: schedule,
+		cfg:      jobCfg,
+	}, nil
+}
+
+// period возвращает интервал между запусками задачи по расписанию после момента t
+func (js *jobSettings) period(t time.Time) time.Duration {
+	next := js.schedule.Next(t)
+	return js.schedule.Next(next).Sub(next)
+}
+
 type Scheduler struct {
-	lg     *slog.Logger
-	cfg    *config.Scheduler
-	wg     *sync.WaitGroup
-	chStop chan struct{}
-}
-
-func New(lg *slog.Logger, cfg *config.Scheduler) *Scheduler {
-	return &Scheduler{
-		lg:     lg,
-		cfg:    cfg,
-		wg:     &sync.WaitGroup{},
-		chStop: make(chan struct{}, 1),
-	}
-}
-
-func (s *Scheduler) RemoveRefreshTokens(fn func(time.Time) (int64, error)) {
-	s.wg.Add(1)
-	go func() {
-		s.lg.Info("SCHEDULER: task 'RemoveRefreshTokens' start", slog.Any("interval", s.cfg.TimeoutRemoveRefreshTokens))
-		for {
-			select {
-			case <-s.chStop:
-				s.lg.Info("SCHEDULER: task 'RemoveRefreshTokens' stop")
-				s.wg.Done()
-				return
-			case <-time.After(s.cfg.TimeoutRemoveRefreshTokens):
-				count, err := fn(time.Now())
-				if err != nil {
-					s.lg.Error("SCHEDULER: task 'RemoveRefreshTokens' exec error", slog.Any("error", err))
-				}
-				s.lg.Info("SCHEDULER: task 'RemoveRefreshTokens' exec success", slog.Any("rows affected", count))
+	lg       *slog.Logger
+	cfg      atomic.Pointer[config.Scheduler]
+	locker   Locker
+	jobRuns  JobRunStore
+	instance string
+	jobs     []*job
+	wg       *sync.WaitGroup
+	//ctx задач отменяется в Stop
+	ctx      context.Context
+	cancel   context.CancelFunc
+	chStop   chan struct{}
+	stopOnce sync.Once
+	stopped  atomic.Bool
+}
+
+func New(lg *slog.Logger, cfg *config.Scheduler, locker Locker, jobRuns JobRunStore) *Scheduler {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		lg:       lg,
+		locker:   locker,
+		jobRuns:  jobRuns,
+		instance: fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		wg:       &sync.WaitGroup{},
+		ctx:      ctx,
+		cancel:   cancel,
+		chStop:   make(chan struct{}, 1),
+	}
+	s.cfg.Store(cfg)
+	return s
+}
+
+// Register добавляет задачу name. Расписание задачи берется из config.Scheduler.Jobs, без него задача
+// выполняется каждые interval. Задачи регистрируются до вызова Start
+func (s *Scheduler) Register(name string, interval time.Duration, fn JobFunc) {
+	s.register(name, func(*config.Scheduler) time.Duration { return interval }, fn)
+}
+func (s *Scheduler) register(name string, interval func(cfg *config.Scheduler) time.Duration, fn JobFunc) {
+	j := &job{
+		name:     name,
+		interval: interval,
+		fn:       fn,
+		chReload: make(chan struct{}, 1),
+	}
+	settings, err := newJobSettings(s.cfg.Load(), j)
+	if err != nil {
+		log.Fatalf("SCHEDULER: %v\n", err)
+	}
+	j.settings.Store(settings)
+	s.jobs = append(s.jobs, j)
+}
+
+// RemoveRefreshTokens удаляет истекшие и отозванные refresh токены
+func (s *Scheduler) RemoveRefreshTokens(fn JobFunc) {
+	s.register(JobRemoveRefreshTokens, func(cfg *config.Scheduler) time.Duration { return cfg.TimeoutRemoveRefreshTokens }, fn)
+}
+
+// RemoveAuditEvents удаляет события аудита старше срока хранения
+func (s *Scheduler) RemoveAuditEvents(fn JobFunc) {
+	s.register(JobRemoveAuditEvents, func(cfg *config.Scheduler) time.Duration { return cfg.TimeoutRemoveAuditEvents }, func(ctx context.Context, now time.Time) (int64, error) {
+		return fn(ctx, now.Add(-s.cfg.Load().AuditEventsRetention))
+	})
+}
+
+// RelayOutbox публикует события из outbox
+func (s *Scheduler) RelayOutbox(fn JobFunc) {
+	s.register(JobRelayOutbox, func(cfg *config.Scheduler) time.Duration { return cfg.TimeoutRelayOutbox }, fn)
+}
+
+// DeliverWebhooks отправляет события подписчикам вебхуков
+func (s *Scheduler) DeliverWebhooks(fn JobFunc) {
+	s.register(JobDeliverWebhooks, func(cfg *config.Scheduler) time.Duration { return cfg.TimeoutDeliverWebhooks }, fn)
+}
+
+// Start запускает выполнение зарегистрированных задач по расписанию
+func (s *Scheduler) Start() {
+	s.checkJobNames(s.cfg.Load())
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.run(j)
+	}
+}
+
+// Reload применяет новые расписания и параметры задач. Выполняющийся запуск не прерывается, следующий
+// запуск планируется по новому расписанию. При ошибке в расписании любой задачи не меняется ничего
+func (s *Scheduler) Reload(cfg *config.Scheduler) error {
+	settings := make([]*jobSettings, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobSettings, err := newJobSettings(cfg, j)
+		if err != nil {
+			return err
+		}
+		settings = append(settings, jobSettings)
+	}
+	s.cfg.Store(cfg)
+	for i, j := range s.jobs {
+		j.settings.Store(settings[i])
+		select {
+		case j.chReload <- struct{}{}:
+		default:
+		}
+	}
+	s.checkJobNames(cfg)
+	return nil
+}
+func (s *Scheduler) checkJobNames(cfg *config.Scheduler) {
+	for name := range cfg.Jobs {
+		if s.job(name) == nil {
+			s.lg.Warn("SCHEDULER: job '" + name + "' from config is not registered")
+		}
+	}
+}
+func (s *Scheduler) run(j *job) {
+	defer s.wg.Done()
+	settings := j.settings.Load()
+	s.lg.Info("SCHEDULER: job '"+j.name+"' start", slog.String("schedule", settings.spec), slog.Bool("disabled", settings.cfg.Disabled))
+	if settings.cfg.RunOnStart && !settings.cfg.Disabled {
+		s.exec(s.ctx, j, false)
+	}
+	for {
+		//отключенная задача ожидает перезагрузки конфигурации или остановки
+		var timer *time.Timer
+		var chNext <-chan time.Time
+		if settings := j.settings.Load(); settings.cfg.Disabled {
+			j.nextRunAt.Store(nil)
+		} else {
+			next := settings.schedule.Next(time.Now())
+			if settings.cfg.Jitter > 0 {
+				next = next.Add(rand.N(settings.cfg.Jitter))
 			}
+			j.nextRunAt.Store(&next)
+			timer = time.NewTimer(time.Until(next))
+			chNext = timer.C
+		}
+		select {
+		case <-s.chStop:
+			s.lg.Info("SCHEDULER: job '" + j.name + "' stop")
+			return
+		case <-j.chReload:
+			settings := j.settings.Load()
+			s.lg.Info("SCHEDULER: job '"+j.name+"' reloaded", slog.String("schedule", settings.spec), slog.Bool("disabled", settings.cfg.Disabled))
+		case <-chNext:
+			s.exec(s.ctx, j, false)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// exec выполняет задачу под блокировкой. Экземпляры сервиса отсчитывают расписание независимо, поэтому
+// запуск по расписанию пропускается, если в текущем интервале задачу уже выполнил другой экземпляр:
+// последний запуск был меньше половины интервала назад. force отключает эту проверку.
+// Возвращает nil без ошибки, если запуск пропущен
+func (s *Scheduler) exec(ctx context.Context, j *job, force bool) (*entity.JobRun, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler "+j.name)
+	defer span.End()
+	if !j.running.CompareAndSwap(false, true) {
+		s.lg.WarnContext(ctx, "SCHEDULER: job '"+j.name+"' previous run is not finished")
+		return nil, ErrJobRunning
+	}
+	defer j.running.Store(false)
+	settings := j.settings.Load()
+	unlock, ok, err := s.locker.TryLock(ctx, j.name)
+	if err != nil {
+		spanError(span, err)
+		s.lg.ErrorContext(ctx, "SCHEDULER: job '"+j.name+"' lock error", slog.Any("error", err))
+		return nil, err
+	}
+	if !ok {
+		s.lg.DebugContext(ctx, "SCHEDULER: job '"+j.name+"' is running on another instance")
+		return nil, ErrJobRunning
+	}
+	defer unlock()
+	startedAt := time.Now()
+	if !force {
+		last, err := s.jobRuns.GetJobRun(ctx, j.name)
+		if err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
+			spanError(span, err)
+			s.lg.ErrorContext(ctx, "SCHEDULER: job '"+j.name+"' last run is not loaded", slog.Any("error", err))
+			return nil, err
+		}
+		if err == nil && startedAt.Sub(last.StartedAt) < settings.period(startedAt)/2 {
+			s.lg.DebugContext(ctx, "SCHEDULER: job '"+j.name+"' is already executed", slog.String("instance", last.Instance))
+			return nil, nil
+		}
+	}
+	jobCtx := ctx
+	if settings.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		jobCtx, cancel = context.WithTimeout(ctx, settings.cfg.Timeout)
+		defer cancel()
+	}
+	count, err := j.fn(jobCtx, startedAt)
+	run := &entity.JobRun{
+		Name:         j.name,
+		Instance:     s.instance,
+		StartedAt:    startedAt,
+		Duration:     time.Since(startedAt),
+		Outcome:      entity.JobOutcomeSuccess,
+		RowsAffected: count,
+	}
+	if err != nil {
+		run.Outcome, run.Error = entity.JobOutcomeFailure, err.Error()
+		spanError(span, err)
+		s.lg.ErrorContext(ctx, "SCHEDULER: job '"+j.name+"' exec error", slog.Any("error", err), slog.Any("duration", run.Duration))
+	} else {
+		s.lg.InfoContext(ctx, "SCHEDULER: job '"+j.name+"' exec success", slog.Any("rows affected", count), slog.Any("duration", run.Duration))
+	}
+	//запуск, прерванный остановкой планировщика, тоже записывается
+	if err := s.jobRuns.SaveJobRun(context.WithoutCancel(ctx), &dto.SaveJobRun{
+		Name:         run.Name,
+		Instance:     run.Instance,
+		StartedAt:    run.StartedAt,
+		Duration:     run.Duration,
+		Outcome:      run.Outcome,
+		Error:        run.Error,
+		RowsAffected: run.RowsAffected,
+	}); err != nil {
+		s.lg.ErrorContext(ctx, "SCHEDULER: job '"+j.name+"' run is not recorded", slog.Any("error", err))
+	}
+	return run, nil
+}
+
+// Run выполняет задачу name вне расписания. Ошибка выполнения задачи возвращается в JobRun,
+// ErrJobRunning - задача уже выполняется на этом или другом экземпляре сервиса
+func (s *Scheduler) Run(ctx context.Context, name string) (*entity.JobRun, error) {
+	if s.stopped.Load() {
+		return nil, ErrStopped
+	}
+	j := s.job(name)
+	if j == nil {
+		return nil, ErrJobNotFound
+	}
+	//отмена запроса не прерывает задачу, время выполнения ограничивает Timeout задачи и остановка планировщика
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	defer context.AfterFunc(s.ctx, cancel)()
+	return s.exec(ctx, j, true)
+}
+
+// Jobs возвращает зарегистрированные задачи. Running отражает выполнение только на этом экземпляре
+func (s *Scheduler) Jobs(ctx context.Context) ([]*entity.Job, error) {
+	jobs := make([]*entity.Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		settings := j.settings.Load()
+		job := &entity.Job{
+			Name:      j.name,
+			Schedule:  settings.spec,
+			Disabled:  settings.cfg.Disabled,
+			Running:   j.running.Load(),
+			NextRunAt: j.nextRunAt.Load(),
 		}
-	}()
+		last, err := s.jobRuns.GetJobRun(ctx, j.name)
+		if err != nil && !errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, err
+		}
+		job.LastRun = last
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+func (s *Scheduler) job(name string) *job {
+	for _, j := range s.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
 }
+
+// Stop отменяет контекст выполняющихся задач и дожидается их завершения
 func (s *Scheduler) Stop() {
-	close(s.chStop)
-	s.wg.Wait()
+	s.stopOnce.Do(func() {
+		s.stopped.Store(true)
+		close(s.chStop)
+		s.cancel()
+		s.wg.Wait()
+	})
+}
+
+// Check сообщает, выполняет ли планировщик задачи
+func (s *Scheduler) Check(ctx context.Context) error {
+	if s.stopped.Load() {
+		return ErrStopped
+	}
+	return nil
+}
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
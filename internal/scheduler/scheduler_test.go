@@ -0,0 +1,290 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+)
+
+// jobRunStore хранит последние запуски задач в памяти
+type jobRunStore struct {
+	mu   sync.Mutex
+	runs map[string]*entity.JobRun
+}
+
+func newJobRunStore() *jobRunStore {
+	return &jobRunStore{runs: map[string]*entity.JobRun{}}
+}
+func (s *jobRunStore) GetJobRun(ctx context.Context, name string) (*entity.JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[name]
+	if !ok {
+		return nil, repository.ErrRecordNotFound
+	}
+	return run, nil
+}
+func (s *jobRunStore) SaveJobRun(ctx context.Context, dto *dto.SaveJobRun) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[dto.Name] = &entity.JobRun{
+		Name:      dto.Name,
+		Instance:  dto.Instance,
+		StartedAt: dto.StartedAt,
+		Outcome:   dto.Outcome,
+		Error:     dto.Error,
+	}
+	return nil
+}
+
+func newScheduler(cfg *config.Scheduler) (*Scheduler, *jobRunStore) {
+	jobRuns := newJobRunStore()
+	return New(slog.New(slog.DiscardHandler), cfg, NewMemoryLocker(), jobRuns), jobRuns
+}
+
+// countingJob считает запуски задачи
+func countingJob(calls *atomic.Int32) JobFunc {
+	return func(ctx context.Context, now time.Time) (int64, error) {
+		calls.Add(1)
+		return 1, nil
+	}
+}
+
+func TestRegister(t *testing.T) {
+	s, _ := newScheduler(&config.Scheduler{
+		TimeoutRelayOutbox: 5 * time.Second,
+		Jobs: map[string]config.Job{
+			"nightly":      {Schedule: "0 3 * * *", Timeout: time.Minute},
+			JobRelayOutbox: {Disabled: true},
+		},
+	})
+	var calls atomic.Int32
+	s.Register("nightly", time.Hour, countingJob(&calls))
+	s.Register("hourly", time.Hour, countingJob(&calls))
+	s.RelayOutbox(countingJob(&calls))
+
+	jobs, err := s.Jobs(context.Background())
+	if err != nil {
+		t.Fatalf("Jobs: %v", err)
+	}
+	want := []entity.Job{
+		{Name: "nightly", Schedule: "0 3 * * *"},
+		{Name: "hourly", Schedule: "@every 1h0m0s"},
+		{Name: JobRelayOutbox, Schedule: "@every 5s", Disabled: true},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("Jobs = %d jobs, want %d", len(jobs), len(want))
+	}
+	for i, job := range jobs {
+		if job.Name != want[i].Name || job.Schedule != want[i].Schedule || job.Disabled != want[i].Disabled || job.LastRun != nil {
+			t.Fatalf("job %d = %+v, want %+v", i, job, want[i])
+		}
+	}
+	if s.job("nightly").settings.Load().cfg.Timeout != time.Minute {
+		t.Fatal("job settings are not taken from config")
+	}
+
+	run, err := s.Run(context.Background(), "hourly")
+	if err != nil || run.Outcome != entity.JobOutcomeSuccess || run.RowsAffected != 1 || calls.Load() != 1 {
+		t.Fatalf("Run = %+v, %v", run, err)
+	}
+	jobs, _ = s.Jobs(context.Background())
+	if jobs[1].LastRun == nil || jobs[1].LastRun.StartedAt != run.StartedAt {
+		t.Fatalf("last run = %+v", jobs[1].LastRun)
+	}
+	if _, err := s.Run(context.Background(), "unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("Run(unknown) error = %v", err)
+	}
+}
+
+func TestExecSkipsRecentRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		lastRun time.Duration
+		force   bool
+		want    bool
+	}{
+		{name: "first run", want: true},
+		{name: "run in current period", lastRun: 10 * time.Minute},
+		{name: "run just under half period", lastRun: 29 * time.Minute},
+		{name: "run over half period", lastRun: 31 * time.Minute, want: true},
+		{name: "forced run", lastRun: time.Minute, force: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, jobRuns := newScheduler(&config.Scheduler{})
+			var calls atomic.Int32
+			s.Register("hourly", time.Hour, countingJob(&calls))
+			if tt.lastRun != 0 {
+				jobRuns.runs["hourly"] = &entity.JobRun{Name: "hourly", Instance: "other", StartedAt: time.Now().Add(-tt.lastRun)}
+			}
+			run, err := s.exec(context.Background(), s.job("hourly"), tt.force)
+			if err != nil {
+				t.Fatalf("exec: %v", err)
+			}
+			if got := calls.Load() == 1; got != tt.want || (run != nil) != tt.want {
+				t.Fatalf("exec ran job = %v (run %+v), want %v", got, run, tt.want)
+			}
+			if tt.want && jobRuns.runs["hourly"].Instance != s.instance {
+				t.Fatalf("saved run = %+v", jobRuns.runs["hourly"])
+			}
+		})
+	}
+}
+
+func TestExecLockContention(t *testing.T) {
+	s, jobRuns := newScheduler(&config.Scheduler{})
+	var calls atomic.Int32
+	s.Register("hourly", time.Hour, countingJob(&calls))
+
+	//блокировку удерживает другой экземпляр
+	unlock, ok, err := s.locker.TryLock(context.Background(), "hourly")
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v", ok, err)
+	}
+	if _, err := s.Run(context.Background(), "hourly"); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("Run under foreign lock error = %v", err)
+	}
+	unlock()
+	if calls.Load() != 0 || len(jobRuns.runs) != 0 {
+		t.Fatalf("job ran under foreign lock: calls = %d", calls.Load())
+	}
+
+	//запуск на этом экземпляре не начинается, пока не завершен предыдущий
+	chStarted, chRelease := make(chan struct{}), make(chan struct{})
+	s.Register("blocking", time.Hour, func(ctx context.Context, now time.Time) (int64, error) {
+		close(chStarted)
+		<-chRelease
+		return 0, nil
+	})
+	chErr := make(chan error, 1)
+	go func() {
+		_, err := s.Run(context.Background(), "blocking")
+		chErr <- err
+	}()
+	<-chStarted
+	if _, err := s.Run(context.Background(), "blocking"); !errors.Is(err, ErrJobRunning) {
+		t.Fatalf("concurrent Run error = %v", err)
+	}
+	jobs, _ := s.Jobs(context.Background())
+	if !jobs[1].Running {
+		t.Fatal("job is not reported as running")
+	}
+	close(chRelease)
+	if err := <-chErr; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	//блокировка освобождается после запуска
+	if _, err := s.Run(context.Background(), "hourly"); err != nil || calls.Load() != 1 {
+		t.Fatalf("Run after unlock = %v, calls = %d", err, calls.Load())
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	s, _ := newScheduler(&config.Scheduler{Jobs: map[string]config.Job{"slow": {Timeout: 10 * time.Millisecond}}})
+	s.Register("slow", time.Hour, func(ctx context.Context, now time.Time) (int64, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	run, err := s.Run(context.Background(), "slow")
+	if err != nil || run.Outcome != entity.JobOutcomeFailure || run.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("Run = %+v, %v", run, err)
+	}
+}
+
+func TestStopCancelsJobs(t *testing.T) {
+	s, jobRuns := newScheduler(&config.Scheduler{Jobs: map[string]config.Job{"scheduled": {RunOnStart: true}}})
+	chStarted := make(chan string, 2)
+	blocking := func(name string) JobFunc {
+		return func(ctx context.Context, now time.Time) (int64, error) {
+			chStarted <- name
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+	}
+	s.Register("scheduled", time.Hour, blocking("scheduled"))
+	s.Register("manual", time.Hour, blocking("manual"))
+	s.Start()
+	<-chStarted
+	type result struct {
+		run *entity.JobRun
+		err error
+	}
+	chRun := make(chan result, 1)
+	go func() {
+		//отмена запроса не прерывает задачу
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		run, err := s.Run(ctx, "manual")
+		chRun <- result{run, err}
+	}()
+	<-chStarted
+
+	chStopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(chStopped)
+	}()
+	select {
+	case <-chStopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not cancel running jobs")
+	}
+	manual := <-chRun
+	if manual.err != nil || manual.run.Error != context.Canceled.Error() {
+		t.Fatalf("manual Run = %+v, %v", manual.run, manual.err)
+	}
+	//прерванный запуск записан
+	if run := jobRuns.runs["scheduled"]; run == nil || run.Outcome != entity.JobOutcomeFailure || run.Error != context.Canceled.Error() {
+		t.Fatalf("scheduled run = %+v", run)
+	}
+	if _, err := s.Run(context.Background(), "manual"); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Run after Stop error = %v", err)
+	}
+	if err := s.Check(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Check after Stop = %v", err)
+	}
+	//повторная остановка, например при завершении сервиса и в defer, не паникует
+	s.Stop()
+}
+
+func TestReload(t *testing.T) {
+	s, _ := newScheduler(&config.Scheduler{TimeoutRelayOutbox: 5 * time.Second})
+	var calls atomic.Int32
+	s.RelayOutbox(countingJob(&calls))
+	s.Register("hourly", time.Hour, countingJob(&calls))
+
+	err := s.Reload(&config.Scheduler{TimeoutRelayOutbox: time.Second, Jobs: map[string]config.Job{
+		"hourly": {Schedule: "0 * * * *", Disabled: true, Timeout: time.Minute},
+	}})
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	relay, hourly := s.job(JobRelayOutbox).settings.Load(), s.job("hourly").settings.Load()
+	if relay.spec != "@every 1s" || hourly.spec != "0 * * * *" || !hourly.cfg.Disabled || hourly.cfg.Timeout != time.Minute {
+		t.Fatalf("settings after Reload: %s %+v, %s %+v", relay.spec, relay.cfg, hourly.spec, hourly.cfg)
+	}
+
+	//ошибка в расписании одной задачи не меняет ни одну задачу
+	err = s.Reload(&config.Scheduler{TimeoutRelayOutbox: 10 * time.Second, Jobs: map[string]config.Job{
+		"hourly": {Schedule: "every hour"},
+	}})
+	if err == nil {
+		t.Fatal("Reload with invalid schedule succeeded")
+	}
+	if s.job(JobRelayOutbox).settings.Load() != relay || s.job("hourly").settings.Load() != hourly || s.cfg.Load().TimeoutRelayOutbox != time.Second {
+		t.Fatal("invalid config is partially applied")
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/forwarded"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuditSink - получатель событий журнала аудита. Ошибка записи не должна прерывать обработку запроса,
+// поэтому Record ничего не возвращает
+type AuditSink interface {
+	Record(ctx context.Context, event *entity.AuditEvent)
+}
+
+// StoreAuditSink сохраняет события аудита в хранилище
+type StoreAuditSink struct {
+	store repository.Repository
+	lg    *slog.Logger
+}
+
+func NewStoreAuditSink(store repository.Repository, lg *slog.Logger) *StoreAuditSink {
+	return &StoreAuditSink{
+		store: store,
+		lg:    lg,
+	}
+}
+
+func (a *StoreAuditSink) Record(ctx context.Context, event *entity.AuditEvent) {
+	if err := a.store.AddAuditEvent(context.WithoutCancel(ctx), &dto.AddAuditEvent{
+		EventType: event.EventType,
+		UserId:    event.UserId,
+		Login:     event.Login,
+		ActorId:   event.ActorId,
+		Ip:        event.Ip,
+		UserAgent: event.UserAgent,
+		Outcome:   event.Outcome,
+		Details:   event.Details,
+		CreatedAt: event.CreatedAt,
+	}); err != nil {
+		a.lg.ErrorContext(ctx, "SERVICE: audit event is not recorded", slog.String("eventType", event.EventType), slog.Any("error", err))
+	}
+}
+
+// audit дополняет событие данными клиента и результатом обработки запроса и передает его в AuditSink
+func (s *Service) audit(ctx context.Context, event *entity.AuditEvent, err error) {
+	event.Ip, event.UserAgent = clientInfo(ctx)
+	event.CreatedAt = time.Now()
+	event.Outcome = entity.AuditOutcomeSuccess
+	if err != nil {
+		event.Outcome = entity.AuditOutcomeFailure
+		event.Details = status.Convert(err).Message()
+	}
+	if event.ActorId == "" && event.UserId != nil {
+		event.ActorId = event.UserId.String()
+	}
+	s.auditSink.Record(ctx, event)
+}
+
+// clientInfo возвращает адрес и user agent клиента. Адрес клиента шлюза принимается только от шлюза,
+// user agent за шлюзом передается в метаданных grpcgateway-user-agent
+func clientInfo(ctx context.Context) (string, string) {
+	var userAgent string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("grpcgateway-user-agent"); len(values) != 0 {
+		userAgent = values[0]
+	} else if values := md.Get("user-agent"); len(values) != 0 {
+		userAgent = values[0]
+	}
+	return forwarded.ClientIp(ctx), userAgent
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/pkg/jwt"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// authenticate проверяет токен доступа из заголовка "authorization: Bearer <token>"
+func (s *Service) authenticate(ctx context.Context) (*jwt.TokenClaims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidAccessToken)
+	}
+	tokenString, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidAccessToken)
+	}
+	claims, err := jwt.ParseToken(tokenString, s.publicKey)
+	if err != nil || claims.TokenType != "access" || claims.Sub == nil {
+		return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidAccessToken)
+	}
+	return claims, nil
+}
+
+// authorizeUser пропускает собственный токен пользователя userId или токен администратора
+func (s *Service) authorizeUser(ctx context.Context, userId *uuid.UUID) (*jwt.TokenClaims, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if *claims.Sub == *userId && claims.Act == nil && len(claims.Audience) == 0 {
+		return claims, nil
+	}
+	return s.authorizeAdmin(ctx)
+}
+
+// authorizeAdmin пропускает только собственные токены пользователей с ролью admin. Токены, выпущенные
+// через обмен или имперсонацию (с claim "act"), прав администратора не дают
+func (s *Service) authorizeAdmin(ctx context.Context) (*jwt.TokenClaims, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAdmin(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkAdmin проверяет права администратора у проверенного токена claims
+func (s *Service) checkAdmin(ctx context.Context, claims *jwt.TokenClaims) error {
+	if claims.Act != nil || len(claims.Audience) != 0 {
+		return servererrors.Status(codes.PermissionDenied, servererrors.ErrPermissionDenied)
+	}
+	user, err := s.store.GetUser(ctx, claims.Sub)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return servererrors.Status(codes.PermissionDenied, servererrors.ErrPermissionDenied)
+		}
+		return s.internalError(ctx, err)
+	}
+	if user.Role != entity.RoleAdmin {
+		return servererrors.Status(codes.PermissionDenied, servererrors.ErrPermissionDenied)
+	}
+	return nil
+}
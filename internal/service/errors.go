@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/pkg/servererrors"
+	"time"
+)
+
+// Рекомендуемая клиенту задержка перед повтором запроса при недоступности хранилища
+const storeRetryDelay = time.Second
+
+// internalError записывает причину ошибки в журнал и возвращает клиенту статус без подробностей.
+// Недоступность хранилища возвращается как Unavailable с рекомендуемой задержкой перед повтором
+func (s *Service) internalError(ctx context.Context, err error) error {
+	if errors.Is(err, repository.ErrUnavailable) {
+		s.lg.WarnContext(ctx, "SERVICE: store is unavailable", slog.Any("error", err))
+		return servererrors.Unavailable(storeRetryDelay)
+	}
+	s.lg.ErrorContext(ctx, "SERVICE: internal error", slog.Any("error", err))
+	return servererrors.Internal()
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	auth "skillsRockGRPC/grpc/gen"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/scheduler"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+)
+
+// Jobs - задачи планировщика, доступные администратору
+type Jobs interface {
+	Jobs(ctx context.Context) ([]*entity.Job, error)
+	Run(ctx context.Context, name string) (*entity.JobRun, error)
+}
+
+func (s *Service) ListJobs(ctx context.Context, req *auth.ListJobsRequest) (*auth.ListJobsResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	schedulerJobs, err := s.jobs.Jobs(ctx)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	jobs := make([]*auth.Job, 0, len(schedulerJobs))
+	for _, schedulerJob := range schedulerJobs {
+		job := &auth.Job{
+			Name:     schedulerJob.Name,
+			Schedule: schedulerJob.Schedule,
+			Disabled: schedulerJob.Disabled,
+			Running:  schedulerJob.Running,
+			LastRun:  jobRun(schedulerJob.LastRun),
+		}
+		if schedulerJob.NextRunAt != nil {
+			job.NextRunAt = schedulerJob.NextRunAt.Format(time.RFC3339)
+		}
+		jobs = append(jobs, job)
+	}
+	return &auth.ListJobsResponse{Jobs: jobs}, nil
+}
+
+// RunJob выполняет задачу немедленно и дожидается ее завершения. Ошибка задачи возвращается в результате запуска
+func (s *Service) RunJob(ctx context.Context, req *auth.RunJobRequest) (*auth.RunJobResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	run, err := s.jobs.Run(ctx, req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrJobNotFound):
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrJobNotFound)
+		case errors.Is(err, scheduler.ErrJobRunning):
+			return nil, servererrors.Status(codes.Aborted, servererrors.ErrJobRunning)
+		}
+		return nil, s.internalError(ctx, err)
+	}
+	return &auth.RunJobResponse{Run: jobRun(run)}, nil
+}
+func jobRun(run *entity.JobRun) *auth.JobRun {
+	if run == nil {
+		return nil
+	}
+	return &auth.JobRun{
+		Instance:     run.Instance,
+		StartedAt:    run.StartedAt.Format(time.RFC3339),
+		DurationMs:   run.Duration.Milliseconds(),
+		Outcome:      run.Outcome,
+		Error:        run.Error,
+		RowsAffected: run.RowsAffected,
+	}
+}
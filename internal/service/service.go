@@ -3,209 +3,525 @@ package service
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/subtle"
 	"log"
 	"log/slog"
 	auth "skillsRockGRPC/grpc/gen"
 	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/metrics"
+	"skillsRockGRPC/internal/password"
 	"skillsRockGRPC/internal/repository"
 	"skillsRockGRPC/internal/repository/dto"
 
 	"skillsRockGRPC/pkg/jwt"
 	"skillsRockGRPC/pkg/secure"
 	"skillsRockGRPC/pkg/servererrors"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+)
+
+// Время жизни токена имперсонации не настраивается
+const (
+	impersonationLifetime   = 15 * time.Minute
+	impersonationDeviceCode = "impersonation"
+)
+
+// sessionNamespace - пространство имен UUID v5 идентификаторов сессий
+var sessionNamespace = uuid.MustParse("5b0f1f7e-3c2a-4d8e-9a61-2f4c7d9e8b13")
+
+const (
+	defaultAuditEventsLimit = 100
+	maxAuditEventsLimit     = 1000
 )
 
 type Service struct {
 	auth.UnimplementedAuthServiceServer
-	store           repository.Repository
-	privateKey      *rsa.PrivateKey
-	accessLifetime  time.Duration
-	refrashLifetime time.Duration
-	lg              *slog.Logger
+	store          repository.Repository
+	privateKey     *rsa.PrivateKey
+	publicKey      *rsa.PublicKey
+	tokens         atomic.Pointer[tokenSettings]
+	auditSink      AuditSink
+	passwordPolicy *password.Policy
+	jobs           Jobs
+	lg             *slog.Logger
 }
 
-func MustNew(store repository.Repository, lg *slog.Logger, cfg *config.Token) *Service {
-	privateKey, err := secure.LoadPrivateKey(cfg.PrivateKeyPath)
+func MustNew(store repository.Repository, auditSink AuditSink, passwordPolicy *password.Policy, jobs Jobs, lg *slog.Logger, cfg *config.Token) *Service {
+	var privateKey *rsa.PrivateKey
+	var err error
+	if cfg.PrivateKey != "" {
+		privateKey, err = secure.ParsePrivateKey([]byte(cfg.PrivateKey))
+	} else {
+		privateKey, err = secure.LoadPrivateKey(cfg.PrivateKeyPath)
+	}
 	if err != nil {
 		log.Fatalf("SERVICE: %v\n", err)
 	}
 
-	return &Service{
-		store:           store,
-		privateKey:      privateKey,
-		accessLifetime:  cfg.AccessLifetime,
-		refrashLifetime: cfg.RefreshLifetime,
-		lg:              lg,
+	s := &Service{
+		store:          store,
+		privateKey:     privateKey,
+		publicKey:      &privateKey.PublicKey,
+		auditSink:      auditSink,
+		passwordPolicy: passwordPolicy,
+		jobs:           jobs,
+		lg:             lg,
+	}
+	s.Reload(cfg)
+	return s
+}
+
+// tokenSettings - параметры выпуска токенов, заменяются целиком при перезагрузке конфигурации
+type tokenSettings struct {
+	accessLifetime   time.Duration
+	refrashLifetime  time.Duration
+	exchangeLifetime time.Duration
+	exchangeActors   map[string]config.Actor
+}
+
+// Reload применяет новые время жизни токенов и участников обмена. Ключ подписи не перезагружается
+func (s *Service) Reload(cfg *config.Token) {
+	exchangeActors := make(map[string]config.Actor, len(cfg.Exchange.Actors))
+	for _, actor := range cfg.Exchange.Actors {
+		exchangeActors[actor.Name] = actor
+	}
+	s.tokens.Store(&tokenSettings{
+		accessLifetime:   cfg.AccessLifetime,
+		refrashLifetime:  cfg.RefreshLifetime,
+		exchangeLifetime: cfg.Exchange.Lifetime,
+		exchangeActors:   exchangeActors,
+	})
+}
+
+// CheckSigningKey проверяет, что ключ подписи токенов загружен и корректен
+func (s *Service) CheckSigningKey(ctx context.Context) error {
+	if s.privateKey == nil {
+		return servererrors.ErrSigningKeyNotLoaded
 	}
+	return s.privateKey.Validate()
 }
 
-func (s *Service) Register(ctx context.Context, req *auth.RegisterRequest) (*auth.RegisterResponse, error) {
+func (s *Service) Register(ctx context.Context, req *auth.RegisterRequest) (_ *auth.RegisterResponse, err error) {
 	//const op = "service.Register"
-	userId, err := s.store.AddUser(&dto.AddUser{
+	event := &entity.AuditEvent{EventType: entity.AuditEventRegister, Login: req.Login}
+	defer func() { s.audit(ctx, event, err) }()
+	violations, err := s.passwordPolicy.Validate("password", req.Login, req.Password)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	if len(violations) != 0 {
+		return nil, servererrors.InvalidArgument(violations...)
+	}
+	userId, err := s.store.AddUser(ctx, &dto.AddUser{
 		Login:    req.Login,
 		Password: secure.GetHash(req.Password),
 	})
 	if err != nil {
 		if errors.Is(err, repository.ErrUniqueViolation) {
-			return nil, status.Error(codes.AlreadyExists, servererrors.ErrLoginAlreadyExists.Error())
+			return nil, servererrors.Status(codes.AlreadyExists, servererrors.ErrLoginAlreadyExists)
 		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
+	event.UserId = userId
 	return &auth.RegisterResponse{UserId: userId.String()}, nil
 }
-func (s *Service) Unregister(ctx context.Context, req *auth.UnregisterRequest) (*auth.UnregisterResponse, error) {
-	const op = "service.Unregister"
+func (s *Service) Unregister(ctx context.Context, req *auth.UnregisterRequest) (_ *auth.UnregisterResponse, err error) {
+	event := &entity.AuditEvent{EventType: entity.AuditEventUnregister}
+	defer func() { s.audit(ctx, event, err) }()
 	userId, err := uuid.Parse(req.UserId)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(servererrors.ErrInvalidArgumentUserId, op).Error())
+		return nil, servererrors.Field("userId", servererrors.ErrInvalidArgumentUserId)
 	}
-	if err := s.store.RemoveUser(&userId); err != nil {
+	event.UserId = &userId
+	if err := s.store.RemoveUser(ctx, &userId); err != nil {
 		if errors.Is(err, repository.ErrRecordNotFound) {
-			return nil, status.Error(codes.NotFound, servererrors.ErrUserNotFound.Error())
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrUserNotFound)
 		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
 	return &auth.UnregisterResponse{}, nil
 
 }
-func (s *Service) Login(ctx context.Context, req *auth.LoginRequest) (*auth.LoginResponse, error) {
-	const op = "service.Login"
+func (s *Service) Login(ctx context.Context, req *auth.LoginRequest) (_ *auth.LoginResponse, err error) {
+	event := &entity.AuditEvent{EventType: entity.AuditEventLogin, Login: req.Login}
+	defer func() {
+		s.audit(ctx, event, err)
+		metrics.LoginsTotal.WithLabelValues(event.Outcome).Inc()
+	}()
 	if req.DeviceCode == "" {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(servererrors.ErrInvalidArgumentDeviceCode, op).Error())
+		return nil, servererrors.Field("deviceCode", servererrors.ErrInvalidArgumentDeviceCode)
 	}
-	user, err := s.store.GetUserByLogin(req.Login)
+	user, err := s.store.GetUserByLogin(ctx, req.Login)
 	if err != nil {
 		if errors.Is(err, repository.ErrRecordNotFound) {
-			return nil, status.Error(codes.Unauthenticated, servererrors.ErrInvalidLoginOrPassword.Error())
+			return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidLoginOrPassword)
 		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
+	event.UserId = user.UserId
 	if !secure.CheckHash(req.Password, user.Password) {
-		err := status.Error(codes.Unauthenticated, servererrors.ErrInvalidLoginOrPassword.Error())
+		err := servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidLoginOrPassword)
 		return nil, err
 	}
-	if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(&dto.RevokeRefreshTokensByUserIdAndDeviceCode{
+	if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, &dto.RevokeRefreshTokensByUserIdAndDeviceCode{
 		UserId:     user.UserId,
 		DeviceCode: &req.DeviceCode,
 	}); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
+	tokens := s.tokens.Load()
 	//access token
-	accessTokenString, _, err := jwt.CreateToken(user.UserId, req.DeviceCode, "access", s.accessLifetime, s.privateKey)
+	accessTokenString, _, err := jwt.CreateToken(user.UserId, req.DeviceCode, "access", tokens.accessLifetime, s.privateKey)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
 	//refresh token
-	refreshTokenString, refreshTokenClaims, err := jwt.CreateToken(user.UserId, req.DeviceCode, "refresh", s.refrashLifetime, s.privateKey)
+	refreshTokenString, refreshTokenClaims, err := jwt.CreateToken(user.UserId, req.DeviceCode, "refresh", tokens.refrashLifetime, s.privateKey)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
-	if err := s.store.AddRefreshTokenWithRefreshTokenId(&dto.AddRefreshTokenWithRefreshTokenId{
+	if err := s.store.AddRefreshTokenWithRefreshTokenId(ctx, &dto.AddRefreshTokenWithRefreshTokenId{
 		RefreshTokenId: refreshTokenClaims.Jti,
 		UserId:         refreshTokenClaims.Sub,
 		DeviceCode:     refreshTokenClaims.DeviceCode,
 		ExpirationAt:   refreshTokenClaims.ExpiresAt.Time,
 		IsRevoke:       false,
 	}); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeAccess).Inc()
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeRefresh).Inc()
 
 	return &auth.LoginResponse{AccessToken: accessTokenString, RefreshToken: refreshTokenString}, nil
 }
-func (s *Service) Logout(ctx context.Context, req *auth.LogoutRequest) (*auth.LogoutResponse, error) {
-	const op = "service.Logout"
+func (s *Service) Logout(ctx context.Context, req *auth.LogoutRequest) (_ *auth.LogoutResponse, err error) {
+	event := &entity.AuditEvent{EventType: entity.AuditEventLogout}
+	defer func() { s.audit(ctx, event, err) }()
 	userId, err := uuid.Parse(req.UserId)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(servererrors.ErrInvalidArgumentUserId, op).Error())
+		return nil, servererrors.Field("userId", servererrors.ErrInvalidArgumentUserId)
 	}
+	event.UserId = &userId
 	if req.DeviceCode == "" {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(servererrors.ErrInvalidArgumentDeviceCode, op).Error())
+		return nil, servererrors.Field("deviceCode", servererrors.ErrInvalidArgumentDeviceCode)
 	}
-	if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(&dto.RevokeRefreshTokensByUserIdAndDeviceCode{
+	if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, &dto.RevokeRefreshTokensByUserIdAndDeviceCode{
 		UserId:     &userId,
 		DeviceCode: &req.DeviceCode,
 	}); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
 	return &auth.LogoutResponse{}, nil
 }
-func (s *Service) UpdatePassword(ctx context.Context, req *auth.UpdatePasswordRequest) (*auth.UpdatePasswordResponse, error) {
-	const op = "Service.UpdatePassword"
+func (s *Service) UpdatePassword(ctx context.Context, req *auth.UpdatePasswordRequest) (_ *auth.UpdatePasswordResponse, err error) {
+	event := &entity.AuditEvent{EventType: entity.AuditEventUpdatePassword}
+	defer func() { s.audit(ctx, event, err) }()
 	userId, err := uuid.Parse(req.UserId)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(servererrors.ErrInvalidArgumentUserId, op).Error())
+		return nil, servererrors.Field("userId", servererrors.ErrInvalidArgumentUserId)
+	}
+	event.UserId = &userId
+	user, err := s.store.GetUser(ctx, &userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrUserNotFound)
+		}
+		return nil, s.internalError(ctx, err)
+	}
+	violations, err := s.passwordPolicy.Validate("newPassword", user.Login, req.NewPassword)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	if len(violations) != 0 {
+		return nil, servererrors.InvalidArgument(violations...)
+	}
+	if historySize := s.passwordPolicy.HistorySize(); historySize > 0 {
+		history, err := s.store.GetPasswordHistory(ctx, &userId, historySize)
+		if err != nil {
+			return nil, s.internalError(ctx, err)
+		}
+		if violation := s.passwordPolicy.CheckHistory("newPassword", req.NewPassword, history); violation != nil {
+			return nil, servererrors.InvalidArgument(violation)
+		}
 	}
 	hashNewPassword := secure.GetHash(req.NewPassword)
 
-	if err = s.store.UpdateUser(&dto.UpdateUser{
-		UserId:   &userId,
-		Password: &hashNewPassword,
+	//история хранит не больше паролей, чем проверяет политика, и как минимум текущий
+	if err = s.store.UpdateUser(ctx, &dto.UpdateUser{
+		UserId:              &userId,
+		Password:            &hashNewPassword,
+		PasswordHistorySize: max(s.passwordPolicy.HistorySize(), 1),
 	}); err != nil {
 		if errors.Is(err, repository.ErrRecordNotFound) {
-			return nil, status.Error(codes.NotFound, servererrors.ErrUserNotFound.Error())
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrUserNotFound)
 		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
-	if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(&dto.RevokeRefreshTokensByUserIdAndDeviceCode{
+	if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, &dto.RevokeRefreshTokensByUserIdAndDeviceCode{
 		UserId:     &userId,
 		DeviceCode: nil,
 	}); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
 	return &auth.UpdatePasswordResponse{}, nil
 }
-func (s *Service) RefreshToken(ctx context.Context, req *auth.RefreshTokenRequest) (*auth.RefreshTokenResponse, error) {
-	const op = "service.RefreshToken"
+func (s *Service) RefreshToken(ctx context.Context, req *auth.RefreshTokenRequest) (_ *auth.RefreshTokenResponse, err error) {
+	event := &entity.AuditEvent{EventType: entity.AuditEventRefreshToken}
+	defer func() { s.audit(ctx, event, err) }()
 	refreshTokenId, err := uuid.Parse(req.RefreshTokenId)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, errors.Wrap(servererrors.ErrInvalidArgumentTokenId, op).Error())
+		return nil, servererrors.Field("refreshTokenId", servererrors.ErrInvalidArgumentTokenId)
 	}
-	refreshToken, err := s.store.GetRefreshToken(&refreshTokenId)
+	refreshToken, err := s.store.GetRefreshToken(ctx, &refreshTokenId)
 	if err != nil {
 		if errors.Is(err, repository.ErrRecordNotFound) {
-			return nil, status.Error(codes.NotFound, servererrors.ErrTokenNotFound.Error())
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrTokenNotFound)
 		}
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
+	event.UserId = refreshToken.UserId
 	if refreshToken.IsRevoke {
-		if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(&dto.RevokeRefreshTokensByUserIdAndDeviceCode{
+		event.EventType = entity.AuditEventRefreshTokenReuse
+		metrics.RefreshTokenReuseTotal.Inc()
+		if err := s.store.RevokeRefreshTokensByUserIdAndDeviceCode(ctx, &dto.RevokeRefreshTokensByUserIdAndDeviceCode{
 			UserId:     refreshToken.UserId,
 			DeviceCode: &refreshToken.DeviceCode,
 		}); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, s.internalError(ctx, err)
 		}
-		return nil, status.Error(codes.Unauthenticated, servererrors.ErrTokenRevoked.Error())
+		return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrTokenRevoked)
 	}
-	if err := s.store.RevokeRefreshTokenByRefreshTokenId(&refreshTokenId); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	if err := s.store.RevokeRefreshTokenByRefreshTokenId(ctx, &refreshTokenId); err != nil {
+		return nil, s.internalError(ctx, err)
 	}
+	tokens := s.tokens.Load()
 	//access token
-	accessTokenString, _, err := jwt.CreateToken(refreshToken.UserId, refreshToken.DeviceCode, "access", s.accessLifetime, s.privateKey)
+	accessTokenString, _, err := jwt.CreateToken(refreshToken.UserId, refreshToken.DeviceCode, "access", tokens.accessLifetime, s.privateKey)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
 	//refresh token
-	refreshTokenString, refreshTokenClaims, err := jwt.CreateToken(refreshToken.UserId, refreshToken.DeviceCode, "refresh", s.refrashLifetime, s.privateKey)
+	refreshTokenString, refreshTokenClaims, err := jwt.CreateToken(refreshToken.UserId, refreshToken.DeviceCode, "refresh", tokens.refrashLifetime, s.privateKey)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
-	if err := s.store.AddRefreshTokenWithRefreshTokenId(&dto.AddRefreshTokenWithRefreshTokenId{
+	if err := s.store.AddRefreshTokenWithRefreshTokenId(ctx, &dto.AddRefreshTokenWithRefreshTokenId{
 		RefreshTokenId: refreshTokenClaims.Jti,
 		UserId:         refreshTokenClaims.Sub,
 		DeviceCode:     refreshTokenClaims.DeviceCode,
 		ExpirationAt:   refreshTokenClaims.ExpiresAt.Time,
 		IsRevoke:       false,
 	}); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, s.internalError(ctx, err)
 	}
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeAccess).Inc()
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeRefresh).Inc()
 	return &auth.RefreshTokenResponse{
 		AccessToken:  accessTokenString,
 		RefreshToken: refreshTokenString,
 	}, nil
 }
+func (s *Service) ExchangeToken(ctx context.Context, req *auth.ExchangeTokenRequest) (_ *auth.ExchangeTokenResponse, err error) {
+	//инициатор - сервис actor, в журнал записывается и отказ с неверным секретом
+	event := &entity.AuditEvent{
+		EventType: entity.AuditEventExchangeToken,
+		ActorId:   req.ActorName,
+		Details:   "audience: " + req.Audience + ", scopes: " + strings.Join(req.Scopes, " "),
+	}
+	defer func() { s.audit(ctx, event, err) }()
+	if req.Audience == "" {
+		return nil, servererrors.Field("audience", servererrors.ErrInvalidArgumentAudience)
+	}
+	tokens := s.tokens.Load()
+	actor, ok := tokens.exchangeActors[req.ActorName]
+	if !ok || subtle.ConstantTimeCompare([]byte(actor.Secret), []byte(req.ActorSecret)) != 1 {
+		return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidActorCredentials)
+	}
+	subjectClaims, err := jwt.ParseToken(req.SubjectToken, s.publicKey)
+	if err != nil || subjectClaims.TokenType != "access" || subjectClaims.Sub == nil {
+		return nil, servererrors.Status(codes.Unauthenticated, servererrors.ErrInvalidSubjectToken)
+	}
+	event.UserId = subjectClaims.Sub
+	if !slices.Contains(actor.Audiences, req.Audience) {
+		return nil, servererrors.Status(codes.PermissionDenied, servererrors.ErrAudienceNotAllowed)
+	}
+	//токен, уже выданный обменом или имперсонацией, обменивается только на свои scopes: повторный обмен
+	//не расширяет права
+	subjectScopes := strings.Fields(subjectClaims.Scope)
+	for _, scope := range req.Scopes {
+		if !slices.Contains(actor.Scopes, scope) || (subjectClaims.Act != nil && !slices.Contains(subjectScopes, scope)) {
+			return nil, servererrors.Status(codes.PermissionDenied, servererrors.ErrScopeNotAllowed)
+		}
+	}
+	//токен обмена не может жить дольше исходного токена
+	lifetime := tokens.exchangeLifetime
+	if remaining := time.Until(subjectClaims.ExpiresAt.Time); remaining < lifetime {
+		lifetime = remaining
+	}
+	accessTokenString, accessTokenClaims, err := jwt.CreateExchangeToken(subjectClaims, actor.Name, req.Audience, req.Scopes, lifetime, s.privateKey)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeExchange).Inc()
+	return &auth.ExchangeTokenResponse{
+		AccessToken:     accessTokenString,
+		IssuedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		ExpiresIn:       int64(time.Until(accessTokenClaims.ExpiresAt.Time).Seconds()),
+	}, nil
+}
+func (s *Service) Impersonate(ctx context.Context, req *auth.ImpersonateRequest) (_ *auth.ImpersonateResponse, err error) {
+	//отказы записываются в журнал аудита вместе с инициатором, если его токен действителен
+	event := &entity.AuditEvent{EventType: entity.AuditEventImpersonate, Details: req.Reason}
+	defer func() { s.audit(ctx, event, err) }()
+	adminClaims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	event.ActorId = adminClaims.Sub.String()
+	userId, parseErr := uuid.Parse(req.UserId)
+	if parseErr == nil {
+		event.UserId = &userId
+	}
+	if err := s.checkAdmin(ctx, adminClaims); err != nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, servererrors.Field("userId", servererrors.ErrInvalidArgumentUserId)
+	}
+	if userId == *adminClaims.Sub {
+		return nil, servererrors.Status(codes.InvalidArgument, servererrors.ErrCannotImpersonateSelf)
+	}
+	if _, err := s.store.GetUser(ctx, &userId); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrUserNotFound)
+		}
+		return nil, s.internalError(ctx, err)
+	}
+	//refresh токен при имперсонации не выдается
+	accessTokenString, accessTokenClaims, err := jwt.CreateImpersonationToken(&userId, adminClaims.Sub, impersonationDeviceCode, impersonationLifetime, s.privateKey)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	if err := s.store.AddImpersonation(ctx, &dto.AddImpersonation{
+		ImpersonationId: accessTokenClaims.Jti,
+		AdminId:         adminClaims.Sub,
+		UserId:          &userId,
+		Reason:          req.Reason,
+		ExpirationAt:    accessTokenClaims.ExpiresAt.Time,
+	}); err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	metrics.TokensIssuedTotal.WithLabelValues(metrics.TokenTypeImpersonation).Inc()
+	s.lg.WarnContext(ctx, "SERVICE: impersonation token issued", slog.String("adminId", adminClaims.Sub.String()), slog.String("userId", userId.String()), slog.String("reason", req.Reason))
+	return &auth.ImpersonateResponse{
+		AccessToken: accessTokenString,
+		ExpiresIn:   int64(impersonationLifetime.Seconds()),
+	}, nil
+}
+func (s *Service) ListSessions(ctx context.Context, req *auth.ListSessionsRequest) (*auth.ListSessionsResponse, error) {
+	userId, err := uuid.Parse(req.UserId)
+	if err != nil {
+		return nil, servererrors.Field("userId", servererrors.ErrInvalidArgumentUserId)
+	}
+	if _, err := s.authorizeUser(ctx, &userId); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	refreshTokens, err := s.store.GetActiveRefreshTokensByUserId(ctx, &userId, now)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	impersonations, err := s.store.GetActiveImpersonationsByUserId(ctx, &userId, now)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	sessions := make([]*auth.Session, 0, len(refreshTokens)+len(impersonations))
+	for _, refreshToken := range refreshTokens {
+		sessions = append(sessions, &auth.Session{
+			SessionId:    sessionId(refreshToken.RefreshTokenId),
+			DeviceCode:   refreshToken.DeviceCode,
+			ExpirationAt: refreshToken.ExpirationAt.Format(time.RFC3339),
+		})
+	}
+	for _, impersonation := range impersonations {
+		sessions = append(sessions, &auth.Session{
+			SessionId:      sessionId(impersonation.ImpersonationId),
+			DeviceCode:     impersonationDeviceCode,
+			ExpirationAt:   impersonation.ExpirationAt.Format(time.RFC3339),
+			ImpersonatedBy: impersonation.AdminId.String(),
+		})
+	}
+	return &auth.ListSessionsResponse{Sessions: sessions}, nil
+}
+
+// sessionId - непрозрачный идентификатор сессии. Идентификатор refresh токена сам по себе позволяет
+// обновить токены, поэтому наружу выдается только необратимое производное от него значение
+func sessionId(tokenId *uuid.UUID) string {
+	return uuid.NewSHA1(sessionNamespace, tokenId[:]).String()
+}
+func (s *Service) QueryAuditEvents(ctx context.Context, req *auth.QueryAuditEventsRequest) (*auth.QueryAuditEventsResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	query := &dto.GetAuditEvents{Limit: defaultAuditEventsLimit}
+	if req.From != "" {
+		from, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return nil, servererrors.Field("from", servererrors.ErrInvalidArgumentTimeRange)
+		}
+		query.From = &from
+	}
+	if req.To != "" {
+		to, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return nil, servererrors.Field("to", servererrors.ErrInvalidArgumentTimeRange)
+		}
+		query.To = &to
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return nil, servererrors.InvalidArgument(
+			&servererrors.FieldViolation{Field: "from", Err: servererrors.ErrInvalidArgumentTimeRange},
+			&servererrors.FieldViolation{Field: "to", Err: servererrors.ErrInvalidArgumentTimeRange},
+		)
+	}
+	if req.UserId != "" {
+		userId, err := uuid.Parse(req.UserId)
+		if err != nil {
+			return nil, servererrors.Field("userId", servererrors.ErrInvalidArgumentUserId)
+		}
+		query.UserId = &userId
+	}
+	if req.Limit > 0 {
+		query.Limit = min(int(req.Limit), maxAuditEventsLimit)
+	}
+	auditEvents, err := s.store.GetAuditEvents(ctx, query)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	events := make([]*auth.AuditEvent, 0, len(auditEvents))
+	for _, auditEvent := range auditEvents {
+		event := &auth.AuditEvent{
+			AuditEventId: auditEvent.AuditEventId.String(),
+			EventType:    auditEvent.EventType,
+			Login:        auditEvent.Login,
+			ActorId:      auditEvent.ActorId,
+			Ip:           auditEvent.Ip,
+			UserAgent:    auditEvent.UserAgent,
+			Outcome:      auditEvent.Outcome,
+			Details:      auditEvent.Details,
+			CreatedAt:    auditEvent.CreatedAt.Format(time.RFC3339Nano),
+		}
+		if auditEvent.UserId != nil {
+			event.UserId = auditEvent.UserId.String()
+		}
+		events = append(events, event)
+	}
+	return &auth.QueryAuditEventsResponse{Events: events}, nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"slices"
+	"time"
+
+	auth "skillsRockGRPC/grpc/gen"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	defaultWebhookDeliveriesLimit = 100
+	maxWebhookDeliveriesLimit     = 1000
+)
+
+func (s *Service) CreateWebhookSubscription(ctx context.Context, req *auth.CreateWebhookSubscriptionRequest) (*auth.CreateWebhookSubscriptionResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if !isWebhookUrl(req.Url) {
+		return nil, servererrors.Field("url", servererrors.ErrInvalidArgumentWebhookUrl)
+	}
+	if len(req.EventTypes) == 0 {
+		return nil, servererrors.Field("eventTypes", servererrors.ErrInvalidArgumentEventType)
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(entity.WebhookEventTypes, eventType) {
+			return nil, servererrors.Field("eventTypes", servererrors.ErrInvalidArgumentEventType)
+		}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	secretString := hex.EncodeToString(secret)
+	subscriptionId, err := s.store.AddWebhookSubscription(ctx, &dto.AddWebhookSubscription{
+		Url:        req.Url,
+		Secret:     secretString,
+		EventTypes: req.EventTypes,
+	})
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	//секрет возвращается только при создании подписки
+	return &auth.CreateWebhookSubscriptionResponse{
+		SubscriptionId: subscriptionId.String(),
+		Secret:         secretString,
+	}, nil
+}
+func (s *Service) ListWebhookSubscriptions(ctx context.Context, req *auth.ListWebhookSubscriptionsRequest) (*auth.ListWebhookSubscriptionsResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	webhookSubscriptions, err := s.store.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	subscriptions := make([]*auth.WebhookSubscription, 0, len(webhookSubscriptions))
+	for _, webhookSubscription := range webhookSubscriptions {
+		subscriptions = append(subscriptions, &auth.WebhookSubscription{
+			SubscriptionId: webhookSubscription.SubscriptionId.String(),
+			Url:            webhookSubscription.Url,
+			EventTypes:     webhookSubscription.EventTypes,
+			CreatedAt:      webhookSubscription.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return &auth.ListWebhookSubscriptionsResponse{Subscriptions: subscriptions}, nil
+}
+func (s *Service) DeleteWebhookSubscription(ctx context.Context, req *auth.DeleteWebhookSubscriptionRequest) (*auth.DeleteWebhookSubscriptionResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	subscriptionId, err := uuid.Parse(req.SubscriptionId)
+	if err != nil {
+		return nil, servererrors.Field("subscriptionId", servererrors.ErrInvalidArgumentSubscriptionId)
+	}
+	if err := s.store.RemoveWebhookSubscription(ctx, &subscriptionId); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrSubscriptionNotFound)
+		}
+		return nil, s.internalError(ctx, err)
+	}
+	return &auth.DeleteWebhookSubscriptionResponse{}, nil
+}
+func (s *Service) ListWebhookDeliveries(ctx context.Context, req *auth.ListWebhookDeliveriesRequest) (*auth.ListWebhookDeliveriesResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	query := &dto.GetWebhookDeliveries{Limit: defaultWebhookDeliveriesLimit}
+	if req.SubscriptionId != "" {
+		subscriptionId, err := uuid.Parse(req.SubscriptionId)
+		if err != nil {
+			return nil, servererrors.Field("subscriptionId", servererrors.ErrInvalidArgumentSubscriptionId)
+		}
+		query.SubscriptionId = &subscriptionId
+	}
+	if req.Limit > 0 {
+		query.Limit = min(int(req.Limit), maxWebhookDeliveriesLimit)
+	}
+	webhookDeliveries, err := s.store.GetWebhookDeliveries(ctx, query)
+	if err != nil {
+		return nil, s.internalError(ctx, err)
+	}
+	deliveries := make([]*auth.WebhookDelivery, 0, len(webhookDeliveries))
+	for _, webhookDelivery := range webhookDeliveries {
+		delivery := &auth.WebhookDelivery{
+			DeliveryId:     webhookDelivery.DeliveryId.String(),
+			SubscriptionId: webhookDelivery.SubscriptionId.String(),
+			EventId:        webhookDelivery.EventId.String(),
+			EventType:      webhookDelivery.EventType,
+			Status:         webhookDelivery.Status,
+			Attempts:       int32(webhookDelivery.Attempts),
+			LastStatusCode: int32(webhookDelivery.LastStatusCode),
+			LastError:      webhookDelivery.LastError,
+			CreatedAt:      webhookDelivery.CreatedAt.Format(time.RFC3339),
+		}
+		if webhookDelivery.DeliveredAt != nil {
+			delivery.DeliveredAt = webhookDelivery.DeliveredAt.Format(time.RFC3339)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return &auth.ListWebhookDeliveriesResponse{Deliveries: deliveries}, nil
+}
+
+// ReplayDelivery ставит доставку в очередь повторно. История попыток сохраняется
+func (s *Service) ReplayDelivery(ctx context.Context, req *auth.ReplayDeliveryRequest) (*auth.ReplayDeliveryResponse, error) {
+	if _, err := s.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+	deliveryId, err := uuid.Parse(req.DeliveryId)
+	if err != nil {
+		return nil, servererrors.Field("deliveryId", servererrors.ErrInvalidArgumentDeliveryId)
+	}
+	if err := s.store.ReplayWebhookDelivery(ctx, &deliveryId, time.Now()); err != nil {
+		if errors.Is(err, repository.ErrRecordNotFound) {
+			return nil, servererrors.Status(codes.NotFound, servererrors.ErrDeliveryNotFound)
+		}
+		return nil, s.internalError(ctx, err)
+	}
+	return &auth.ReplayDeliveryResponse{}, nil
+}
+
+// isWebhookUrl допускает только https адреса. http разрешен для localhost, чтобы проверять подписки локально
+func isWebhookUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
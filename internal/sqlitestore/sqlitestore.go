@@ -0,0 +1,773 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+	"skillsRockGRPC/migration"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// Время хранится в INTEGER как микросекунды Unix, идентификаторы - в TEXT. Порядок по времени
+// дополняется rowid, чтобы записи с одинаковым временем возвращались в порядке добавления
+const (
+	addUserQuery = `
+INSERT INTO "user" (login,password) 
+VALUES (?1, ?2) RETURNING user_id;`
+	getUserQuery = `
+SELECT user_id,login,password,role FROM "user" 
+WHERE user_id=?1;`
+	getUserByLoginQuery = `
+SELECT user_id,login,password,role FROM "user" 
+WHERE login=?1;`
+	updateUserQuery = `
+UPDATE "user" SET 
+login = COALESCE(?2, login),
+password = COALESCE(?3, password)
+WHERE user_id=?1
+RETURNING user_id;`
+	addPasswordHistoryQuery = `
+INSERT INTO password_history (user_id,password,created_at) 
+VALUES (?1, ?2, ?3);`
+	getPasswordHistoryQuery = `
+SELECT password FROM password_history
+WHERE user_id=?1
+ORDER BY created_at DESC, rowid DESC
+LIMIT ?2;`
+	prunePasswordHistoryQuery = `
+DELETE FROM password_history
+WHERE user_id=?1 AND password_history_id NOT IN (
+SELECT password_history_id FROM password_history WHERE user_id=?1 ORDER BY created_at DESC, rowid DESC LIMIT ?2);`
+	removeUserQuery = `
+DELETE FROM "user" WHERE user_id=?1 RETURNING user_id;`
+	addRefreshTokenWithRefreshTokenIdQuery = `
+INSERT INTO refresh_token (refresh_token_id,user_id,device_code,expiration_at,is_revoke,revoked_at) 
+VALUES (?1,?2,?3,?4,?5,CASE WHEN ?5 THEN ?6 END);`
+	getRefreshTokenQuery = `
+SELECT refresh_token_id,user_id,device_code,expiration_at,is_revoke,revoked_at FROM refresh_token 
+WHERE refresh_token_id=?1;`
+	revokeRefreshTokensByUserIdAndDeviceCodeQuery = `
+UPDATE refresh_token 
+SET is_revoke=1, revoked_at=?3
+WHERE user_id=?1 AND (?2 IS NULL OR device_code=?2) AND is_revoke=0;`
+	revokeRefreshTokenByRefreshTokenIdQuery = `
+UPDATE refresh_token 
+SET is_revoke=1, revoked_at=COALESCE(revoked_at, ?2)
+WHERE refresh_token_id = ?1;`
+	getActiveRefreshTokensByUserIdQuery = `
+SELECT refresh_token_id,user_id,device_code,expiration_at,is_revoke,revoked_at FROM refresh_token
+WHERE user_id=?1 AND is_revoke=0 AND expiration_at > ?2
+ORDER BY expiration_at, rowid;`
+	removeRefreshTokensByExpirationAtQuery = `
+DELETE FROM refresh_token
+WHERE rowid IN (
+SELECT rowid FROM refresh_token
+WHERE expiration_at < ?1
+LIMIT ?2);`
+	removeRefreshTokensByRevokedAtQuery = `
+DELETE FROM refresh_token
+WHERE rowid IN (
+SELECT rowid FROM refresh_token
+WHERE is_revoke=1 AND revoked_at < ?1
+LIMIT ?2);`
+	addImpersonationQuery = `
+INSERT INTO impersonation (impersonation_id,admin_id,user_id,reason,created_at,expiration_at) 
+VALUES (?1,?2,?3,?4,?5,?6);`
+	getActiveImpersonationsByUserIdQuery = `
+SELECT impersonation_id,admin_id,user_id,reason,created_at,expiration_at FROM impersonation
+WHERE user_id=?1 AND expiration_at > ?2
+ORDER BY created_at, rowid;`
+	addAuditEventQuery = `
+INSERT INTO audit_event (event_type,user_id,login,actor_id,ip,user_agent,outcome,details,created_at) 
+VALUES (?1,?2,?3,?4,?5,?6,?7,?8,?9);`
+	getAuditEventsQuery = `
+SELECT audit_event_id,event_type,user_id,login,actor_id,ip,user_agent,outcome,details,created_at FROM audit_event
+WHERE (?1 IS NULL OR created_at >= ?1) 
+AND (?2 IS NULL OR created_at < ?2) 
+AND (?3 IS NULL OR user_id = ?3)
+ORDER BY created_at DESC, rowid DESC
+LIMIT ?4;`
+	removeAuditEventsByCreatedAtQuery = `
+DELETE FROM audit_event
+WHERE rowid IN (
+SELECT rowid FROM audit_event
+WHERE created_at < ?1
+LIMIT ?2);`
+	addOutboxEventQuery = `
+INSERT INTO outbox (event_type,payload,next_attempt_at,created_at) 
+VALUES (?1,?2,?3,?3);`
+	claimOutboxEventsQuery = `
+SELECT outbox_id,event_type,payload,status,attempts,next_attempt_at,last_error,created_at FROM outbox
+WHERE status='pending' AND next_attempt_at <= ?1 AND (locked_until IS NULL OR locked_until < ?1)
+ORDER BY created_at, rowid
+LIMIT ?2;`
+	lockOutboxEventQuery = `
+UPDATE outbox SET locked_until=?2
+WHERE outbox_id=?1;`
+	updateOutboxEventQuery = `
+UPDATE outbox SET 
+status=?2, attempts=?3, next_attempt_at=?4, last_error=?5, sent_at=?6, locked_until=NULL
+WHERE outbox_id=?1;`
+	addWebhookSubscriptionQuery = `
+INSERT INTO webhook_subscription (url,secret,event_types,created_at) 
+VALUES (?1,?2,?3,?4) RETURNING subscription_id;`
+	getWebhookSubscriptionsQuery = `
+SELECT subscription_id,url,secret,event_types,created_at FROM webhook_subscription
+ORDER BY created_at, rowid;`
+	removeWebhookSubscriptionQuery = `
+DELETE FROM webhook_subscription WHERE subscription_id=?1 RETURNING subscription_id;`
+	addWebhookDeliveriesQuery = `
+INSERT INTO webhook_delivery (subscription_id,event_id,event_type,payload,next_attempt_at,created_at)
+SELECT subscription_id,?1,?2,?3,?4,?4 FROM webhook_subscription
+WHERE EXISTS (SELECT 1 FROM json_each(event_types) WHERE value = ?2)
+ORDER BY created_at, rowid
+ON CONFLICT (subscription_id,event_id) DO NOTHING;`
+	claimWebhookDeliveriesQuery = `
+SELECT d.delivery_id,d.subscription_id,d.event_id,d.event_type,d.payload,d.status,d.attempts,d.next_attempt_at,d.last_status_code,d.last_error,d.created_at,d.delivered_at,s.url,s.secret 
+FROM webhook_delivery d JOIN webhook_subscription s ON s.subscription_id=d.subscription_id
+WHERE d.status='pending' AND d.next_attempt_at <= ?1 AND (d.locked_until IS NULL OR d.locked_until < ?1)
+ORDER BY d.created_at, d.rowid
+LIMIT ?2;`
+	lockWebhookDeliveryQuery = `
+UPDATE webhook_delivery SET locked_until=?2
+WHERE delivery_id=?1;`
+	updateWebhookDeliveryQuery = `
+UPDATE webhook_delivery SET 
+status=?2, attempts=?3, next_attempt_at=?4, last_status_code=?5, last_error=?6, delivered_at=?7, locked_until=NULL
+WHERE delivery_id=?1;`
+	addWebhookDeliveryAttemptQuery = `
+INSERT INTO webhook_delivery_attempt (delivery_id,status_code,error,created_at) 
+VALUES (?1,?2,?3,?4);`
+	getWebhookDeliveriesQuery = `
+SELECT d.delivery_id,d.subscription_id,d.event_id,d.event_type,d.payload,d.status,d.attempts,d.next_attempt_at,d.last_status_code,d.last_error,d.created_at,d.delivered_at,s.url,s.secret 
+FROM webhook_delivery d JOIN webhook_subscription s ON s.subscription_id=d.subscription_id
+WHERE (?1 IS NULL OR d.subscription_id=?1)
+ORDER BY d.created_at DESC, d.rowid DESC
+LIMIT ?2;`
+	getJobRunQuery = `
+SELECT name,instance,started_at,duration_ms,outcome,error,rows_affected FROM job_run
+WHERE name=?1;`
+	saveJobRunQuery = `
+INSERT INTO job_run (name,instance,started_at,duration_ms,outcome,error,rows_affected) 
+VALUES (?1,?2,?3,?4,?5,?6,?7)
+ON CONFLICT (name) DO UPDATE SET 
+instance=excluded.instance, started_at=excluded.started_at, duration_ms=excluded.duration_ms,
+outcome=excluded.outcome, error=excluded.error, rows_affected=excluded.rows_affected;`
+	replayWebhookDeliveryQuery = `
+UPDATE webhook_delivery SET 
+status='pending', attempts=0, next_attempt_at=?2, locked_until=NULL, delivered_at=NULL
+WHERE delivery_id=?1
+RETURNING delivery_id;`
+)
+
+// Store - реализация repository.Repository на SQLite для площадок без PostgreSQL. SQLite допускает
+// одного писателя, поэтому используется одно соединение, а транзакции начинаются с блокировкой на запись
+// (_txlock=immediate), что заменяет FOR UPDATE SKIP LOCKED при захвате событий
+type Store struct {
+	db *sql.DB
+	lg *slog.Logger
+}
+
+func MustNew(lg *slog.Logger, cfg *config.Store) *Store {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", cfg.Path))
+	if err != nil {
+		log.Fatalf("STORE: %v\n", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		log.Fatalf("STORE: %v\n", err)
+	}
+	if cfg.AutoMigrate {
+		from, to, err := migration.Up(cfg)
+		if err != nil {
+			log.Fatalf("STORE: %v\n", err)
+		}
+		if from != to {
+			lg.Info("STORE: schema migrated", slog.Any("from", from), slog.Any("to", to))
+		}
+	}
+	return &Store{
+		db,
+		lg,
+	}
+}
+
+// Ping проверяет доступность базы данных
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close закрывает базу данных
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) AddUser(ctx context.Context, dto *dto.AddUser) (*uuid.UUID, error) {
+	const op = "sqlitestore.AddUser"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback()
+	userId := new(uuid.UUID)
+	err = tx.QueryRowContext(ctx, addUserQuery, dto.Login, dto.Password).Scan(userId)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, errors.Wrap(repository.ErrUniqueViolation, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	if _, err := tx.ExecContext(ctx, addPasswordHistoryQuery, userId, dto.Password, micros(time.Now())); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	if err := addOutboxEvent(ctx, tx, entity.EventUserRegistered, &entity.UserEventPayload{UserId: userId, Login: dto.Login}); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return userId, nil
+}
+func (s *Store) GetUser(ctx context.Context, userId *uuid.UUID) (*entity.User, error) {
+	const op = "sqlitestore.GetUser"
+	user := new(entity.User)
+	err := s.db.QueryRowContext(ctx, getUserQuery, userId).Scan(&user.UserId, &user.Login, &user.Password, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return user, nil
+}
+func (s *Store) GetUserByLogin(ctx context.Context, login string) (*entity.User, error) {
+	const op = "sqlitestore.GetUserByLogin"
+	user := new(entity.User)
+	err := s.db.QueryRowContext(ctx, getUserByLoginQuery, login).Scan(&user.UserId, &user.Login, &user.Password, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return user, nil
+}
+func (s *Store) UpdateUser(ctx context.Context, dto *dto.UpdateUser) error {
+	const op = "sqlitestore.UpdateUser"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback()
+	userId := new(uuid.UUID)
+	err = tx.QueryRowContext(ctx, updateUserQuery, dto.UserId, dto.Login, dto.Password).Scan(userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		if isUniqueViolation(err) {
+			return errors.Wrap(repository.ErrUniqueViolation, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	if dto.Password != nil {
+		if _, err := tx.ExecContext(ctx, addPasswordHistoryQuery, userId, dto.Password, micros(time.Now())); err != nil {
+			return errors.Wrap(storeError(err), op)
+		}
+		if dto.PasswordHistorySize > 0 {
+			if _, err := tx.ExecContext(ctx, prunePasswordHistoryQuery, userId, dto.PasswordHistorySize); err != nil {
+				return errors.Wrap(storeError(err), op)
+			}
+		}
+		if err := addOutboxEvent(ctx, tx, entity.EventPasswordChanged, &entity.UserEventPayload{UserId: userId}); err != nil {
+			return errors.Wrap(storeError(err), op)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+
+// GetPasswordHistory возвращает хеши последних limit паролей пользователя, включая текущий
+func (s *Store) GetPasswordHistory(ctx context.Context, userId *uuid.UUID, limit int) ([]string, error) {
+	const op = "sqlitestore.GetPasswordHistory"
+	rows, err := s.db.QueryContext(ctx, getPasswordHistoryQuery, userId, limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	passwords := []string{}
+	for rows.Next() {
+		var password string
+		if err := rows.Scan(&password); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		passwords = append(passwords, password)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return passwords, nil
+}
+func (s *Store) RemoveUser(ctx context.Context, userId *uuid.UUID) error {
+	const op = "sqlitestore.RemoveUser"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, removeUserQuery, userId).Scan(userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	if err := addOutboxEvent(ctx, tx, entity.EventUserDeleted, &entity.UserEventPayload{UserId: userId}); err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+
+func (s *Store) AddRefreshTokenWithRefreshTokenId(ctx context.Context, dto *dto.AddRefreshTokenWithRefreshTokenId) error {
+	const op = "sqlitestore.AddRefreshTokenWithRefreshTokenId"
+	_, err := s.db.ExecContext(ctx, addRefreshTokenWithRefreshTokenIdQuery, dto.RefreshTokenId, dto.UserId, dto.DeviceCode, micros(dto.ExpirationAt), dto.IsRevoke, micros(time.Now()))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetRefreshToken(ctx context.Context, refreshTokenId *uuid.UUID) (*entity.RefreshToken, error) {
+	const op = "sqlitestore.GetRefreshToken"
+	refreshToken := new(entity.RefreshToken)
+	err := s.db.QueryRowContext(ctx, getRefreshTokenQuery, refreshTokenId).Scan(&refreshToken.RefreshTokenId, &refreshToken.UserId, &refreshToken.DeviceCode, timeScanner{&refreshToken.ExpirationAt}, &refreshToken.IsRevoke, nullTimeScanner{&refreshToken.RevokedAt})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return refreshToken, nil
+}
+func (s *Store) RevokeRefreshTokenByRefreshTokenId(ctx context.Context, refreshTokenId *uuid.UUID) error {
+	const op = "sqlitestore.RevokeRefreshTokenByRefreshTokenId"
+	_, err := s.db.ExecContext(ctx, revokeRefreshTokenByRefreshTokenIdQuery, refreshTokenId, micros(time.Now()))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) RevokeRefreshTokensByUserIdAndDeviceCode(ctx context.Context, dto *dto.RevokeRefreshTokensByUserIdAndDeviceCode) error {
+	const op = "sqlitestore.RevokeRefreshTokensByUserIdAndDeviceCode"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, revokeRefreshTokensByUserIdAndDeviceCodeQuery, dto.UserId, dto.DeviceCode, micros(time.Now()))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	if count > 0 {
+		payload := &entity.UserEventPayload{UserId: dto.UserId}
+		if dto.DeviceCode != nil {
+			payload.DeviceCode = *dto.DeviceCode
+		}
+		if err := addOutboxEvent(ctx, tx, entity.EventSessionRevoked, payload); err != nil {
+			return errors.Wrap(storeError(err), op)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetActiveRefreshTokensByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.RefreshToken, error) {
+	const op = "sqlitestore.GetActiveRefreshTokensByUserId"
+	rows, err := s.db.QueryContext(ctx, getActiveRefreshTokensByUserIdQuery, userId, micros(now))
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	refreshTokens := []*entity.RefreshToken{}
+	for rows.Next() {
+		refreshToken := new(entity.RefreshToken)
+		if err := rows.Scan(&refreshToken.RefreshTokenId, &refreshToken.UserId, &refreshToken.DeviceCode, timeScanner{&refreshToken.ExpirationAt}, &refreshToken.IsRevoke, nullTimeScanner{&refreshToken.RevokedAt}); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return refreshTokens, nil
+}
+func (s *Store) RemoveRefreshTokensByExpirationAt(ctx context.Context, now time.Time, limit int) (int64, error) {
+	const op = "sqlitestore.RemoveRefreshTokensByExpirationAt"
+	result, err := s.db.ExecContext(ctx, removeRefreshTokensByExpirationAtQuery, micros(now), limit)
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return rowsAffected(result, op)
+}
+func (s *Store) RemoveRefreshTokensByRevokedAt(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "sqlitestore.RemoveRefreshTokensByRevokedAt"
+	result, err := s.db.ExecContext(ctx, removeRefreshTokensByRevokedAtQuery, micros(before), limit)
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return rowsAffected(result, op)
+}
+
+func (s *Store) AddImpersonation(ctx context.Context, dto *dto.AddImpersonation) error {
+	const op = "sqlitestore.AddImpersonation"
+	_, err := s.db.ExecContext(ctx, addImpersonationQuery, dto.ImpersonationId, dto.AdminId, dto.UserId, dto.Reason, micros(time.Now()), micros(dto.ExpirationAt))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetActiveImpersonationsByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.Impersonation, error) {
+	const op = "sqlitestore.GetActiveImpersonationsByUserId"
+	rows, err := s.db.QueryContext(ctx, getActiveImpersonationsByUserIdQuery, userId, micros(now))
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	impersonations := []*entity.Impersonation{}
+	for rows.Next() {
+		impersonation := new(entity.Impersonation)
+		if err := rows.Scan(&impersonation.ImpersonationId, &impersonation.AdminId, &impersonation.UserId, &impersonation.Reason, timeScanner{&impersonation.CreatedAt}, timeScanner{&impersonation.ExpirationAt}); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return impersonations, nil
+}
+
+func (s *Store) AddAuditEvent(ctx context.Context, dto *dto.AddAuditEvent) error {
+	const op = "sqlitestore.AddAuditEvent"
+	_, err := s.db.ExecContext(ctx, addAuditEventQuery, dto.EventType, dto.UserId, dto.Login, dto.ActorId, dto.Ip, dto.UserAgent, dto.Outcome, dto.Details, micros(dto.CreatedAt))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetAuditEvents(ctx context.Context, dto *dto.GetAuditEvents) ([]*entity.AuditEvent, error) {
+	const op = "sqlitestore.GetAuditEvents"
+	rows, err := s.db.QueryContext(ctx, getAuditEventsQuery, nullMicros(dto.From), nullMicros(dto.To), dto.UserId, dto.Limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	auditEvents := []*entity.AuditEvent{}
+	for rows.Next() {
+		auditEvent := new(entity.AuditEvent)
+		if err := rows.Scan(&auditEvent.AuditEventId, &auditEvent.EventType, &auditEvent.UserId, &auditEvent.Login, &auditEvent.ActorId, &auditEvent.Ip, &auditEvent.UserAgent, &auditEvent.Outcome, &auditEvent.Details, timeScanner{&auditEvent.CreatedAt}); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		auditEvents = append(auditEvents, auditEvent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return auditEvents, nil
+}
+func (s *Store) RemoveAuditEventsByCreatedAt(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "sqlitestore.RemoveAuditEventsByCreatedAt"
+	result, err := s.db.ExecContext(ctx, removeAuditEventsByCreatedAtQuery, micros(before), limit)
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return rowsAffected(result, op)
+}
+
+// addOutboxEvent записывает событие в outbox в транзакции изменения данных
+func addOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, payload *entity.UserEventPayload) error {
+	payload.OccurredAt = time.Now()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, addOutboxEventQuery, eventType, string(data), micros(payload.OccurredAt))
+	return err
+}
+func (s *Store) ClaimOutboxEvents(ctx context.Context, dto *dto.ClaimOutboxEvents) ([]*entity.OutboxEvent, error) {
+	const op = "sqlitestore.ClaimOutboxEvents"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, claimOutboxEventsQuery, micros(dto.Now), dto.Limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	outboxEvents := []*entity.OutboxEvent{}
+	for rows.Next() {
+		outboxEvent := new(entity.OutboxEvent)
+		if err := rows.Scan(&outboxEvent.OutboxId, &outboxEvent.EventType, (*[]byte)(&outboxEvent.Payload), &outboxEvent.Status, &outboxEvent.Attempts, timeScanner{&outboxEvent.NextAttemptAt}, &outboxEvent.LastError, timeScanner{&outboxEvent.CreatedAt}); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		outboxEvents = append(outboxEvents, outboxEvent)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	for _, outboxEvent := range outboxEvents {
+		if _, err := tx.ExecContext(ctx, lockOutboxEventQuery, outboxEvent.OutboxId, micros(dto.LockedUntil)); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return outboxEvents, nil
+}
+func (s *Store) UpdateOutboxEvent(ctx context.Context, dto *dto.UpdateOutboxEvent) error {
+	const op = "sqlitestore.UpdateOutboxEvent"
+	_, err := s.db.ExecContext(ctx, updateOutboxEventQuery, dto.OutboxId, dto.Status, dto.Attempts, micros(dto.NextAttemptAt), dto.LastError, nullMicros(dto.SentAt))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+
+func (s *Store) AddWebhookSubscription(ctx context.Context, dto *dto.AddWebhookSubscription) (*uuid.UUID, error) {
+	const op = "sqlitestore.AddWebhookSubscription"
+	eventTypes, err := json.Marshal(dto.EventTypes)
+	if err != nil {
+		return nil, errors.Wrap(repository.ErrInternalServerError, op)
+	}
+	subscriptionId := new(uuid.UUID)
+	err = s.db.QueryRowContext(ctx, addWebhookSubscriptionQuery, dto.Url, dto.Secret, string(eventTypes), micros(time.Now())).Scan(subscriptionId)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return subscriptionId, nil
+}
+func (s *Store) GetWebhookSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	const op = "sqlitestore.GetWebhookSubscriptions"
+	rows, err := s.db.QueryContext(ctx, getWebhookSubscriptionsQuery)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	subscriptions := []*entity.WebhookSubscription{}
+	for rows.Next() {
+		subscription := new(entity.WebhookSubscription)
+		var eventTypes []byte
+		if err := rows.Scan(&subscription.SubscriptionId, &subscription.Url, &subscription.Secret, &eventTypes, timeScanner{&subscription.CreatedAt}); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		if err := json.Unmarshal(eventTypes, &subscription.EventTypes); err != nil {
+			return nil, errors.Wrap(repository.ErrInternalServerError, op)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return subscriptions, nil
+}
+func (s *Store) RemoveWebhookSubscription(ctx context.Context, subscriptionId *uuid.UUID) error {
+	const op = "sqlitestore.RemoveWebhookSubscription"
+	err := s.db.QueryRowContext(ctx, removeWebhookSubscriptionQuery, subscriptionId).Scan(subscriptionId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) AddWebhookDeliveries(ctx context.Context, dto *dto.AddWebhookDeliveries) (int64, error) {
+	const op = "sqlitestore.AddWebhookDeliveries"
+	result, err := s.db.ExecContext(ctx, addWebhookDeliveriesQuery, dto.EventId, dto.EventType, string(dto.Payload), micros(time.Now()))
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return rowsAffected(result, op)
+}
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, dto *dto.ClaimWebhookDeliveries) ([]*entity.WebhookDelivery, error) {
+	const op = "sqlitestore.ClaimWebhookDeliveries"
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, claimWebhookDeliveriesQuery, micros(dto.Now), dto.Limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	for _, delivery := range deliveries {
+		if _, err := tx.ExecContext(ctx, lockWebhookDeliveryQuery, delivery.DeliveryId, micros(dto.LockedUntil)); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return deliveries, nil
+}
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, dto *dto.UpdateWebhookDelivery) error {
+	const op = "sqlitestore.UpdateWebhookDelivery"
+	_, err := s.db.ExecContext(ctx, updateWebhookDeliveryQuery, dto.DeliveryId, dto.Status, dto.Attempts, micros(dto.NextAttemptAt), dto.LastStatusCode, dto.LastError, nullMicros(dto.DeliveredAt))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) AddWebhookDeliveryAttempt(ctx context.Context, dto *dto.AddWebhookDeliveryAttempt) error {
+	const op = "sqlitestore.AddWebhookDeliveryAttempt"
+	_, err := s.db.ExecContext(ctx, addWebhookDeliveryAttemptQuery, dto.DeliveryId, dto.StatusCode, dto.Error, micros(time.Now()))
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetWebhookDeliveries(ctx context.Context, dto *dto.GetWebhookDeliveries) ([]*entity.WebhookDelivery, error) {
+	const op = "sqlitestore.GetWebhookDeliveries"
+	rows, err := s.db.QueryContext(ctx, getWebhookDeliveriesQuery, dto.SubscriptionId, dto.Limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return deliveries, nil
+}
+func (s *Store) ReplayWebhookDelivery(ctx context.Context, deliveryId *uuid.UUID, now time.Time) error {
+	const op = "sqlitestore.ReplayWebhookDelivery"
+	err := s.db.QueryRowContext(ctx, replayWebhookDeliveryQuery, deliveryId, micros(now)).Scan(deliveryId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func scanWebhookDeliveries(rows *sql.Rows) ([]*entity.WebhookDelivery, error) {
+	defer rows.Close()
+	deliveries := []*entity.WebhookDelivery{}
+	for rows.Next() {
+		delivery := new(entity.WebhookDelivery)
+		if err := rows.Scan(&delivery.DeliveryId, &delivery.SubscriptionId, &delivery.EventId, &delivery.EventType, (*[]byte)(&delivery.Payload), &delivery.Status, &delivery.Attempts, timeScanner{&delivery.NextAttemptAt}, &delivery.LastStatusCode, &delivery.LastError, timeScanner{&delivery.CreatedAt}, nullTimeScanner{&delivery.DeliveredAt}, &delivery.Url, &delivery.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+func (s *Store) GetJobRun(ctx context.Context, name string) (*entity.JobRun, error) {
+	const op = "sqlitestore.GetJobRun"
+	jobRun := new(entity.JobRun)
+	var durationMs int64
+	err := s.db.QueryRowContext(ctx, getJobRunQuery, name).Scan(&jobRun.Name, &jobRun.Instance, timeScanner{&jobRun.StartedAt}, &durationMs, &jobRun.Outcome, &jobRun.Error, &jobRun.RowsAffected)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	jobRun.Duration = time.Duration(durationMs) * time.Millisecond
+	return jobRun, nil
+}
+func (s *Store) SaveJobRun(ctx context.Context, dto *dto.SaveJobRun) error {
+	const op = "sqlitestore.SaveJobRun"
+	_, err := s.db.ExecContext(ctx, saveJobRunQuery, dto.Name, dto.Instance, micros(dto.StartedAt), dto.Duration.Milliseconds(), dto.Outcome, dto.Error, dto.RowsAffected)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func rowsAffected(result sql.Result, op string) (int64, error) {
+	count, err := result.RowsAffected()
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return count, nil
+}
+
+// micros переводит время в формат хранения - микросекунды Unix
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+func nullMicros(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMicro()
+}
+
+// timeScanner читает время из микросекунд Unix
+type timeScanner struct {
+	t *time.Time
+}
+
+func (s timeScanner) Scan(src any) error {
+	value, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("unsupported time value %T", src)
+	}
+	*s.t = time.UnixMicro(value)
+	return nil
+}
+
+// nullTimeScanner читает время, допускающее NULL
+type nullTimeScanner struct {
+	t **time.Time
+}
+
+func (s nullTimeScanner) Scan(src any) error {
+	if src == nil {
+		*s.t = nil
+		return nil
+	}
+	*s.t = new(time.Time)
+	return timeScanner{*s.t}.Scan(src)
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteError sqlite3.Error
+	return errors.As(err, &sqliteError) && sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// storeError отличает недоступность базы данных (файл заблокирован другим процессом) от прочих ошибок
+func storeError(err error) error {
+	var sqliteError sqlite3.Error
+	if errors.As(err, &sqliteError) && (sqliteError.Code == sqlite3.ErrBusy || sqliteError.Code == sqlite3.ErrLocked) {
+		return repository.ErrUnavailable
+	}
+	return repository.ErrInternalServerError
+}
@@ -0,0 +1,23 @@
+package sqlitestore
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/repositorytest"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		store := MustNew(slog.New(slog.NewTextHandler(io.Discard, nil)), &config.Store{
+			Driver:      config.StoreDriverSQLite,
+			Path:        filepath.Join(t.TempDir(), "auth.db"),
+			AutoMigrate: true,
+		})
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
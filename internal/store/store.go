@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
@@ -10,6 +11,9 @@ import (
 	"skillsRockGRPC/internal/entity"
 	"skillsRockGRPC/internal/repository"
 	"skillsRockGRPC/internal/repository/dto"
+	"skillsRockGRPC/internal/tracing"
+	"skillsRockGRPC/migration"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,11 +24,18 @@ import (
 )
 
 const (
+	migrationLockQuery = `
+SELECT pg_advisory_lock(hashtext('auth.migration'));`
+	migrationUnlockQuery = `
+SELECT pg_advisory_unlock(hashtext('auth.migration'));`
 	addUserQuery = `
 INSERT INTO "user" (login,password) 
 VALUES ($1, $2) RETURNING user_id;`
+	getUserQuery = `
+SELECT user_id,login,password,role FROM "user" 
+WHERE user_id=$1;`
 	getUserByLoginQuery = `
-SELECT * FROM "user" 
+SELECT user_id,login,password,role FROM "user" 
 WHERE login=$1;`
 	updateUserQuery = `
 UPDATE "user" SET 
@@ -32,24 +43,149 @@ login = CASE WHEN $2::character varying IS NULL THEN login ELSE $2 END,
 password = CASE WHEN $3::character varying IS NULL THEN password ELSE $3 END
 WHERE user_id=$1
 RETURNING user_id;`
+	addPasswordHistoryQuery = `
+INSERT INTO password_history (user_id,password) 
+VALUES ($1, $2);`
+	getPasswordHistoryQuery = `
+SELECT password FROM password_history
+WHERE user_id=$1
+ORDER BY created_at DESC
+LIMIT $2;`
+	prunePasswordHistoryQuery = `
+DELETE FROM password_history
+WHERE user_id=$1 AND password_history_id NOT IN (
+SELECT password_history_id FROM password_history WHERE user_id=$1 ORDER BY created_at DESC LIMIT $2);`
 	removeUserQuery = `
 DELETE FROM "user" WHERE user_id=$1 RETURNING user_id;`
 	addRefreshTokenWithRefreshTokenIdQuery = `
-INSERT INTO refresh_token VALUES ($1,$2,$3,$4,$5);`
+INSERT INTO refresh_token (refresh_token_id,user_id,device_code,expiration_at,is_revoke,revoked_at) 
+VALUES ($1,$2,$3,$4,$5,CASE WHEN $5 THEN now() END);`
 	getRefreshTokenQuery = `
-SELECT * FROM refresh_token 
+SELECT refresh_token_id,user_id,device_code,expiration_at,is_revoke,revoked_at FROM refresh_token 
 WHERE refresh_token_id=$1;`
 	revokeRefreshTokensByUserIdAndDeviceCodeQuery = `
 UPDATE refresh_token 
-SET is_revoke=true
-WHERE user_id=$1 AND ($2::character varying IS NULL OR device_code=$2);`
+SET is_revoke=true, revoked_at=now()
+WHERE user_id=$1 AND ($2::character varying IS NULL OR device_code=$2) AND is_revoke=false;`
 	revokeRefreshTokenByRefreshTokenIdQuery = `
 UPDATE refresh_token 
-SET is_revoke=true
+SET is_revoke=true, revoked_at=COALESCE(revoked_at, now())
 WHERE refresh_token_id = $1;`
+	getActiveRefreshTokensByUserIdQuery = `
+SELECT refresh_token_id,user_id,device_code,expiration_at,is_revoke,revoked_at FROM refresh_token
+WHERE user_id=$1 AND is_revoke=false AND expiration_at > $2
+ORDER BY expiration_at;`
 	removeRefreshTokensByExpirationAtQuery = `
 DELETE FROM refresh_token
-WHERE expiration_at < $1;`
+WHERE refresh_token_id IN (
+SELECT refresh_token_id FROM refresh_token
+WHERE expiration_at < $1
+LIMIT $2
+FOR UPDATE SKIP LOCKED);`
+	removeRefreshTokensByRevokedAtQuery = `
+DELETE FROM refresh_token
+WHERE refresh_token_id IN (
+SELECT refresh_token_id FROM refresh_token
+WHERE is_revoke AND revoked_at < $1
+LIMIT $2
+FOR UPDATE SKIP LOCKED);`
+	addImpersonationQuery = `
+INSERT INTO impersonation (impersonation_id,admin_id,user_id,reason,expiration_at) 
+VALUES ($1,$2,$3,$4,$5);`
+	getActiveImpersonationsByUserIdQuery = `
+SELECT impersonation_id,admin_id,user_id,reason,created_at,expiration_at FROM impersonation
+WHERE user_id=$1 AND expiration_at > $2
+ORDER BY created_at;`
+	addAuditEventQuery = `
+INSERT INTO audit_event (event_type,user_id,login,actor_id,ip,user_agent,outcome,details,created_at) 
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9);`
+	getAuditEventsQuery = `
+SELECT audit_event_id,event_type,user_id,login,actor_id,ip,user_agent,outcome,details,created_at FROM audit_event
+WHERE ($1::timestamptz IS NULL OR created_at >= $1) 
+AND ($2::timestamptz IS NULL OR created_at < $2) 
+AND ($3::uuid IS NULL OR user_id = $3)
+ORDER BY created_at DESC
+LIMIT $4;`
+	removeAuditEventsByCreatedAtQuery = `
+DELETE FROM audit_event
+WHERE audit_event_id IN (
+SELECT audit_event_id FROM audit_event
+WHERE created_at < $1
+LIMIT $2
+FOR UPDATE SKIP LOCKED);`
+	addOutboxEventQuery = `
+INSERT INTO outbox (event_type,payload) 
+VALUES ($1,$2);`
+	claimOutboxEventsQuery = `
+UPDATE outbox SET locked_until=$3
+WHERE outbox_id IN (
+	SELECT outbox_id FROM outbox
+	WHERE status='pending' AND next_attempt_at <= $1 AND (locked_until IS NULL OR locked_until < $1)
+	ORDER BY created_at
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED)
+RETURNING outbox_id,event_type,payload,status,attempts,next_attempt_at,last_error,created_at;`
+	updateOutboxEventQuery = `
+UPDATE outbox SET 
+status=$2, attempts=$3, next_attempt_at=$4, last_error=$5, sent_at=$6, locked_until=NULL
+WHERE outbox_id=$1;`
+	addWebhookSubscriptionQuery = `
+INSERT INTO webhook_subscription (url,secret,event_types) 
+VALUES ($1,$2,$3) RETURNING subscription_id;`
+	getWebhookSubscriptionsQuery = `
+SELECT subscription_id,url,secret,event_types,created_at FROM webhook_subscription
+ORDER BY created_at;`
+	removeWebhookSubscriptionQuery = `
+DELETE FROM webhook_subscription WHERE subscription_id=$1 RETURNING subscription_id;`
+	addWebhookDeliveriesQuery = `
+INSERT INTO webhook_delivery (subscription_id,event_id,event_type,payload)
+SELECT subscription_id,$1,$2,$3 FROM webhook_subscription
+WHERE $2 = ANY(event_types)
+ON CONFLICT (subscription_id,event_id) DO NOTHING;`
+	claimWebhookDeliveriesQuery = `
+WITH claimed AS (
+	UPDATE webhook_delivery SET locked_until=$3
+	WHERE delivery_id IN (
+		SELECT delivery_id FROM webhook_delivery
+		WHERE status='pending' AND next_attempt_at <= $1 AND (locked_until IS NULL OR locked_until < $1)
+		ORDER BY created_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED)
+	RETURNING *)
+SELECT c.delivery_id,c.subscription_id,c.event_id,c.event_type,c.payload,c.status,c.attempts,c.next_attempt_at,c.last_status_code,c.last_error,c.created_at,c.delivered_at,s.url,s.secret 
+FROM claimed c JOIN webhook_subscription s ON s.subscription_id=c.subscription_id
+ORDER BY c.created_at;`
+	updateWebhookDeliveryQuery = `
+UPDATE webhook_delivery SET 
+status=$2, attempts=$3, next_attempt_at=$4, last_status_code=$5, last_error=$6, delivered_at=$7, locked_until=NULL
+WHERE delivery_id=$1;`
+	addWebhookDeliveryAttemptQuery = `
+INSERT INTO webhook_delivery_attempt (delivery_id,status_code,error) 
+VALUES ($1,$2,$3);`
+	getWebhookDeliveriesQuery = `
+SELECT d.delivery_id,d.subscription_id,d.event_id,d.event_type,d.payload,d.status,d.attempts,d.next_attempt_at,d.last_status_code,d.last_error,d.created_at,d.delivered_at,s.url,s.secret 
+FROM webhook_delivery d JOIN webhook_subscription s ON s.subscription_id=d.subscription_id
+WHERE ($1::uuid IS NULL OR d.subscription_id=$1)
+ORDER BY d.created_at DESC
+LIMIT $2;`
+	tryLockJobQuery = `
+SELECT pg_try_advisory_lock(hashtext('auth.job.' || $1));`
+	unlockJobQuery = `
+SELECT pg_advisory_unlock(hashtext('auth.job.' || $1));`
+	getJobRunQuery = `
+SELECT name,instance,started_at,duration_ms,outcome,error,rows_affected FROM job_run
+WHERE name=$1;`
+	saveJobRunQuery = `
+INSERT INTO job_run (name,instance,started_at,duration_ms,outcome,error,rows_affected) 
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+ON CONFLICT (name) DO UPDATE SET 
+instance=EXCLUDED.instance, started_at=EXCLUDED.started_at, duration_ms=EXCLUDED.duration_ms,
+outcome=EXCLUDED.outcome, error=EXCLUDED.error, rows_affected=EXCLUDED.rows_affected;`
+	replayWebhookDeliveryQuery = `
+UPDATE webhook_delivery SET 
+status='pending', attempts=0, next_attempt_at=$2, locked_until=NULL, delivered_at=NULL
+WHERE delivery_id=$1
+RETURNING delivery_id;`
 )
 
 type Store struct {
@@ -61,7 +197,7 @@ func MustNew(lg *slog.Logger, cfg *config.Store) *Store {
 	connString := fmt.Sprintf(
 		`user=%s password=%s host=%s port=%d dbname=%s sslmode=%s pool_max_conns=%d pool_max_conn_lifetime=%s pool_max_conn_idle_time=%s`,
 		cfg.User,
-		cfg.Password,
+		string(cfg.Password),
 		cfg.Host,
 		cfg.Port,
 		cfg.Name,
@@ -75,6 +211,7 @@ func MustNew(lg *slog.Logger, cfg *config.Store) *Store {
 		log.Fatalf("STORE: %v\n", err)
 	}
 	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheDescribe
+	config.ConnConfig.Tracer = tracing.NewPgxTracer()
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		log.Fatalf("STORE: %v\n", err)
@@ -82,103 +219,554 @@ func MustNew(lg *slog.Logger, cfg *config.Store) *Store {
 	if err := pool.Ping(context.Background()); err != nil {
 		log.Fatalf("STORE: %v\n", err)
 	}
-	return &Store{
+	s := &Store{
 		pool,
 		lg,
 	}
+	if cfg.AutoMigrate {
+		if err := s.migrate(context.Background(), cfg); err != nil {
+			log.Fatalf("STORE: %v\n", err)
+		}
+	}
+	return s
 }
 
-func (s *Store) AddUser(dto *dto.AddUser) (*uuid.UUID, error) {
+// migrate применяет встроенные миграции под advisory lock, чтобы при одновременном запуске нескольких
+// экземпляров схему обновлял только один, а остальные дождались его и проверили версию
+func (s *Store) migrate(ctx context.Context, cfg *config.Store) error {
+	const op = "store.migrate"
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, migrationLockQuery); err != nil {
+		return errors.Wrap(err, op)
+	}
+	defer conn.Exec(context.Background(), migrationUnlockQuery)
+	from, to, err := migration.Up(cfg)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	if from != to {
+		s.lg.Info("STORE: schema migrated", slog.Any("from", from), slog.Any("to", to))
+	}
+	return nil
+}
+
+// Close закрывает пул соединений, дожидаясь возврата занятых соединений
+func (s *Store) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+// Stat - статистика пула соединений
+func (s *Store) Stat() *pgxpool.Stat {
+	return s.pool.Stat()
+}
+
+// Ping проверяет доступность базы данных
+func (s *Store) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *Store) AddUser(ctx context.Context, dto *dto.AddUser) (*uuid.UUID, error) {
 	const op = "store.AddUser"
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback(ctx)
 	userId := new(uuid.UUID)
-	err := s.pool.QueryRow(context.Background(), addUserQuery, dto.Login, dto.Password).Scan(userId)
+	err = tx.QueryRow(ctx, addUserQuery, dto.Login, dto.Password).Scan(userId)
 	if err != nil {
 		if pgError, ok := err.(*pgconn.PgError); ok && pgError.Code == "23505" {
 			return nil, errors.Wrap(repository.ErrUniqueViolation, op)
 
 		}
-		return nil, errors.Wrap(repository.ErrInternalServerError, op)
+		return nil, errors.Wrap(storeError(err), op)
 
 	}
+	if _, err := tx.Exec(ctx, addPasswordHistoryQuery, userId, dto.Password); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	if err := addOutboxEvent(ctx, tx, entity.EventUserRegistered, &entity.UserEventPayload{UserId: userId, Login: dto.Login}); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
 	return userId, nil
 }
-func (s *Store) GetUserByLogin(login string) (*entity.User, error) {
+func (s *Store) GetUser(ctx context.Context, userId *uuid.UUID) (*entity.User, error) {
+	const op = "store.GetUser"
+	user := new(entity.User)
+	err := s.pool.QueryRow(ctx, getUserQuery, userId).Scan(&user.UserId, &user.Login, &user.Password, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return user, nil
+}
+func (s *Store) GetUserByLogin(ctx context.Context, login string) (*entity.User, error) {
 	const op = "store.GetUserByLogin"
 	user := new(entity.User)
-	err := s.pool.QueryRow(context.Background(), getUserByLoginQuery, login).Scan(&user.UserId, &user.Login, &user.Password)
+	err := s.pool.QueryRow(ctx, getUserByLoginQuery, login).Scan(&user.UserId, &user.Login, &user.Password, &user.Role)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
 		}
-		return nil, errors.Wrap(repository.ErrInternalServerError, op)
+		return nil, errors.Wrap(storeError(err), op)
 	}
 	return user, err
 }
-func (s *Store) UpdateUser(dto *dto.UpdateUser) error {
+func (s *Store) UpdateUser(ctx context.Context, dto *dto.UpdateUser) error {
 	const op = "store.UpdateUser"
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback(ctx)
 	userId := new(uuid.UUID)
-	err := s.pool.QueryRow(context.Background(), updateUserQuery, dto.UserId, dto.Login, dto.Password).Scan(userId)
+	err = tx.QueryRow(ctx, updateUserQuery, dto.UserId, dto.Login, dto.Password).Scan(userId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return errors.Wrap(repository.ErrRecordNotFound, op)
 		}
-		return errors.Wrap(repository.ErrInternalServerError, op)
+		if pgError, ok := err.(*pgconn.PgError); ok && pgError.Code == "23505" {
+			return errors.Wrap(repository.ErrUniqueViolation, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	if dto.Password != nil {
+		if _, err := tx.Exec(ctx, addPasswordHistoryQuery, userId, dto.Password); err != nil {
+			return errors.Wrap(storeError(err), op)
+		}
+		if dto.PasswordHistorySize > 0 {
+			if _, err := tx.Exec(ctx, prunePasswordHistoryQuery, userId, dto.PasswordHistorySize); err != nil {
+				return errors.Wrap(storeError(err), op)
+			}
+		}
+		if err := addOutboxEvent(ctx, tx, entity.EventPasswordChanged, &entity.UserEventPayload{UserId: userId}); err != nil {
+			return errors.Wrap(storeError(err), op)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(storeError(err), op)
 	}
 	return nil
 }
-func (s *Store) RemoveUser(userId *uuid.UUID) error {
+
+// GetPasswordHistory возвращает хеши последних limit паролей пользователя, включая текущий
+func (s *Store) GetPasswordHistory(ctx context.Context, userId *uuid.UUID, limit int) ([]string, error) {
+	const op = "store.GetPasswordHistory"
+	rows, err := s.pool.Query(ctx, getPasswordHistoryQuery, userId, limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	passwords := []string{}
+	for rows.Next() {
+		var password string
+		if err := rows.Scan(&password); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		passwords = append(passwords, password)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return passwords, nil
+}
+func (s *Store) RemoveUser(ctx context.Context, userId *uuid.UUID) error {
 	const op = "store.RemoveUser"
-	err := s.pool.QueryRow(context.Background(), removeUserQuery, userId).Scan(userId)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback(ctx)
+	err = tx.QueryRow(ctx, removeUserQuery, userId).Scan(userId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return errors.Wrap(repository.ErrRecordNotFound, op)
 		}
-		return errors.Wrap(repository.ErrInternalServerError, op)
+		return errors.Wrap(storeError(err), op)
+	}
+	if err := addOutboxEvent(ctx, tx, entity.EventUserDeleted, &entity.UserEventPayload{UserId: userId}); err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(storeError(err), op)
 	}
 	return nil
 }
 
-func (s *Store) AddRefreshTokenWithRefreshTokenId(dto *dto.AddRefreshTokenWithRefreshTokenId) error {
+func (s *Store) AddRefreshTokenWithRefreshTokenId(ctx context.Context, dto *dto.AddRefreshTokenWithRefreshTokenId) error {
 	const op = "store.AddRefreshTokenWithRefreshTokenId"
-	_, err := s.pool.Exec(context.Background(), addRefreshTokenWithRefreshTokenIdQuery, dto.RefreshTokenId, dto.UserId, dto.DeviceCode, dto.ExpirationAt, dto.IsRevoke)
+	_, err := s.pool.Exec(ctx, addRefreshTokenWithRefreshTokenIdQuery, dto.RefreshTokenId, dto.UserId, dto.DeviceCode, dto.ExpirationAt, dto.IsRevoke)
 	if err != nil {
-		return errors.Wrap(repository.ErrInternalServerError, op)
+		return errors.Wrap(storeError(err), op)
 	}
 	return nil
 }
-func (s *Store) GetRefreshToken(refreshTokenId *uuid.UUID) (*entity.RefreshToken, error) {
+func (s *Store) GetRefreshToken(ctx context.Context, refreshTokenId *uuid.UUID) (*entity.RefreshToken, error) {
 	const op = "store.GetRefreshToken"
 	refreshToken := new(entity.RefreshToken)
-	err := s.pool.QueryRow(context.Background(), getRefreshTokenQuery, refreshTokenId).Scan(&refreshToken.RefreshTokenId, &refreshToken.UserId, &refreshToken.DeviceCode, &refreshToken.ExpirationAt, &refreshToken.IsRevoke)
+	err := s.pool.QueryRow(ctx, getRefreshTokenQuery, refreshTokenId).Scan(&refreshToken.RefreshTokenId, &refreshToken.UserId, &refreshToken.DeviceCode, &refreshToken.ExpirationAt, &refreshToken.IsRevoke, &refreshToken.RevokedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
 		}
-		return nil, errors.Wrap(repository.ErrInternalServerError, op)
+		return nil, errors.Wrap(storeError(err), op)
 	}
 	return refreshToken, nil
 }
-func (s *Store) RevokeRefreshTokenByRefreshTokenId(refreshTokenId *uuid.UUID) error {
+func (s *Store) RevokeRefreshTokenByRefreshTokenId(ctx context.Context, refreshTokenId *uuid.UUID) error {
 	const op = "store.RevokeRefreshTokenByRefreshTokenIdAndIsRevoke"
-	_, err := s.pool.Exec(context.Background(), revokeRefreshTokenByRefreshTokenIdQuery, refreshTokenId)
+	_, err := s.pool.Exec(ctx, revokeRefreshTokenByRefreshTokenIdQuery, refreshTokenId)
 	if err != nil {
-		return errors.Wrap(repository.ErrInternalServerError, op)
+		return errors.Wrap(storeError(err), op)
 	}
 	return nil
 }
-func (s *Store) RevokeRefreshTokensByUserIdAndDeviceCode(dto *dto.RevokeRefreshTokensByUserIdAndDeviceCode) error {
+func (s *Store) RevokeRefreshTokensByUserIdAndDeviceCode(ctx context.Context, dto *dto.RevokeRefreshTokensByUserIdAndDeviceCode) error {
 	const op = "store.RevokeRefreshTokensByUserIdAndDeviceCode"
-	_, err := s.pool.Exec(context.Background(), revokeRefreshTokensByUserIdAndDeviceCodeQuery, dto.UserId, dto.DeviceCode)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	defer tx.Rollback(ctx)
+	result, err := tx.Exec(ctx, revokeRefreshTokensByUserIdAndDeviceCodeQuery, dto.UserId, dto.DeviceCode)
 	if err != nil {
-		return errors.Wrap(repository.ErrInternalServerError, op)
+		return errors.Wrap(storeError(err), op)
+	}
+	if result.RowsAffected() > 0 {
+		payload := &entity.UserEventPayload{UserId: dto.UserId}
+		if dto.DeviceCode != nil {
+			payload.DeviceCode = *dto.DeviceCode
+		}
+		if err := addOutboxEvent(ctx, tx, entity.EventSessionRevoked, payload); err != nil {
+			return errors.Wrap(storeError(err), op)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(storeError(err), op)
 	}
 	return nil
 }
-func (s *Store) RemoveRefreshTokensByExpirationAt(now time.Time) (int64, error) {
+func (s *Store) GetActiveRefreshTokensByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.RefreshToken, error) {
+	const op = "store.GetActiveRefreshTokensByUserId"
+	rows, err := s.pool.Query(ctx, getActiveRefreshTokensByUserIdQuery, userId, now)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	refreshTokens := []*entity.RefreshToken{}
+	for rows.Next() {
+		refreshToken := new(entity.RefreshToken)
+		if err := rows.Scan(&refreshToken.RefreshTokenId, &refreshToken.UserId, &refreshToken.DeviceCode, &refreshToken.ExpirationAt, &refreshToken.IsRevoke, &refreshToken.RevokedAt); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return refreshTokens, nil
+}
+func (s *Store) RemoveRefreshTokensByExpirationAt(ctx context.Context, now time.Time, limit int) (int64, error) {
 	const op = "store.RemoveRefreshTokensByExpirationAtQuery"
-	result, err := s.pool.Exec(context.Background(), removeRefreshTokensByExpirationAtQuery, now)
+	result, err := s.pool.Exec(ctx, removeRefreshTokensByExpirationAtQuery, now, limit)
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return result.RowsAffected(), nil
+}
+func (s *Store) RemoveRefreshTokensByRevokedAt(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "store.RemoveRefreshTokensByRevokedAt"
+	result, err := s.pool.Exec(ctx, removeRefreshTokensByRevokedAtQuery, before, limit)
 	if err != nil {
-		return -1, errors.Wrap(repository.ErrInternalServerError, op)
+		return -1, errors.Wrap(storeError(err), op)
 	}
 	return result.RowsAffected(), nil
 }
+
+func (s *Store) AddImpersonation(ctx context.Context, dto *dto.AddImpersonation) error {
+	const op = "store.AddImpersonation"
+	_, err := s.pool.Exec(ctx, addImpersonationQuery, dto.ImpersonationId, dto.AdminId, dto.UserId, dto.Reason, dto.ExpirationAt)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetActiveImpersonationsByUserId(ctx context.Context, userId *uuid.UUID, now time.Time) ([]*entity.Impersonation, error) {
+	const op = "store.GetActiveImpersonationsByUserId"
+	rows, err := s.pool.Query(ctx, getActiveImpersonationsByUserIdQuery, userId, now)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	impersonations := []*entity.Impersonation{}
+	for rows.Next() {
+		impersonation := new(entity.Impersonation)
+		if err := rows.Scan(&impersonation.ImpersonationId, &impersonation.AdminId, &impersonation.UserId, &impersonation.Reason, &impersonation.CreatedAt, &impersonation.ExpirationAt); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		impersonations = append(impersonations, impersonation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return impersonations, nil
+}
+
+func (s *Store) AddAuditEvent(ctx context.Context, dto *dto.AddAuditEvent) error {
+	const op = "store.AddAuditEvent"
+	_, err := s.pool.Exec(ctx, addAuditEventQuery, dto.EventType, dto.UserId, dto.Login, dto.ActorId, dto.Ip, dto.UserAgent, dto.Outcome, dto.Details, dto.CreatedAt)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetAuditEvents(ctx context.Context, dto *dto.GetAuditEvents) ([]*entity.AuditEvent, error) {
+	const op = "store.GetAuditEvents"
+	rows, err := s.pool.Query(ctx, getAuditEventsQuery, dto.From, dto.To, dto.UserId, dto.Limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	auditEvents := []*entity.AuditEvent{}
+	for rows.Next() {
+		auditEvent := new(entity.AuditEvent)
+		if err := rows.Scan(&auditEvent.AuditEventId, &auditEvent.EventType, &auditEvent.UserId, &auditEvent.Login, &auditEvent.ActorId, &auditEvent.Ip, &auditEvent.UserAgent, &auditEvent.Outcome, &auditEvent.Details, &auditEvent.CreatedAt); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		auditEvents = append(auditEvents, auditEvent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return auditEvents, nil
+}
+func (s *Store) RemoveAuditEventsByCreatedAt(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "store.RemoveAuditEventsByCreatedAt"
+	result, err := s.pool.Exec(ctx, removeAuditEventsByCreatedAtQuery, before, limit)
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return result.RowsAffected(), nil
+}
+
+// addOutboxEvent записывает событие в outbox в транзакции изменения данных
+func addOutboxEvent(ctx context.Context, tx pgx.Tx, eventType string, payload *entity.UserEventPayload) error {
+	payload.OccurredAt = time.Now()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, addOutboxEventQuery, eventType, data)
+	return err
+}
+func (s *Store) ClaimOutboxEvents(ctx context.Context, dto *dto.ClaimOutboxEvents) ([]*entity.OutboxEvent, error) {
+	const op = "store.ClaimOutboxEvents"
+	rows, err := s.pool.Query(ctx, claimOutboxEventsQuery, dto.Now, dto.Limit, dto.LockedUntil)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	outboxEvents := []*entity.OutboxEvent{}
+	for rows.Next() {
+		outboxEvent := new(entity.OutboxEvent)
+		if err := rows.Scan(&outboxEvent.OutboxId, &outboxEvent.EventType, &outboxEvent.Payload, &outboxEvent.Status, &outboxEvent.Attempts, &outboxEvent.NextAttemptAt, &outboxEvent.LastError, &outboxEvent.CreatedAt); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		outboxEvents = append(outboxEvents, outboxEvent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	//RETURNING не сохраняет порядок подзапроса
+	slices.SortFunc(outboxEvents, func(a, b *entity.OutboxEvent) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return outboxEvents, nil
+}
+func (s *Store) UpdateOutboxEvent(ctx context.Context, dto *dto.UpdateOutboxEvent) error {
+	const op = "store.UpdateOutboxEvent"
+	_, err := s.pool.Exec(ctx, updateOutboxEventQuery, dto.OutboxId, dto.Status, dto.Attempts, dto.NextAttemptAt, dto.LastError, dto.SentAt)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+
+func (s *Store) AddWebhookSubscription(ctx context.Context, dto *dto.AddWebhookSubscription) (*uuid.UUID, error) {
+	const op = "store.AddWebhookSubscription"
+	subscriptionId := new(uuid.UUID)
+	err := s.pool.QueryRow(ctx, addWebhookSubscriptionQuery, dto.Url, dto.Secret, dto.EventTypes).Scan(subscriptionId)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return subscriptionId, nil
+}
+func (s *Store) GetWebhookSubscriptions(ctx context.Context) ([]*entity.WebhookSubscription, error) {
+	const op = "store.GetWebhookSubscriptions"
+	rows, err := s.pool.Query(ctx, getWebhookSubscriptionsQuery)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	defer rows.Close()
+	subscriptions := []*entity.WebhookSubscription{}
+	for rows.Next() {
+		subscription := new(entity.WebhookSubscription)
+		if err := rows.Scan(&subscription.SubscriptionId, &subscription.Url, &subscription.Secret, &subscription.EventTypes, &subscription.CreatedAt); err != nil {
+			return nil, errors.Wrap(storeError(err), op)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return subscriptions, nil
+}
+func (s *Store) RemoveWebhookSubscription(ctx context.Context, subscriptionId *uuid.UUID) error {
+	const op = "store.RemoveWebhookSubscription"
+	err := s.pool.QueryRow(ctx, removeWebhookSubscriptionQuery, subscriptionId).Scan(subscriptionId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) AddWebhookDeliveries(ctx context.Context, dto *dto.AddWebhookDeliveries) (int64, error) {
+	const op = "store.AddWebhookDeliveries"
+	result, err := s.pool.Exec(ctx, addWebhookDeliveriesQuery, dto.EventId, dto.EventType, dto.Payload)
+	if err != nil {
+		return -1, errors.Wrap(storeError(err), op)
+	}
+	return result.RowsAffected(), nil
+}
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, dto *dto.ClaimWebhookDeliveries) ([]*entity.WebhookDelivery, error) {
+	const op = "store.ClaimWebhookDeliveries"
+	rows, err := s.pool.Query(ctx, claimWebhookDeliveriesQuery, dto.Now, dto.Limit, dto.LockedUntil)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return deliveries, nil
+}
+func (s *Store) UpdateWebhookDelivery(ctx context.Context, dto *dto.UpdateWebhookDelivery) error {
+	const op = "store.UpdateWebhookDelivery"
+	_, err := s.pool.Exec(ctx, updateWebhookDeliveryQuery, dto.DeliveryId, dto.Status, dto.Attempts, dto.NextAttemptAt, dto.LastStatusCode, dto.LastError, dto.DeliveredAt)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) AddWebhookDeliveryAttempt(ctx context.Context, dto *dto.AddWebhookDeliveryAttempt) error {
+	const op = "store.AddWebhookDeliveryAttempt"
+	_, err := s.pool.Exec(ctx, addWebhookDeliveryAttemptQuery, dto.DeliveryId, dto.StatusCode, dto.Error)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func (s *Store) GetWebhookDeliveries(ctx context.Context, dto *dto.GetWebhookDeliveries) ([]*entity.WebhookDelivery, error) {
+	const op = "store.GetWebhookDeliveries"
+	rows, err := s.pool.Query(ctx, getWebhookDeliveriesQuery, dto.SubscriptionId, dto.Limit)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	return deliveries, nil
+}
+func (s *Store) ReplayWebhookDelivery(ctx context.Context, deliveryId *uuid.UUID, now time.Time) error {
+	const op = "store.ReplayWebhookDelivery"
+	err := s.pool.QueryRow(ctx, replayWebhookDeliveryQuery, deliveryId, now).Scan(deliveryId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+func scanWebhookDeliveries(rows pgx.Rows) ([]*entity.WebhookDelivery, error) {
+	defer rows.Close()
+	deliveries := []*entity.WebhookDelivery{}
+	for rows.Next() {
+		delivery := new(entity.WebhookDelivery)
+		if err := rows.Scan(&delivery.DeliveryId, &delivery.SubscriptionId, &delivery.EventId, &delivery.EventType, &delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt, &delivery.Url, &delivery.Secret); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// TryLock захватывает advisory lock задачи планировщика без ожидания. Блокировка сессионная, ее удерживает
+// соединение из пула до вызова unlock
+func (s *Store) TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error) {
+	const op = "store.TryLock"
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(storeError(err), op)
+	}
+	if err := conn.QueryRow(ctx, tryLockJobQuery, name).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, errors.Wrap(storeError(err), op)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+	return func() {
+		if _, err := conn.Exec(context.Background(), unlockJobQuery, name); err != nil {
+			//соединение с неснятой блокировкой нельзя возвращать в пул
+			s.lg.Error("STORE: job lock is not released", slog.String("job", name), slog.Any("error", err))
+			conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}, true, nil
+}
+func (s *Store) GetJobRun(ctx context.Context, name string) (*entity.JobRun, error) {
+	const op = "store.GetJobRun"
+	jobRun := new(entity.JobRun)
+	var durationMs int64
+	err := s.pool.QueryRow(ctx, getJobRunQuery, name).Scan(&jobRun.Name, &jobRun.Instance, &jobRun.StartedAt, &durationMs, &jobRun.Outcome, &jobRun.Error, &jobRun.RowsAffected)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.Wrap(repository.ErrRecordNotFound, op)
+		}
+		return nil, errors.Wrap(storeError(err), op)
+	}
+	jobRun.Duration = time.Duration(durationMs) * time.Millisecond
+	return jobRun, nil
+}
+func (s *Store) SaveJobRun(ctx context.Context, dto *dto.SaveJobRun) error {
+	const op = "store.SaveJobRun"
+	_, err := s.pool.Exec(ctx, saveJobRunQuery, dto.Name, dto.Instance, dto.StartedAt, dto.Duration.Milliseconds(), dto.Outcome, dto.Error, dto.RowsAffected)
+	if err != nil {
+		return errors.Wrap(storeError(err), op)
+	}
+	return nil
+}
+
+// storeError отличает недоступность базы данных (ошибка подключения или истекшее ожидание) от прочих ошибок
+func storeError(err error) error {
+	var connectError *pgconn.ConnectError
+	if err != nil && (pgconn.Timeout(err) || errors.As(err, &connectError)) {
+		return repository.ErrUnavailable
+	}
+	return repository.ErrInternalServerError
+}
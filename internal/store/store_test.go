@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/repositorytest"
+	"testing"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+const truncateQuery = `
+TRUNCATE "user",refresh_token,password_history,impersonation,audit_event,outbox,
+	webhook_subscription,webhook_delivery,webhook_delivery_attempt,job_run;`
+
+// TestRepository требует базу данных с примененными миграциями, параметры подключения берутся из
+// переменных окружения AUTH_STORE_*. Все таблицы очищаются перед каждым тестом
+func TestRepository(t *testing.T) {
+	if os.Getenv("AUTH_STORE_NAME") == "" {
+		t.Skip("AUTH_STORE_NAME is not set")
+	}
+	cfg := new(config.Store)
+	if err := cleanenv.ReadEnv(cfg); err != nil {
+		t.Fatal(err)
+	}
+	store := MustNew(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	t.Cleanup(store.pool.Close)
+	repositorytest.Run(t, func(t *testing.T) repository.Repository {
+		if _, err := store.pool.Exec(context.Background(), truncateQuery); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
@@ -0,0 +1,204 @@
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCA         = errors.New("no certificates found in CA file")
+	ErrNoPeerCertificate = errors.New("server did not present a certificate")
+	ErrNoServerName      = errors.New("server name is required to verify the server certificate")
+)
+
+// Reloader хранит сертификат, ключ и пул доверенных CA и перечитывает их при изменении файлов.
+// Если новые файлы не удается загрузить, продолжают использоваться ранее загруженные
+type Reloader struct {
+	lg       *slog.Logger
+	certPath string
+	keyPath  string
+	caPath   string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+
+	chStop chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New загружает файлы. certPath/keyPath и caPath необязательны, пустой путь не загружается
+func New(lg *slog.Logger, certPath string, keyPath string, caPath string) (*Reloader, error) {
+	r := &Reloader{
+		lg:       lg,
+		certPath: certPath,
+		keyPath:  keyPath,
+		caPath:   caPath,
+		modTimes: map[string]time.Time{},
+		chStop:   make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch проверяет время изменения файлов с заданным интервалом до вызова Stop
+func (r *Reloader) Watch(interval time.Duration) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.chStop:
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.load(); err != nil {
+					r.lg.Error("TLS: certificate reload error", slog.String("cert", r.certPath), slog.Any("error", err))
+					continue
+				}
+				r.lg.Info("TLS: certificate reloaded", slog.String("cert", r.certPath), slog.String("ca", r.caPath))
+			}
+		}
+	}()
+}
+func (r *Reloader) Stop() {
+	close(r.chStop)
+	r.wg.Wait()
+}
+
+// ServerConfig - конфигурация сервера. При заданном CA сертификат клиента проверяется по нему, clientAuth
+// определяет, обязан ли клиент его предъявить: tls.RequireAndVerifyClientCert или tls.VerifyClientCertIfGiven
+func (r *Reloader) ServerConfig(clientAuth tls.ClientAuthType, nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   nextProtos,
+			}
+			if r.pool != nil {
+				cfg.ClientCAs = r.pool
+				cfg.ClientAuth = clientAuth
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig - конфигурация клиента. Сертификат предъявляется серверу, если он загружен. Сервер
+// проверяется по загруженному CA, а без него - по системным корневым сертификатам. Имя сервера берется
+// из serverName или адреса подключения, без имени соединение отклоняется
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			if r.cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return r.cert, nil
+		},
+	}
+	if r.caPath == "" {
+		return cfg
+	}
+	//RootCAs нельзя заменить после создания соединения, поэтому цепочка проверяется вручную по текущему пулу
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrNoPeerCertificate
+		}
+		r.mu.RLock()
+		pool := r.pool
+		r.mu.RUnlock()
+		opts := x509.VerifyOptions{
+			Roots:         pool,
+			DNSName:       serverName,
+			Intermediates: x509.NewCertPool(),
+		}
+		if opts.DNSName == "" {
+			opts.DNSName = cs.ServerName
+		}
+		//без имени Verify проверяет только цепочку, и подошел бы сертификат любого сервера того же CA
+		if opts.DNSName == "" {
+			return ErrNoServerName
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return cfg
+}
+
+func (r *Reloader) load() error {
+	var cert *tls.Certificate
+	if r.certPath != "" {
+		keyPair, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+		if err != nil {
+			return err
+		}
+		cert = &keyPair
+	}
+	var pool *x509.CertPool
+	if r.caPath != "" {
+		caPem, err := os.ReadFile(r.caPath)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPem) {
+			return ErrInvalidCA
+		}
+	}
+	modTimes := map[string]time.Time{}
+	for _, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert - сертификат и ключ, выпущенные для теста
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issue выпускает сертификат, подписанный parent, или самоподписанный CA, если parent не задан
+func issue(t *testing.T, name string, parent *testCert, dnsNames ...string) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write записывает сертификат и ключ и сдвигает время изменения, чтобы Watch заметил замену файлов
+func (c *testCert) write(t *testing.T, certPath string, keyPath string, modTime time.Time) {
+	t.Helper()
+	writeFile(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), modTime)
+	if keyPath == "" {
+		return
+	}
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	writeFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), modTime)
+}
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+// handshake соединяет клиента и сервер через loopback и возвращает сертификат сервера. В TLS 1.3 клиент
+// завершает handshake до проверки своего сертификата, поэтому учитывается и ошибка сервера
+func handshake(t *testing.T, server *tls.Config, client *tls.Config) (*x509.Certificate, error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	chErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			chErr <- err
+			return
+		}
+		defer conn.Close()
+		chErr <- tls.Server(conn, server).Handshake()
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), client)
+	if serverErr := <-chErr; err == nil {
+		err = serverErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	modTime := time.Now().Add(-time.Minute)
+	firstCA, secondCA := issue(t, "first ca", nil), issue(t, "second ca", nil)
+	first := issue(t, "first", firstCA, "auth.local")
+	first.write(t, path("server.pem"), path("server.key"), modTime)
+	firstCA.write(t, path("ca.pem"), "", modTime)
+	issue(t, "client", firstCA).write(t, path("client.pem"), path("client.key"), modTime)
+
+	lg := slog.New(slog.DiscardHandler)
+	server, err := New(lg, path("server.pem"), path("server.key"), path("ca.pem"))
+	if err != nil {
+		t.Fatalf("New server: %v", err)
+	}
+	client, err := New(lg, path("client.pem"), path("client.key"), path("ca.pem"))
+	if err != nil {
+		t.Fatalf("New client: %v", err)
+	}
+	cert, err := handshake(t, server.ServerConfig(tls.RequireAndVerifyClientCert), client.ClientConfig("auth.local"))
+	if err != nil || !cert.Equal(first.cert) {
+		t.Fatalf("handshake = %v, %v", cert, err)
+	}
+
+	//сертификат сервера и CA заменяются без перезапуска, ранее созданные конфигурации видят новые файлы
+	serverConfig, clientConfig := server.ServerConfig(tls.RequireAndVerifyClientCert), client.ClientConfig("auth.local")
+	server.Watch(10 * time.Millisecond)
+	defer server.Stop()
+	second := issue(t, "second", secondCA, "auth.local")
+	modTime = modTime.Add(time.Second)
+	second.write(t, path("server.pem"), path("server.key"), modTime)
+	writeFile(t, path("ca.pem"), append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: firstCA.der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: secondCA.der})...,
+	), modTime)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.mu.RLock()
+		reloaded := server.cert.Leaf.Equal(second.cert)
+		server.mu.RUnlock()
+		if reloaded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server certificate is not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	//клиент еще доверяет только первому CA
+	if _, err := handshake(t, serverConfig, clientConfig); err == nil {
+		t.Fatal("handshake with server certificate from unknown CA succeeded")
+	}
+	if err := client.load(); err != nil {
+		t.Fatalf("client reload: %v", err)
+	}
+	cert, err = handshake(t, serverConfig, clientConfig)
+	if err != nil || !cert.Equal(second.cert) {
+		t.Fatalf("handshake after reload = %v, %v", cert, err)
+	}
+
+	//неверный файл не заменяет загруженный сертификат
+	modTime = modTime.Add(time.Second)
+	writeFile(t, path("server.pem"), []byte("not a certificate"), modTime)
+	if err := server.load(); err == nil {
+		t.Fatal("load of invalid certificate succeeded")
+	}
+	cert, err = handshake(t, serverConfig, clientConfig)
+	if err != nil || !cert.Equal(second.cert) {
+		t.Fatalf("handshake after invalid reload = %v, %v", cert, err)
+	}
+}
+
+func TestClientConfigVerification(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	modTime := time.Now()
+	ca, otherCA := issue(t, "ca", nil), issue(t, "other ca", nil)
+	ca.write(t, path("ca.pem"), "", modTime)
+	lg := slog.New(slog.DiscardHandler)
+	client, err := New(lg, "", "", path("ca.pem"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	serverConfig := func(cert *testCert) *tls.Config {
+		return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.der}, PrivateKey: cert.key}}}
+	}
+
+	tests := []struct {
+		name       string
+		server     *tls.Config
+		serverName string
+		ok         bool
+	}{
+		{name: "trusted", server: serverConfig(issue(t, "server", ca, "auth.local")), serverName: "auth.local", ok: true},
+		{name: "unknown ca", server: serverConfig(issue(t, "server", otherCA, "auth.local")), serverName: "auth.local"},
+		{name: "wrong name", server: serverConfig(issue(t, "server", ca, "other.local")), serverName: "auth.local"},
+		{name: "self-signed", server: serverConfig(issue(t, "server", nil, "auth.local")), serverName: "auth.local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := handshake(t, tt.server, client.ClientConfig(tt.serverName))
+			if (err == nil) != tt.ok {
+				t.Fatalf("handshake error = %v", err)
+			}
+		})
+	}
+
+	//без сертификата сервера проверка возвращает ошибку, а не панику
+	if err := client.ClientConfig("auth.local").VerifyConnection(tls.ConnectionState{}); !errors.Is(err, ErrNoPeerCertificate) {
+		t.Fatalf("VerifyConnection without certificates = %v", err)
+	}
+	//без имени сервера соединение отклоняется, а не проверяется только цепочка
+	trusted := issue(t, "server", ca, "auth.local")
+	_, err = handshake(t, serverConfig(trusted), client.ClientConfig(""))
+	if !errors.Is(err, ErrNoServerName) {
+		t.Fatalf("handshake without server name error = %v", err)
+	}
+	if err := client.ClientConfig("").VerifyConnection(tls.ConnectionState{ServerName: "auth.local", PeerCertificates: []*x509.Certificate{trusted.cert}}); err != nil {
+		t.Fatalf("VerifyConnection with server name from connection = %v", err)
+	}
+}
+
+func TestServerConfigRequiresClientCert(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	modTime := time.Now()
+	ca := issue(t, "ca", nil)
+	ca.write(t, path("ca.pem"), "", modTime)
+	issue(t, "server", ca, "auth.local").write(t, path("server.pem"), path("server.key"), modTime)
+	issue(t, "client", issue(t, "other ca", nil)).write(t, path("client.pem"), path("client.key"), modTime)
+	lg := slog.New(slog.DiscardHandler)
+	server, err := New(lg, path("server.pem"), path("server.key"), path("ca.pem"))
+	if err != nil {
+		t.Fatalf("New server: %v", err)
+	}
+
+	//клиент без сертификата и с сертификатом чужого CA не допускаются
+	anonymous, err := New(lg, "", "", path("ca.pem"))
+	if err != nil {
+		t.Fatalf("New anonymous client: %v", err)
+	}
+	if _, err := handshake(t, server.ServerConfig(tls.RequireAndVerifyClientCert), anonymous.ClientConfig("auth.local")); err == nil {
+		t.Fatal("handshake without client certificate succeeded")
+	}
+	foreign, err := New(lg, path("client.pem"), path("client.key"), path("ca.pem"))
+	if err != nil {
+		t.Fatalf("New foreign client: %v", err)
+	}
+	if _, err := handshake(t, server.ServerConfig(tls.RequireAndVerifyClientCert), foreign.ClientConfig("auth.local")); err == nil {
+		t.Fatal("handshake with client certificate from unknown CA succeeded")
+	}
+
+	//с необязательным сертификатом клиент без сертификата допускается, а сертификат чужого CA - нет
+	if _, err := handshake(t, server.ServerConfig(tls.VerifyClientCertIfGiven), anonymous.ClientConfig("auth.local")); err != nil {
+		t.Fatalf("handshake without optional client certificate: %v", err)
+	}
+	if _, err := handshake(t, server.ServerConfig(tls.VerifyClientCertIfGiven), foreign.ClientConfig("auth.local")); err == nil {
+		t.Fatal("handshake with optional client certificate from unknown CA succeeded")
+	}
+}
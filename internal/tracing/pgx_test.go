@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withRecorder подменяет глобальный провайдер трассировки на время теста
+func withRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func TestPgxTracer(t *testing.T) {
+	recorder := withRecorder(t)
+	tracer := NewPgxTracer()
+	parentCtx, parent := Tracer().Start(context.Background(), "parent")
+
+	tests := []struct {
+		name       string
+		sql        string
+		commandTag string
+		err        error
+		wantName   string
+		wantStmt   string
+		wantStatus codes.Code
+	}{
+		{name: "update", sql: "\n\tupdate refresh_token SET is_revoke=true WHERE user_id=$1\n", commandTag: "UPDATE 3", wantName: "postgres UPDATE", wantStmt: "update refresh_token SET is_revoke=true WHERE user_id=$1"},
+		{name: "no rows", sql: "SELECT login FROM users WHERE user_id=$1", err: pgx.ErrNoRows, wantName: "postgres SELECT", wantStmt: "SELECT login FROM users WHERE user_id=$1"},
+		{name: "error", sql: "INSERT INTO users (login) VALUES ($1)", err: errors.New("duplicate key"), wantName: "postgres INSERT", wantStmt: "INSERT INTO users (login) VALUES ($1)", wantStatus: codes.Error},
+		{name: "empty", sql: " ", wantName: "postgres query", wantStmt: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			ctx := tracer.TraceQueryStart(parentCtx, nil, pgx.TraceQueryStartData{SQL: tt.sql})
+			tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag(tt.commandTag), Err: tt.err})
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("ended %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName || span.SpanKind() != trace.SpanKindClient || span.Status().Code != tt.wantStatus {
+				t.Fatalf("span %q kind %v status %v", span.Name(), span.SpanKind(), span.Status())
+			}
+			//спан запроса - дочерний спан вызывающего
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() || span.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+				t.Fatal("query span is not a child of the caller span")
+			}
+			values := attributes(span)
+			if values["db.system"].AsString() != "postgresql" {
+				t.Fatalf("db.system = %v", values["db.system"])
+			}
+			if values["db.statement"].AsString() != tt.wantStmt {
+				t.Fatalf("db.statement = %q", values["db.statement"].AsString())
+			}
+			rowsAffected, ok := values["db.rows_affected"]
+			if tt.wantStatus == codes.Error {
+				if ok || len(span.Events()) != 1 || span.Events()[0].Name != "exception" {
+					t.Fatalf("failed query span: rows affected %v, events %v", rowsAffected, span.Events())
+				}
+				return
+			}
+			if !ok || rowsAffected.AsInt64() != pgconn.NewCommandTag(tt.commandTag).RowsAffected() {
+				t.Fatalf("db.rows_affected = %v", rowsAffected)
+			}
+		})
+	}
+}
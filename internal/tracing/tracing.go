@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"skillsRockGRPC/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOtlp   = "otlp"
+)
+
+const instrumentationName = "skillsRockGRPC"
+
+type Tracing struct {
+	lg       *slog.Logger
+	provider *sdktrace.TracerProvider
+}
+
+// Tracer возвращает трассировщик приложения из глобального провайдера
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// MustNew настраивает глобальный провайдер трассировки и распространение контекста в формате W3C
+// trace context. При экспортере none спаны не записываются, но входящий контекст трассировки
+// передается дальше
+func MustNew(lg *slog.Logger, cfg *config.Tracing) *Tracing {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case ExporterNone:
+		log.Printf("TRACING: span export is disabled\n")
+		return &Tracing{lg: lg}
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOtlp:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	default:
+		log.Fatalf("TRACING: unknown exporter '%s'\n", cfg.Exporter)
+	}
+	if err != nil {
+		log.Fatalf("TRACING: %v\n", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		log.Fatalf("TRACING: %v\n", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	log.Printf("TRACING: spans are exported to '%s'\n", cfg.Exporter)
+
+	return &Tracing{
+		lg:       lg,
+		provider: provider,
+	}
+}
+
+// Stop отправляет накопленные спаны и останавливает экспорт
+func (t *Tracing) Stop(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+	if err := t.provider.Shutdown(ctx); err != nil {
+		t.lg.Error("TRACING: shutdown error", slog.Any("error", err))
+		return err
+	}
+	t.lg.Info("TRACING: stop")
+	return nil
+}
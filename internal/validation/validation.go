@@ -0,0 +1,253 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"skillsRockGRPC/pkg/servererrors"
+	"slices"
+	"unicode/utf8"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Validator проверяет сообщения по ограничениям buf.validate.field из описания proto. Поддерживаются только
+// стандартные правила protovalidate, которые используются в auth.proto и gateway.proto:
+//   - ignore: IGNORE_IF_ZERO_VALUE - пустое значение не проверяется;
+//   - string: min_len, max_len - длина в символах Unicode; pattern - регулярное выражение RE2; uuid - UUID
+//     в виде 8-4-4-4-12 шестнадцатеричных цифр; uri - абсолютный URI со схемой;
+//   - int32: gte, lte;
+//   - repeated: min_items, max_items, items со строковыми правилами.
+//
+// Неподдерживаемое правило, правило другого типа поля и ограничения сообщений и oneof обнаруживаются при
+// создании валидатора. Новое правило в proto добавляется в fieldRules вместе с проверкой и тестом
+type Validator struct {
+	messages map[protoreflect.FullName][]*fieldRule
+}
+
+type fieldRule struct {
+	field   protoreflect.FieldDescriptor
+	rules   *validate.FieldRules
+	pattern *regexp.Regexp
+	items   *regexp.Regexp
+}
+
+// MustNew компилирует ограничения всех сообщений файлов. Ошибка в ограничениях завершает приложение
+func MustNew(files ...protoreflect.FileDescriptor) *Validator {
+	v, err := New(files...)
+	if err != nil {
+		log.Fatalf("VALIDATION: %v\n", err)
+	}
+	return v
+}
+
+// New компилирует ограничения всех сообщений файлов, включая вложенные сообщения
+func New(files ...protoreflect.FileDescriptor) (*Validator, error) {
+	v := &Validator{messages: map[protoreflect.FullName][]*fieldRule{}}
+	for _, file := range files {
+		if err := v.compileAll(file.Messages()); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+func (v *Validator) compileAll(messages protoreflect.MessageDescriptors) error {
+	for i := 0; i < messages.Len(); i++ {
+		if err := v.compile(messages.Get(i)); err != nil {
+			return err
+		}
+		if err := v.compileAll(messages.Get(i).Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (v *Validator) compile(message protoreflect.MessageDescriptor) error {
+	if proto.HasExtension(message.Options(), validate.E_Message) {
+		return fmt.Errorf("%s: message rules are not supported", message.FullName())
+	}
+	oneofs := message.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		if proto.HasExtension(oneofs.Get(i).Options(), validate.E_Oneof) {
+			return fmt.Errorf("%s: oneof rules are not supported", oneofs.Get(i).FullName())
+		}
+	}
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if !proto.HasExtension(field.Options(), validate.E_Field) {
+			continue
+		}
+		rules := proto.GetExtension(field.Options(), validate.E_Field).(*validate.FieldRules)
+		if err := supported(rules.ProtoReflect(), fieldRules); err != nil {
+			return fmt.Errorf("%s: %w", field.FullName(), err)
+		}
+		if items := rules.GetRepeated().GetItems(); items != nil && (items.GetString() == nil || items.GetIgnore() != validate.Ignore_IGNORE_UNSPECIFIED) {
+			return fmt.Errorf("%s: only string rules are supported for repeated items", field.FullName())
+		}
+		if err := matchKind(field, rules); err != nil {
+			return fmt.Errorf("%s: %w", field.FullName(), err)
+		}
+		if ignore := rules.GetIgnore(); ignore != validate.Ignore_IGNORE_UNSPECIFIED && ignore != validate.Ignore_IGNORE_IF_ZERO_VALUE {
+			return fmt.Errorf("%s: unsupported ignore %s", field.FullName(), ignore)
+		}
+		rule := &fieldRule{field: field, rules: rules}
+		var err error
+		if pattern := rules.GetString().GetPattern(); pattern != "" {
+			if rule.pattern, err = regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s: %w", field.FullName(), err)
+			}
+		}
+		if pattern := rules.GetRepeated().GetItems().GetString().GetPattern(); pattern != "" {
+			if rule.items, err = regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s: %w", field.FullName(), err)
+			}
+		}
+		v.messages[message.FullName()] = append(v.messages[message.FullName()], rule)
+	}
+	return nil
+}
+
+// Поддерживаемые правила по полному имени сообщения правил
+var fieldRules = map[protoreflect.FullName][]protoreflect.Name{
+	"buf.validate.FieldRules":    {"ignore", "string", "int32", "repeated"},
+	"buf.validate.StringRules":   {"min_len", "max_len", "pattern", "uuid", "uri"},
+	"buf.validate.Int32Rules":    {"gte", "lte"},
+	"buf.validate.RepeatedRules": {"min_items", "max_items", "items"},
+}
+
+func supported(rules protoreflect.Message, allowed map[protoreflect.FullName][]protoreflect.Name) error {
+	var err error
+	rules.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if !slices.Contains(allowed[rules.Descriptor().FullName()], fd.Name()) {
+			err = fmt.Errorf("unsupported rule %s", fd.FullName())
+			return false
+		}
+		if fd.Message() != nil {
+			err = supported(value.Message(), allowed)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// matchKind проверяет, что правила соответствуют типу поля: иначе правило молча не проверялось бы
+func matchKind(field protoreflect.FieldDescriptor, rules *validate.FieldRules) error {
+	kind := field.Kind()
+	switch {
+	case rules.HasRepeated() && !field.IsList():
+		return fmt.Errorf("repeated rules on non-repeated field")
+	case !rules.HasRepeated() && field.IsList() && (rules.HasString() || rules.HasInt32()):
+		return fmt.Errorf("scalar rules on repeated field, use repeated.items")
+	case rules.HasRepeated() && rules.GetRepeated().GetItems() != nil && kind != protoreflect.StringKind:
+		return fmt.Errorf("string items rules on %s field", kind)
+	case rules.HasString() && kind != protoreflect.StringKind:
+		return fmt.Errorf("string rules on %s field", kind)
+	case rules.HasInt32() && kind != protoreflect.Int32Kind:
+		return fmt.Errorf("int32 rules on %s field", kind)
+	}
+	return nil
+}
+
+// Validate возвращает нарушения ограничений полей сообщения
+func (v *Validator) Validate(message proto.Message) []*servererrors.FieldViolation {
+	m := message.ProtoReflect()
+	var violations []*servererrors.FieldViolation
+	for _, rule := range v.messages[m.Descriptor().FullName()] {
+		violations = append(violations, rule.validate(m)...)
+	}
+	return violations
+}
+func (r *fieldRule) validate(m protoreflect.Message) []*servererrors.FieldViolation {
+	name := r.field.JSONName()
+	if !m.Has(r.field) && r.rules.GetIgnore() == validate.Ignore_IGNORE_IF_ZERO_VALUE {
+		return nil
+	}
+	value := m.Get(r.field)
+	switch {
+	case r.rules.GetRepeated() != nil:
+		return r.validateRepeated(name, value.List())
+	case r.rules.GetString() != nil:
+		if violation := validateString(name, value.String(), r.rules.GetString(), r.pattern); violation != nil {
+			return []*servererrors.FieldViolation{violation}
+		}
+	case r.rules.GetInt32() != nil:
+		if violation := validateInt32(name, int32(value.Int()), r.rules.GetInt32()); violation != nil {
+			return []*servererrors.FieldViolation{violation}
+		}
+	}
+	return nil
+}
+func (r *fieldRule) validateRepeated(name string, list protoreflect.List) []*servererrors.FieldViolation {
+	rules := r.rules.GetRepeated()
+	if rules.HasMinItems() && uint64(list.Len()) < rules.GetMinItems() {
+		return []*servererrors.FieldViolation{violation(name, fmt.Sprintf("must contain at least %d item(s)", rules.GetMinItems()))}
+	}
+	if rules.HasMaxItems() && uint64(list.Len()) > rules.GetMaxItems() {
+		return []*servererrors.FieldViolation{violation(name, fmt.Sprintf("must contain no more than %d item(s)", rules.GetMaxItems()))}
+	}
+	var violations []*servererrors.FieldViolation
+	if items := rules.GetItems().GetString(); items != nil {
+		for i := 0; i < list.Len(); i++ {
+			if violation := validateString(fmt.Sprintf("%s[%d]", name, i), list.Get(i).String(), items, r.items); violation != nil {
+				violations = append(violations, violation)
+			}
+		}
+	}
+	return violations
+}
+func validateString(name string, value string, rules *validate.StringRules, pattern *regexp.Regexp) *servererrors.FieldViolation {
+	length := uint64(utf8.RuneCountInString(value))
+	switch {
+	case rules.HasMinLen() && length < rules.GetMinLen():
+		return violation(name, fmt.Sprintf("length must be at least %d characters", rules.GetMinLen()))
+	case rules.HasMaxLen() && length > rules.GetMaxLen():
+		return violation(name, fmt.Sprintf("length must be at most %d characters", rules.GetMaxLen()))
+	case pattern != nil && !pattern.MatchString(value):
+		return violation(name, fmt.Sprintf("does not match pattern %s", pattern.String()))
+	case rules.GetUuid() && !validUuid(value):
+		return violation(name, "must be a valid UUID")
+	case rules.GetUri() && !validUri(value):
+		return violation(name, "must be a valid URI")
+	}
+	return nil
+}
+func validateInt32(name string, value int32, rules *validate.Int32Rules) *servererrors.FieldViolation {
+	switch {
+	case rules.HasGte() && value < rules.GetGte():
+		return violation(name, fmt.Sprintf("must be greater than or equal to %d", rules.GetGte()))
+	case rules.HasLte() && value > rules.GetLte():
+		return violation(name, fmt.Sprintf("must be less than or equal to %d", rules.GetLte()))
+	}
+	return nil
+}
+func validUuid(value string) bool {
+	_, err := uuid.Parse(value)
+	return err == nil && len(value) == 36
+}
+func validUri(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme != ""
+}
+func violation(field string, description string) *servererrors.FieldViolation {
+	return &servererrors.FieldViolation{Field: field, Err: fmt.Errorf("%s %s", field, description)}
+}
+
+// UnaryServerInterceptor отклоняет запросы, не прошедшие проверку, со статусом InvalidArgument и
+// нарушениями полей в google.rpc.BadRequest. Запросы шлюза проверяются тем же перехватчиком
+func UnaryServerInterceptor(v *Validator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if message, ok := req.(proto.Message); ok {
+			if violations := v.Validate(message); len(violations) != 0 {
+				return nil, servererrors.InvalidArgument(violations...)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,404 @@
+package validation
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	auth "skillsRockGRPC/grpc/gen"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newMessage описывает сообщение validationtest.Test с полем value и правилами rules
+func newMessage(t *testing.T, kind descriptorpb.FieldDescriptorProto_Type, repeated bool, rules *validate.FieldRules) protoreflect.MessageDescriptor {
+	t.Helper()
+	file, err := newFile(kind, repeated, rules, nil)
+	if err != nil {
+		t.Fatalf("new file: %v", err)
+	}
+	return file.Messages().Get(0)
+}
+func newFile(kind descriptorpb.FieldDescriptorProto_Type, repeated bool, rules *validate.FieldRules, edit func(*descriptorpb.DescriptorProto)) (protoreflect.FileDescriptor, error) {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	options := &descriptorpb.FieldOptions{}
+	if rules != nil {
+		proto.SetExtension(options, validate.E_Field, rules)
+	}
+	message := &descriptorpb.DescriptorProto{
+		Name: proto.String("Test"),
+		Field: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("value"),
+			JsonName: proto.String("value"),
+			Number:   proto.Int32(1),
+			Type:     kind.Enum(),
+			Label:    label.Enum(),
+			Options:  options,
+		}},
+	}
+	if edit != nil {
+		edit(message)
+	}
+	return protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("validationtest/test.proto"),
+		Package:     proto.String("validationtest"),
+		Syntax:      proto.String("proto3"),
+		Dependency:  []string{"buf/validate/validate.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{message},
+	}, protoregistry.GlobalFiles)
+}
+
+func stringRules(rules *validate.StringRules) *validate.FieldRules {
+	return validate.FieldRules_builder{String: rules}.Build()
+}
+
+func TestValidate(t *testing.T) {
+	const (
+		stringKind = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		int32Kind  = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	)
+	minLen := stringRules(validate.StringRules_builder{MinLen: proto.Uint64(3)}.Build())
+	maxLen := stringRules(validate.StringRules_builder{MaxLen: proto.Uint64(4)}.Build())
+	pattern := stringRules(validate.StringRules_builder{Pattern: proto.String("^[a-z]+$")}.Build())
+	uuidRules := stringRules(validate.StringRules_builder{Uuid: proto.Bool(true)}.Build())
+	uri := stringRules(validate.StringRules_builder{Uri: proto.Bool(true)}.Build())
+	ignore := validate.FieldRules_builder{
+		Ignore: validate.Ignore_IGNORE_IF_ZERO_VALUE.Enum(),
+		String: validate.StringRules_builder{Uuid: proto.Bool(true)}.Build(),
+	}.Build()
+	int32Rules := validate.FieldRules_builder{Int32: validate.Int32Rules_builder{Gte: proto.Int32(0), Lte: proto.Int32(1000)}.Build()}.Build()
+	repeated := validate.FieldRules_builder{Repeated: validate.RepeatedRules_builder{
+		MinItems: proto.Uint64(1),
+		MaxItems: proto.Uint64(3),
+		Items:    stringRules(validate.StringRules_builder{MinLen: proto.Uint64(1), Pattern: proto.String("^[a-z]*$")}.Build()),
+	}.Build()}.Build()
+
+	tests := []struct {
+		name     string
+		kind     descriptorpb.FieldDescriptorProto_Type
+		rules    *validate.FieldRules
+		value    any
+		field    string
+		contains string
+	}{
+		{name: "min_len", rules: minLen, value: "abc"},
+		{name: "min_len violated", rules: minLen, value: "ab", field: "value", contains: "at least 3"},
+		{name: "max_len counts runes", rules: maxLen, value: "ёжик"},
+		{name: "max_len violated", rules: maxLen, value: "ёжики", field: "value", contains: "at most 4"},
+		{name: "pattern", rules: pattern, value: "abc"},
+		{name: "pattern violated", rules: pattern, value: "ABC", field: "value", contains: "pattern"},
+		{name: "uuid", rules: uuidRules, value: "5b0f1f7e-3c2a-4d8e-9a61-2f4c7d9e8b13"},
+		{name: "uuid violated", rules: uuidRules, value: "not-a-uuid", field: "value", contains: "UUID"},
+		{name: "uuid without hyphens", rules: uuidRules, value: "5b0f1f7e3c2a4d8e9a612f4c7d9e8b13", field: "value", contains: "UUID"},
+		{name: "uuid empty", rules: uuidRules, value: "", field: "value", contains: "UUID"},
+		{name: "uri", rules: uri, value: "https://example.com/hook"},
+		{name: "uri violated", rules: uri, value: "example.com/hook", field: "value", contains: "URI"},
+		{name: "ignore zero value", rules: ignore, value: ""},
+		{name: "ignore checks set value", rules: ignore, value: "x", field: "value", contains: "UUID"},
+		{name: "int32", kind: int32Kind, rules: int32Rules, value: int32(1000)},
+		{name: "int32 zero", kind: int32Kind, rules: int32Rules, value: int32(0)},
+		{name: "gte violated", kind: int32Kind, rules: int32Rules, value: int32(-1), field: "value", contains: "greater than or equal to 0"},
+		{name: "lte violated", kind: int32Kind, rules: int32Rules, value: int32(1001), field: "value", contains: "less than or equal to 1000"},
+		{name: "repeated", rules: repeated, value: []string{"a", "b"}},
+		{name: "min_items violated", rules: repeated, value: []string{}, field: "value", contains: "at least 1 item"},
+		{name: "max_items violated", rules: repeated, value: []string{"a", "b", "c", "d"}, field: "value", contains: "no more than 3 item"},
+		{name: "items violated", rules: repeated, value: []string{"a", ""}, field: "value[1]", contains: "at least 1"},
+		{name: "items pattern violated", rules: repeated, value: []string{"A", "b"}, field: "value[0]", contains: "pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := tt.kind
+			if kind == 0 {
+				kind = stringKind
+			}
+			list, repeated := tt.value.([]string)
+			descriptor := newMessage(t, kind, repeated, tt.rules)
+			v, err := New(descriptor.ParentFile())
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			message := dynamicpb.NewMessage(descriptor)
+			field := descriptor.Fields().Get(0)
+			switch value := tt.value.(type) {
+			case string:
+				message.Set(field, protoreflect.ValueOfString(value))
+			case int32:
+				message.Set(field, protoreflect.ValueOfInt32(value))
+			case []string:
+				for _, item := range list {
+					message.Mutable(field).List().Append(protoreflect.ValueOfString(item))
+				}
+			}
+
+			violations := v.Validate(message)
+			if tt.field == "" {
+				if len(violations) != 0 {
+					t.Fatalf("Validate(%v) = %v, want no violations", tt.value, violations[0].Err)
+				}
+				return
+			}
+			if len(violations) != 1 || violations[0].Field != tt.field || !strings.Contains(violations[0].Err.Error(), tt.contains) {
+				t.Fatalf("Validate(%v) = %+v, want %s violation containing %q", tt.value, violations, tt.field, tt.contains)
+			}
+		})
+	}
+}
+
+func TestNewUnsupported(t *testing.T) {
+	const (
+		stringKind = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		int32Kind  = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	)
+	celRule := validate.Rule_builder{Id: proto.String("test"), Expression: proto.String("true")}.Build()
+	tests := []struct {
+		name     string
+		kind     descriptorpb.FieldDescriptorProto_Type
+		repeated bool
+		rules    *validate.FieldRules
+		edit     func(*descriptorpb.DescriptorProto)
+		contains string
+	}{
+		{name: "string rule", rules: stringRules(validate.StringRules_builder{Email: proto.Bool(true)}.Build()), contains: "unsupported rule buf.validate.StringRules.email"},
+		{name: "string in", rules: stringRules(validate.StringRules_builder{In: []string{"user", "admin"}}.Build()), contains: "unsupported rule buf.validate.StringRules.in"},
+		{name: "required", rules: validate.FieldRules_builder{Required: proto.Bool(true)}.Build(), contains: "unsupported rule buf.validate.FieldRules.required"},
+		{name: "int32 rule", kind: int32Kind, rules: validate.FieldRules_builder{Int32: validate.Int32Rules_builder{Gt: proto.Int32(0)}.Build()}.Build(), contains: "unsupported rule buf.validate.Int32Rules.gt"},
+		{name: "field type", kind: descriptorpb.FieldDescriptorProto_TYPE_BOOL, rules: validate.FieldRules_builder{Bool: validate.BoolRules_builder{Const: proto.Bool(true)}.Build()}.Build(), contains: "unsupported rule buf.validate.FieldRules.bool"},
+		{name: "cel", rules: validate.FieldRules_builder{Cel: []*validate.Rule{celRule}}.Build(), contains: "unsupported rule buf.validate.FieldRules.cel"},
+		{name: "ignore always", rules: validate.FieldRules_builder{Ignore: validate.Ignore_IGNORE_ALWAYS.Enum()}.Build(), contains: "unsupported ignore"},
+		{name: "string rules on int32", kind: int32Kind, rules: stringRules(validate.StringRules_builder{MinLen: proto.Uint64(1)}.Build()), contains: "string rules on int32 field"},
+		{name: "int32 rules on string", rules: validate.FieldRules_builder{Int32: validate.Int32Rules_builder{Gte: proto.Int32(0)}.Build()}.Build(), contains: "int32 rules on string field"},
+		{name: "repeated rules on singular", rules: validate.FieldRules_builder{Repeated: validate.RepeatedRules_builder{MinItems: proto.Uint64(1)}.Build()}.Build(), contains: "repeated rules on non-repeated field"},
+		{name: "string rules on repeated", repeated: true, rules: stringRules(validate.StringRules_builder{MinLen: proto.Uint64(1)}.Build()), contains: "scalar rules on repeated field"},
+		{name: "int32 items", kind: int32Kind, repeated: true, rules: validate.FieldRules_builder{Repeated: validate.RepeatedRules_builder{
+			Items: validate.FieldRules_builder{Int32: validate.Int32Rules_builder{Gte: proto.Int32(0)}.Build()}.Build(),
+		}.Build()}.Build(), contains: "only string rules are supported for repeated items"},
+		{name: "items rule", repeated: true, rules: validate.FieldRules_builder{Repeated: validate.RepeatedRules_builder{
+			Items: stringRules(validate.StringRules_builder{Email: proto.Bool(true)}.Build()),
+		}.Build()}.Build(), contains: "unsupported rule buf.validate.StringRules.email"},
+		{name: "invalid pattern", rules: stringRules(validate.StringRules_builder{Pattern: proto.String("[a-z")}.Build()), contains: "validationtest.Test.value"},
+		{name: "message rules", edit: func(message *descriptorpb.DescriptorProto) {
+			message.Options = &descriptorpb.MessageOptions{}
+			proto.SetExtension(message.Options, validate.E_Message, validate.MessageRules_builder{Cel: []*validate.Rule{celRule}}.Build())
+		}, contains: "message rules are not supported"},
+		{name: "oneof rules", edit: func(message *descriptorpb.DescriptorProto) {
+			options := &descriptorpb.OneofOptions{}
+			proto.SetExtension(options, validate.E_Oneof, validate.OneofRules_builder{Required: proto.Bool(true)}.Build())
+			message.OneofDecl = []*descriptorpb.OneofDescriptorProto{{Name: proto.String("choice"), Options: options}}
+			message.Field[0].OneofIndex = proto.Int32(0)
+		}, contains: "oneof rules are not supported"},
+		{name: "nested message", edit: func(message *descriptorpb.DescriptorProto) {
+			nested := proto.Clone(message).(*descriptorpb.DescriptorProto)
+			nested.Name = proto.String("Nested")
+			proto.SetExtension(nested.Field[0].Options, validate.E_Field, stringRules(validate.StringRules_builder{Email: proto.Bool(true)}.Build()))
+			message.NestedType = append(message.NestedType, nested)
+		}, contains: "validationtest.Test.Nested.value: unsupported rule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := tt.kind
+			if kind == 0 {
+				kind = stringKind
+			}
+			file, err := newFile(kind, tt.repeated, tt.rules, tt.edit)
+			if err != nil {
+				t.Fatalf("new file: %v", err)
+			}
+			if _, err := New(file); err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Fatalf("New error = %v, want %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+// Ограничения сервиса компилируются: иначе MustNew остановит приложение при запуске. Каждое поле с
+// ограничениями проверяется на границах правил из auth.proto
+func TestAuthProto(t *testing.T) {
+	v, err := New(auth.File_grpc_proto_auth_proto)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	const id = "5b0f1f7e-3c2a-4d8e-9a61-2f4c7d9e8b13"
+	repeat := func(s string, count int) string { return strings.Repeat(s, count) }
+	items := func(count int) []string {
+		values := make([]string, count)
+		for i := range values {
+			values[i] = "user.registered"
+		}
+		return values
+	}
+	register := func(login, password string) *auth.RegisterRequest {
+		return &auth.RegisterRequest{Login: login, Password: password}
+	}
+	login := func(login, password, deviceCode string) *auth.LoginRequest {
+		return &auth.LoginRequest{Login: login, Password: password, DeviceCode: deviceCode}
+	}
+	exchange := func(edit func(*auth.ExchangeTokenRequest)) *auth.ExchangeTokenRequest {
+		req := &auth.ExchangeTokenRequest{SubjectToken: "token", ActorName: "billing", ActorSecret: "secret", Audience: "api"}
+		edit(req)
+		return req
+	}
+	subscription := func(url string, eventTypes []string) *auth.CreateWebhookSubscriptionRequest {
+		return &auth.CreateWebhookSubscriptionRequest{Url: url, EventTypes: eventTypes}
+	}
+
+	tests := []struct {
+		name    string
+		message proto.Message
+		field   string
+	}{
+		{name: "register", message: register("a.b_c@d-e", "password")},
+		{name: "register login min_len", message: register("ab", "password"), field: "login"},
+		{name: "register login max_len", message: register(repeat("a", 64), "password")},
+		{name: "register login max_len violated", message: register(repeat("a", 65), "password"), field: "login"},
+		{name: "register login pattern", message: register("al ice", "password"), field: "login"},
+		{name: "register password min_len", message: register("alice", "passwor"), field: "password"},
+		{name: "register password counts runes", message: register("alice", "пароль12")},
+		{name: "register password max_len", message: register("alice", repeat("p", 129)), field: "password"},
+		{name: "unregister", message: &auth.UnregisterRequest{UserId: strings.ToUpper(id)}},
+		{name: "unregister userId empty", message: &auth.UnregisterRequest{}, field: "userId"},
+		{name: "unregister userId without hyphens", message: &auth.UnregisterRequest{UserId: strings.ReplaceAll(id, "-", "")}, field: "userId"},
+		{name: "login", message: login("a", "p", "web:1.2_a-b")},
+		{name: "login login min_len", message: login("", "p", "web"), field: "login"},
+		{name: "login login max_len", message: login(repeat("a", 65), "p", "web"), field: "login"},
+		{name: "login password min_len", message: login("a", "", "web"), field: "password"},
+		{name: "login password max_len", message: login("a", repeat("p", 129), "web"), field: "password"},
+		{name: "login deviceCode min_len", message: login("a", "p", ""), field: "deviceCode"},
+		{name: "login deviceCode max_len", message: login("a", "p", repeat("d", 65)), field: "deviceCode"},
+		{name: "login deviceCode pattern", message: login("a", "p", "my phone"), field: "deviceCode"},
+		{name: "logout userId", message: &auth.LogoutRequest{UserId: "not-a-uuid", DeviceCode: "web"}, field: "userId"},
+		{name: "logout deviceCode", message: &auth.LogoutRequest{UserId: id, DeviceCode: "web/1"}, field: "deviceCode"},
+		{name: "update password userId", message: &auth.UpdatePasswordRequest{NewPassword: "password"}, field: "userId"},
+		{name: "update password newPassword", message: &auth.UpdatePasswordRequest{UserId: id, NewPassword: "short"}, field: "newPassword"},
+		{name: "refresh refreshTokenId", message: &auth.RefreshTokenRequest{RefreshTokenId: "token"}, field: "refreshTokenId"},
+		{name: "exchange", message: exchange(func(req *auth.ExchangeTokenRequest) { req.Scopes = items(32) })},
+		{name: "exchange subjectToken", message: exchange(func(req *auth.ExchangeTokenRequest) { req.SubjectToken = "" }), field: "subjectToken"},
+		{name: "exchange actorName", message: exchange(func(req *auth.ExchangeTokenRequest) { req.ActorName = "" }), field: "actorName"},
+		{name: "exchange actorSecret", message: exchange(func(req *auth.ExchangeTokenRequest) { req.ActorSecret = "" }), field: "actorSecret"},
+		{name: "exchange audience min_len", message: exchange(func(req *auth.ExchangeTokenRequest) { req.Audience = "" }), field: "audience"},
+		{name: "exchange audience max_len", message: exchange(func(req *auth.ExchangeTokenRequest) { req.Audience = repeat("a", 129) }), field: "audience"},
+		{name: "exchange scopes max_items", message: exchange(func(req *auth.ExchangeTokenRequest) { req.Scopes = items(33) }), field: "scopes"},
+		{name: "exchange scopes item min_len", message: exchange(func(req *auth.ExchangeTokenRequest) { req.Scopes = []string{"read", ""} }), field: "scopes[1]"},
+		{name: "exchange scopes item max_len", message: exchange(func(req *auth.ExchangeTokenRequest) { req.Scopes = []string{repeat("s", 65)} }), field: "scopes[0]"},
+		{name: "impersonate userId", message: &auth.ImpersonateRequest{Reason: "support"}, field: "userId"},
+		{name: "impersonate reason min_len", message: &auth.ImpersonateRequest{UserId: id}, field: "reason"},
+		{name: "impersonate reason max_len", message: &auth.ImpersonateRequest{UserId: id, Reason: repeat("r", 513)}, field: "reason"},
+		{name: "list sessions userId", message: &auth.ListSessionsRequest{}, field: "userId"},
+		{name: "audit events zero values", message: &auth.QueryAuditEventsRequest{}},
+		{name: "audit events", message: &auth.QueryAuditEventsRequest{UserId: id, Limit: 1000}},
+		{name: "audit events userId", message: &auth.QueryAuditEventsRequest{UserId: "x"}, field: "userId"},
+		{name: "audit events limit gte", message: &auth.QueryAuditEventsRequest{Limit: -1}, field: "limit"},
+		{name: "audit events limit lte", message: &auth.QueryAuditEventsRequest{Limit: 1001}, field: "limit"},
+		{name: "subscription", message: subscription("https://example.com/hook", items(16))},
+		{name: "subscription url uri", message: subscription("example.com/hook", items(1)), field: "url"},
+		{name: "subscription url max_len", message: subscription("https://example.com/"+repeat("a", 2029), items(1)), field: "url"},
+		{name: "subscription eventTypes min_items", message: subscription("https://example.com/hook", nil), field: "eventTypes"},
+		{name: "subscription eventTypes max_items", message: subscription("https://example.com/hook", items(17)), field: "eventTypes"},
+		{name: "subscription eventTypes item min_len", message: subscription("https://example.com/hook", []string{""}), field: "eventTypes[0]"},
+		{name: "delete subscription subscriptionId", message: &auth.DeleteWebhookSubscriptionRequest{}, field: "subscriptionId"},
+		{name: "deliveries zero values", message: &auth.ListWebhookDeliveriesRequest{}},
+		{name: "deliveries subscriptionId", message: &auth.ListWebhookDeliveriesRequest{SubscriptionId: "x"}, field: "subscriptionId"},
+		{name: "deliveries limit", message: &auth.ListWebhookDeliveriesRequest{Limit: 1001}, field: "limit"},
+		{name: "replay deliveryId", message: &auth.ReplayDeliveryRequest{}, field: "deliveryId"},
+		{name: "run job", message: &auth.RunJobRequest{Name: "purge"}},
+		{name: "run job name min_len", message: &auth.RunJobRequest{}, field: "name"},
+		{name: "run job name max_len", message: &auth.RunJobRequest{Name: repeat("j", 65)}, field: "name"},
+	}
+	tested := map[protoreflect.FullName]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := v.Validate(tt.message)
+			if tt.field == "" {
+				if len(violations) != 0 {
+					t.Fatalf("Validate = %v, want no violations", violations[0].Err)
+				}
+				return
+			}
+			if len(violations) != 1 || violations[0].Field != tt.field {
+				t.Fatalf("Validate = %+v, want %s violation", violations, tt.field)
+			}
+		})
+		if tt.field != "" {
+			field, _, _ := strings.Cut(tt.field, "[")
+			tested[tt.message.ProtoReflect().Descriptor().FullName()+"."+protoreflect.FullName(field)] = true
+		}
+	}
+
+	//нарушение проверено для каждого поля с ограничениями, и каждое поддерживаемое правило используется
+	used := map[protoreflect.FullName]bool{}
+	messages := auth.File_grpc_proto_auth_proto.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		fields := messages.Get(i).Fields()
+		for j := 0; j < fields.Len(); j++ {
+			field := fields.Get(j)
+			if !proto.HasExtension(field.Options(), validate.E_Field) {
+				continue
+			}
+			if name := field.Parent().FullName() + "." + protoreflect.FullName(field.JSONName()); !tested[name] {
+				t.Errorf("no violation test for %s", name)
+			}
+			collectRules(proto.GetExtension(field.Options(), validate.E_Field).(*validate.FieldRules).ProtoReflect(), used)
+		}
+	}
+	for message, names := range fieldRules {
+		descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(message)
+		if err != nil {
+			t.Fatalf("FindDescriptorByName(%s): %v", message, err)
+		}
+		for _, name := range names {
+			if field := descriptor.(protoreflect.MessageDescriptor).Fields().ByName(name); field.Message() == nil && !used[field.FullName()] {
+				t.Errorf("supported rule %s is not used in auth.proto", field.FullName())
+			}
+		}
+	}
+}
+
+// collectRules добавляет в used полные имена заданных правил, не являющихся вложенными сообщениями правил
+func collectRules(rules protoreflect.Message, used map[protoreflect.FullName]bool) {
+	rules.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if fd.Message() != nil {
+			collectRules(value.Message(), used)
+		} else {
+			used[fd.FullName()] = true
+		}
+		return true
+	})
+}
+
+// gateway.proto повторяет сообщения auth.proto для grpc-gateway, ограничения полей должны совпадать
+func TestGatewayProtoRules(t *testing.T) {
+	rules := func(path string) map[string][]string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		byMessage := map[string][]string{}
+		var message string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if name, ok := strings.CutPrefix(line, "message "); ok {
+				message = strings.TrimSuffix(strings.TrimSpace(name), "{")
+			}
+			if strings.Contains(line, "(buf.validate.field)") {
+				byMessage[message] = append(byMessage[message], strings.Join(strings.Fields(line), " "))
+			}
+		}
+		return byMessage
+	}
+	authRules := rules("../../grpc/proto/auth.proto")
+	gatewayRules := rules("../../grpc/proto/gateway.proto")
+	if len(authRules) == 0 || !maps.EqualFunc(authRules, gatewayRules, slices.Equal) {
+		t.Fatalf("field rules differ:\nauth.proto:    %v\ngateway.proto: %v", authRules, gatewayRules)
+	}
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"skillsRockGRPC/internal/outbox"
+)
+
+// SignatureHeader содержит время отправки и подпись тела запроса: "t=<unix time>,v1=<hex hmac>".
+// Подписывается строка "<unix time>.<тело запроса>" ключом подписки или Outbox.WebhookSecret по алгоритму HMAC-SHA256
+const SignatureHeader = outbox.SignatureHeader
+
+var (
+	ErrInvalidSignatureHeader = errors.New("invalid signature header")
+	ErrSignatureMismatch      = errors.New("signature mismatch")
+	ErrSignatureExpired       = errors.New("signature timestamp is outside the tolerance")
+)
+
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + computeSignature(secret, t, body)
+}
+
+// Verify проверяет заголовок подписи на стороне получателя. tolerance ограничивает возраст подписи
+// и защищает от повторной отправки перехваченного запроса
+func Verify(secret string, header string, body []byte, tolerance time.Duration) error {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidSignatureHeader
+		}
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	if t == "" || v1 == "" {
+		return ErrInvalidSignatureHeader
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidSignatureHeader
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+	if !hmac.Equal([]byte(v1), []byte(computeSignature(secret, t, body))) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func computeSignature(secret string, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1","type":"user.registered"}`)
+	now := time.Now()
+	valid := Sign("secret", now, body)
+	unix := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		want   error
+	}{
+		{name: "valid", secret: "secret", header: valid, body: body},
+		{name: "spaces after comma", secret: "secret", header: "t=" + unix + ", v1=" + valid[len("t="+unix+",v1="):], body: body},
+		{name: "unknown parts are ignored", secret: "secret", header: valid + ",v0=legacy", body: body},
+		{name: "wrong secret", secret: "other", header: valid, body: body, want: ErrSignatureMismatch},
+		{name: "changed body", secret: "secret", header: valid, body: []byte(`{"id":"2"}`), want: ErrSignatureMismatch},
+		{name: "changed timestamp", secret: "secret", header: "t=" + strconv.FormatInt(now.Unix()-1, 10) + valid[len("t="+unix):], body: body, want: ErrSignatureMismatch},
+		{name: "expired", secret: "secret", header: Sign("secret", now.Add(-2*time.Minute), body), body: body, want: ErrSignatureExpired},
+		{name: "from future", secret: "secret", header: Sign("secret", now.Add(2*time.Minute), body), body: body, want: ErrSignatureExpired},
+		{name: "empty", secret: "secret", header: "", body: body, want: ErrInvalidSignatureHeader},
+		{name: "no signature", secret: "secret", header: "t=" + unix, body: body, want: ErrInvalidSignatureHeader},
+		{name: "no timestamp", secret: "secret", header: valid[len("t="+unix+","):], body: body, want: ErrInvalidSignatureHeader},
+		{name: "part without value", secret: "secret", header: valid + ",v1", body: body, want: ErrInvalidSignatureHeader},
+		{name: "timestamp is not a number", secret: "secret", header: "t=now" + valid[len("t="+unix):], body: body, want: ErrInvalidSignatureHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, time.Minute); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify(%q) = %v, want %v", tt.header, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/outbox"
+	"skillsRockGRPC/internal/repository"
+	"skillsRockGRPC/internal/repository/dto"
+)
+
+// Webhook рассылает события подписчикам. Как outbox.Publisher он создает доставки для подписок на тип
+// события, метод Deliver отправляет подписанные запросы и повторяет неудачные с экспоненциальной задержкой
+type Webhook struct {
+	store  repository.Repository
+	client *http.Client
+	lg     *slog.Logger
+	cfg    *config.Webhook
+}
+
+func New(store repository.Repository, lg *slog.Logger, cfg *config.Webhook) *Webhook {
+	return &Webhook{
+		store: store,
+		//перенаправление обходит проверку адреса подписки, ответ 3xx считается неудачной попыткой
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		lg:  lg,
+		cfg: cfg,
+	}
+}
+
+// Publish создает доставки события. Реле повторяет событие целиком, если не сработал другой издатель,
+// поэтому хранилище пропускает уже созданные доставки той же подписки и события
+func (w *Webhook) Publish(ctx context.Context, outboxEvent *entity.OutboxEvent) error {
+	if _, err := w.store.AddWebhookDeliveries(ctx, &dto.AddWebhookDeliveries{
+		EventId:   outboxEvent.OutboxId,
+		EventType: outboxEvent.EventType,
+		Payload:   outboxEvent.Payload,
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Deliver отправляет одну пачку доставок и возвращает количество успешных
+func (w *Webhook) Deliver(ctx context.Context, now time.Time) (int64, error) {
+	deliveries, err := w.store.ClaimWebhookDeliveries(ctx, &dto.ClaimWebhookDeliveries{
+		Now:         now,
+		LockedUntil: now.Add(w.cfg.LockTimeout),
+		Limit:       w.cfg.BatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, delivery := range deliveries {
+		statusCode, sendErr := w.send(ctx, delivery)
+		attempt := &dto.AddWebhookDeliveryAttempt{
+			DeliveryId: delivery.DeliveryId,
+			StatusCode: statusCode,
+		}
+		if sendErr != nil {
+			attempt.Error = sendErr.Error()
+		}
+		if err := w.store.AddWebhookDeliveryAttempt(ctx, attempt); err != nil {
+			return count, err
+		}
+		update := &dto.UpdateWebhookDelivery{
+			DeliveryId:     delivery.DeliveryId,
+			Status:         entity.WebhookDeliveryStatusDelivered,
+			Attempts:       delivery.Attempts + 1,
+			NextAttemptAt:  delivery.NextAttemptAt,
+			LastStatusCode: statusCode,
+			LastError:      attempt.Error,
+		}
+		if sendErr == nil {
+			deliveredAt := time.Now()
+			update.DeliveredAt = &deliveredAt
+			count++
+		} else if update.Attempts >= w.cfg.MaxAttempts {
+			update.Status = entity.WebhookDeliveryStatusFailed
+			w.lg.Error("WEBHOOK: delivery failed", slog.String("deliveryId", delivery.DeliveryId.String()), slog.String("url", delivery.Url), slog.Any("error", sendErr))
+		} else {
+			update.Status = entity.WebhookDeliveryStatusPending
+			update.NextAttemptAt = time.Now().Add(outbox.Backoff(update.Attempts, w.cfg.BackoffBase, w.cfg.BackoffMax))
+			w.lg.Warn("WEBHOOK: delivery error", slog.String("deliveryId", delivery.DeliveryId.String()), slog.Int("attempts", update.Attempts), slog.Any("error", sendErr))
+		}
+		if err := w.store.UpdateWebhookDelivery(ctx, update); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func (w *Webhook) send(ctx context.Context, delivery *entity.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(&outbox.Message{
+		Id:        delivery.EventId.String(),
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Event-Id", delivery.EventId.String())
+	req.Header.Set("X-Auth-Event-Type", delivery.EventType)
+	req.Header.Set("X-Auth-Delivery-Id", delivery.DeliveryId.String())
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, time.Now(), body))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
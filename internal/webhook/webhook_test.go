@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/internal/config"
+	"skillsRockGRPC/internal/entity"
+	"skillsRockGRPC/internal/memstore"
+	"skillsRockGRPC/internal/outbox"
+	"skillsRockGRPC/internal/repository/dto"
+
+	"github.com/google/uuid"
+)
+
+// receiver проверяет подпись запросов и отвечает кодами из statuses по очереди, затем 200
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	messages []outbox.Message
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	if err := Verify(r.secret, req.Header.Get(SignatureHeader), body, time.Minute); err != nil {
+		r.t.Errorf("signature: %v", err)
+	}
+	var message outbox.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		r.t.Errorf("body %s: %v", body, err)
+	}
+	r.requests = append(r.requests, req)
+	r.messages = append(r.messages, message)
+	statusCode := http.StatusOK
+	if len(r.statuses) > 0 {
+		statusCode, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	if statusCode >= 300 && statusCode < 400 {
+		w.Header().Set("Location", "http://127.0.0.1:1/internal")
+	}
+	w.WriteHeader(statusCode)
+}
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// attemptStore запоминает попытки доставки
+type attemptStore struct {
+	*memstore.Store
+	attempts []*dto.AddWebhookDeliveryAttempt
+}
+
+func (s *attemptStore) AddWebhookDeliveryAttempt(ctx context.Context, dto *dto.AddWebhookDeliveryAttempt) error {
+	s.attempts = append(s.attempts, dto)
+	return s.Store.AddWebhookDeliveryAttempt(ctx, dto)
+}
+
+// newTestWebhook создает подписку на user.registered с адресом server и публикует одно событие
+func newTestWebhook(t *testing.T, server *httptest.Server) (*Webhook, *attemptStore, *entity.OutboxEvent) {
+	t.Helper()
+	store := &attemptStore{Store: memstore.New()}
+	if _, err := store.AddWebhookSubscription(context.Background(), &dto.AddWebhookSubscription{
+		Url:        server.URL,
+		Secret:     "subscription-secret",
+		EventTypes: []string{entity.EventUserRegistered},
+	}); err != nil {
+		t.Fatalf("AddWebhookSubscription: %v", err)
+	}
+	w := New(store, slog.New(slog.DiscardHandler), &config.Webhook{
+		BatchSize:   10,
+		MaxAttempts: 3,
+		BackoffBase: time.Second,
+		BackoffMax:  time.Minute,
+		LockTimeout: time.Minute,
+		Timeout:     5 * time.Second,
+	})
+	outboxId := uuid.New()
+	outboxEvent := &entity.OutboxEvent{
+		OutboxId:  &outboxId,
+		EventType: entity.EventUserRegistered,
+		Payload:   json.RawMessage(`{"login":"alice"}`),
+		CreatedAt: time.Now(),
+	}
+	//повторная публикация события не создает вторую доставку, события других типов не доставляются
+	for range 2 {
+		if err := w.Publish(context.Background(), outboxEvent); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	otherId := uuid.New()
+	if err := w.Publish(context.Background(), &entity.OutboxEvent{OutboxId: &otherId, EventType: entity.EventUserDeleted, Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	return w, store, outboxEvent
+}
+
+func delivery(t *testing.T, w *Webhook) *entity.WebhookDelivery {
+	t.Helper()
+	deliveries, err := w.store.GetWebhookDeliveries(context.Background(), &dto.GetWebhookDeliveries{Limit: 10})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("GetWebhookDeliveries = %d deliveries, %v", len(deliveries), err)
+	}
+	return deliveries[0]
+}
+
+func TestDeliver(t *testing.T) {
+	r := &receiver{t: t, secret: "subscription-secret", statuses: []int{http.StatusServiceUnavailable, http.StatusInternalServerError}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	w, store, outboxEvent := newTestWebhook(t, server)
+
+	//неудачные попытки повторяются с экспоненциальной задержкой
+	now := time.Now()
+	for attempt, want := range []struct {
+		statusCode int
+		delay      time.Duration
+	}{{http.StatusServiceUnavailable, time.Second}, {http.StatusInternalServerError, 2 * time.Second}} {
+		if count, err := w.Deliver(context.Background(), now); err != nil || count != 0 || r.count() != attempt+1 {
+			t.Fatalf("Deliver = %d, %v, %d requests", count, err, r.count())
+		}
+		d := delivery(t, w)
+		if d.Status != entity.WebhookDeliveryStatusPending || d.Attempts != attempt+1 || d.LastStatusCode != want.statusCode || d.LastError == "" {
+			t.Fatalf("delivery after failure = %+v", d)
+		}
+		if wait := time.Until(d.NextAttemptAt); wait > want.delay || wait < want.delay-time.Second {
+			t.Fatalf("attempt %d: next attempt in %v, want %v", attempt+1, wait, want.delay)
+		}
+		if count, err := w.Deliver(context.Background(), d.NextAttemptAt.Add(-time.Millisecond)); err != nil || count != 0 || r.count() != attempt+1 {
+			t.Fatalf("Deliver before next attempt = %d, %v", count, err)
+		}
+		now = d.NextAttemptAt
+	}
+
+	if count, err := w.Deliver(context.Background(), now); err != nil || count != 1 {
+		t.Fatalf("Deliver = %d, %v", count, err)
+	}
+	d := delivery(t, w)
+	if d.Status != entity.WebhookDeliveryStatusDelivered || d.Attempts != 3 || d.LastStatusCode != http.StatusOK || d.DeliveredAt == nil {
+		t.Fatalf("delivered delivery = %+v", d)
+	}
+	if len(store.attempts) != 3 || store.attempts[0].StatusCode != http.StatusServiceUnavailable || store.attempts[2].StatusCode != http.StatusOK || store.attempts[2].Error != "" {
+		t.Fatalf("attempts = %+v", store.attempts)
+	}
+
+	//все запросы несут одно событие и заголовки доставки
+	for _, req := range r.requests {
+		if req.Header.Get("X-Auth-Event-Id") != outboxEvent.OutboxId.String() || req.Header.Get("X-Auth-Delivery-Id") != d.DeliveryId.String() {
+			t.Fatalf("delivery headers = %v", req.Header)
+		}
+	}
+	for _, message := range r.messages {
+		if message.Id != outboxEvent.OutboxId.String() || message.Type != outboxEvent.EventType || string(message.Data) != `{"login":"alice"}` {
+			t.Fatalf("message = %+v", message)
+		}
+	}
+	if count, err := w.Deliver(context.Background(), now.Add(time.Hour)); err != nil || count != 0 || r.count() != 3 {
+		t.Fatalf("Deliver of delivered = %d, %v", count, err)
+	}
+}
+
+func TestDeliverFailedAndReplay(t *testing.T) {
+	r := &receiver{t: t, secret: "subscription-secret", statuses: []int{500, 500, 500}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	w, _, _ := newTestWebhook(t, server)
+
+	//после MaxAttempts неудачных попыток доставка переводится в failed и больше не отправляется
+	now := time.Now()
+	for range 3 {
+		if _, err := w.Deliver(context.Background(), now); err != nil {
+			t.Fatalf("Deliver: %v", err)
+		}
+		now = now.Add(time.Hour)
+	}
+	d := delivery(t, w)
+	if d.Status != entity.WebhookDeliveryStatusFailed || d.Attempts != 3 || r.count() != 3 {
+		t.Fatalf("delivery after max attempts = %+v", d)
+	}
+	if count, err := w.Deliver(context.Background(), now); err != nil || count != 0 || r.count() != 3 {
+		t.Fatalf("Deliver of failed = %d, %v", count, err)
+	}
+
+	//повторная отправка сбрасывает счетчик попыток
+	if err := w.store.ReplayWebhookDelivery(context.Background(), d.DeliveryId, now); err != nil {
+		t.Fatalf("ReplayWebhookDelivery: %v", err)
+	}
+	if d := delivery(t, w); d.Status != entity.WebhookDeliveryStatusPending || d.Attempts != 0 {
+		t.Fatalf("replayed delivery = %+v", d)
+	}
+	if count, err := w.Deliver(context.Background(), now); err != nil || count != 1 || r.count() != 4 {
+		t.Fatalf("Deliver of replayed = %d, %v", count, err)
+	}
+	if d := delivery(t, w); d.Status != entity.WebhookDeliveryStatusDelivered || d.Attempts != 1 {
+		t.Fatalf("delivery after replay = %+v", d)
+	}
+}
+
+func TestDeliverRedirect(t *testing.T) {
+	r := &receiver{t: t, secret: "subscription-secret", statuses: []int{http.StatusFound}}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	w, store, _ := newTestWebhook(t, server)
+
+	//перенаправление не выполняется, ответ 3xx - неудачная попытка
+	if count, err := w.Deliver(context.Background(), time.Now()); err != nil || count != 0 || r.count() != 1 {
+		t.Fatalf("Deliver = %d, %v, %d requests", count, err, r.count())
+	}
+	d := delivery(t, w)
+	if d.Status != entity.WebhookDeliveryStatusPending || d.Attempts != 1 || d.LastStatusCode != http.StatusFound || d.LastError == "" {
+		t.Fatalf("delivery after redirect = %+v", d)
+	}
+	if len(store.attempts) != 1 || store.attempts[0].StatusCode != http.StatusFound || store.attempts[0].Error == "" {
+		t.Fatalf("attempts = %+v", store.attempts)
+	}
+}
+
+func TestOutboxWebhookSignature(t *testing.T) {
+	r := &receiver{t: t, secret: "outbox-secret"}
+	server := httptest.NewServer(r)
+	defer server.Close()
+	outboxId := uuid.New()
+	outboxEvent := &entity.OutboxEvent{OutboxId: &outboxId, EventType: entity.EventUserDeleted, Payload: json.RawMessage(`{}`)}
+
+	//издатель outbox подписывает запросы так же, как доставки подписок
+	if err := outbox.NewWebhookPublisher(server.URL, "outbox-secret", Sign).Publish(context.Background(), outboxEvent); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if r.count() != 1 || r.messages[0].Id != outboxId.String() {
+		t.Fatalf("received %d requests", r.count())
+	}
+}
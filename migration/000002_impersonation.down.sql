@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.impersonation;
+ALTER TABLE public."user" DROP COLUMN IF EXISTS role;
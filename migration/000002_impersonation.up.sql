@@ -0,0 +1,12 @@
+ALTER TABLE public."user" ADD COLUMN IF NOT EXISTS role character varying COLLATE pg_catalog."default" NOT NULL DEFAULT 'user';
+CREATE TABLE IF NOT EXISTS public.impersonation
+(
+    impersonation_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    admin_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    reason character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    expiration_at timestamp with time zone NOT NULL,
+    CONSTRAINT impersonation_pk PRIMARY KEY (impersonation_id)
+);
+CREATE INDEX IF NOT EXISTS impersonation_user_id_idx ON public.impersonation (user_id);
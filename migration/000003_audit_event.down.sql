@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.audit_event;
+DROP FUNCTION IF EXISTS public.audit_event_immutable();
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS public.audit_event
+(
+    audit_event_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    event_type character varying COLLATE pg_catalog."default" NOT NULL,
+    user_id uuid,
+    login character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    actor_id character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    ip character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    user_agent character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    outcome character varying COLLATE pg_catalog."default" NOT NULL,
+    details character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT audit_event_pk PRIMARY KEY (audit_event_id)
+);
+CREATE INDEX IF NOT EXISTS audit_event_created_at_idx ON public.audit_event (created_at);
+CREATE INDEX IF NOT EXISTS audit_event_user_id_idx ON public.audit_event (user_id, created_at);
+-- записи журнала аудита не изменяются, удаление допускается только по сроку хранения
+CREATE OR REPLACE FUNCTION public.audit_event_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_event is immutable';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_event_immutable_trigger ON public.audit_event;
+CREATE TRIGGER audit_event_immutable_trigger
+    BEFORE UPDATE ON public.audit_event
+    FOR EACH ROW EXECUTE FUNCTION public.audit_event_immutable();
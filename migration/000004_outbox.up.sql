@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS public.outbox
+(
+    outbox_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    event_type character varying COLLATE pg_catalog."default" NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying COLLATE pg_catalog."default" NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL DEFAULT now(),
+    locked_until timestamp with time zone,
+    last_error character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    sent_at timestamp with time zone,
+    CONSTRAINT outbox_pk PRIMARY KEY (outbox_id)
+);
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON public.outbox (next_attempt_at) WHERE status = 'pending';
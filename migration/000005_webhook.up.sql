@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS public.webhook_subscription
+(
+    subscription_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    url character varying COLLATE pg_catalog."default" NOT NULL,
+    secret character varying COLLATE pg_catalog."default" NOT NULL,
+    event_types character varying[] NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT webhook_subscription_pk PRIMARY KEY (subscription_id)
+);
+CREATE TABLE IF NOT EXISTS public.webhook_delivery
+(
+    delivery_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    subscription_id uuid NOT NULL,
+    event_id uuid NOT NULL,
+    event_type character varying COLLATE pg_catalog."default" NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying COLLATE pg_catalog."default" NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL DEFAULT now(),
+    locked_until timestamp with time zone,
+    last_status_code integer NOT NULL DEFAULT 0,
+    last_error character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    delivered_at timestamp with time zone,
+    CONSTRAINT webhook_delivery_pk PRIMARY KEY (delivery_id),
+    CONSTRAINT webhook_delivery_subscription_id_event_id_key UNIQUE (subscription_id, event_id),
+    CONSTRAINT webhook_delivery_subscription_id_fk FOREIGN KEY (subscription_id)
+        REFERENCES public.webhook_subscription (subscription_id) MATCH SIMPLE
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_pending_idx ON public.webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_delivery_subscription_id_idx ON public.webhook_delivery (subscription_id, created_at);
+CREATE TABLE IF NOT EXISTS public.webhook_delivery_attempt
+(
+    attempt_id uuid NOT NULL DEFAULT gen_random_uuid(),
+    delivery_id uuid NOT NULL,
+    status_code integer NOT NULL DEFAULT 0,
+    error character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT webhook_delivery_attempt_pk PRIMARY KEY (attempt_id),
+    CONSTRAINT webhook_delivery_attempt_delivery_id_fk FOREIGN KEY (delivery_id)
+        REFERENCES public.webhook_delivery (delivery_id) MATCH SIMPLE
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
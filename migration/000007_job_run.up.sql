@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS public.job_run
+(
+    name character varying COLLATE pg_catalog."default" NOT NULL,
+    instance character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    started_at timestamp with time zone NOT NULL,
+    duration_ms bigint NOT NULL DEFAULT 0,
+    outcome character varying COLLATE pg_catalog."default" NOT NULL,
+    error character varying COLLATE pg_catalog."default" NOT NULL DEFAULT '',
+    rows_affected bigint NOT NULL DEFAULT 0,
+    CONSTRAINT job_run_pk PRIMARY KEY (name)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.refresh_token_revoked_at_idx;
+DROP INDEX IF EXISTS public.refresh_token_expiration_at_idx;
+ALTER TABLE public.refresh_token DROP COLUMN IF EXISTS revoked_at;
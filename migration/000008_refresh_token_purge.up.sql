@@ -0,0 +1,5 @@
+ALTER TABLE public.refresh_token ADD COLUMN IF NOT EXISTS revoked_at timestamp with time zone;
+-- время отзыва ранее отозванных токенов неизвестно, срок хранения отсчитывается от миграции
+UPDATE public.refresh_token SET revoked_at = now() WHERE is_revoke AND revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS refresh_token_expiration_at_idx ON public.refresh_token (expiration_at);
+CREATE INDEX IF NOT EXISTS refresh_token_revoked_at_idx ON public.refresh_token (revoked_at) WHERE is_revoke;
@@ -0,0 +1 @@
+ALTER TABLE public.impersonation DROP CONSTRAINT IF EXISTS impersonation_user_id_fk;
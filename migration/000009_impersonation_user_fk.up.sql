@@ -0,0 +1,6 @@
+-- записи имперсонации удаленных пользователей
+DELETE FROM public.impersonation i WHERE NOT EXISTS (SELECT 1 FROM public."user" u WHERE u.user_id = i.user_id);
+ALTER TABLE public.impersonation ADD CONSTRAINT impersonation_user_id_fk FOREIGN KEY (user_id)
+    REFERENCES public."user" (user_id) MATCH SIMPLE
+    ON UPDATE CASCADE
+    ON DELETE CASCADE;
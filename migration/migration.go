@@ -0,0 +1,112 @@
+// Package migration содержит миграции схемы, встроенные в бинарный файл: каталог migration/ для PostgreSQL
+// и migration/sqlite/ для SQLite
+package migration
+
+import (
+	"embed"
+	"io/fs"
+	"net"
+	"net/url"
+	"skillsRockGRPC/internal/config"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pkg/errors"
+)
+
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
+
+var ErrSchemaTooNew = errors.New("schema version is newer than the latest known migration")
+
+// Source возвращает встроенные миграции для драйвера хранилища
+func Source(driver string) (source.Driver, error) {
+	switch driver {
+	case config.StoreDriverPostgres:
+		return iofs.New(files, ".")
+	case config.StoreDriverSQLite:
+		return iofs.New(files, "sqlite")
+	default:
+		return nil, errors.Errorf("store driver '%s' has no migrations", driver)
+	}
+}
+
+// DatabaseUrl строит адрес базы данных для golang-migrate из настроек хранилища
+func DatabaseUrl(cfg *config.Store) (string, error) {
+	switch cfg.Driver {
+	case config.StoreDriverPostgres:
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, string(cfg.Password)),
+			Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+			Path:     "/" + cfg.Name,
+			RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+		}
+		return u.String(), nil
+	case config.StoreDriverSQLite:
+		return "sqlite3://" + cfg.Path, nil
+	default:
+		return "", errors.Errorf("store driver '%s' has no migrations", cfg.Driver)
+	}
+}
+
+// Latest возвращает версию последней миграции источника
+func Latest(src source.Driver) (uint, error) {
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// Up применяет встроенные миграции, которые еще не применены, и возвращает версии схемы до и после.
+// Схема новее последней встроенной миграции означает, что базу данных обновил более новый выпуск
+// сервиса, и возвращается ErrSchemaTooNew. Для схемы dirty, оставленной неудачной миграцией,
+// возвращается ошибка: ее нужно исправить и выполнить migrator force
+func Up(cfg *config.Store) (from uint, to uint, err error) {
+	const op = "migration.Up"
+	databaseUrl, err := DatabaseUrl(cfg)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, op)
+	}
+	src, err := Source(cfg.Driver)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, op)
+	}
+	latest, err := Latest(src)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, op)
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", src, databaseUrl)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, op)
+	}
+	defer m.Close()
+	from, dirty, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return 0, 0, errors.Wrap(err, op)
+	}
+	if dirty {
+		return from, from, errors.Errorf("%s: schema version %d is dirty", op, from)
+	}
+	if from > latest {
+		return from, from, errors.Wrapf(ErrSchemaTooNew, "%s: %d > %d", op, from, latest)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return from, from, errors.Wrap(err, op)
+	}
+	return from, latest, nil
+}
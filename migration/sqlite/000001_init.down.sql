@@ -0,0 +1,2 @@
+DELETE FROM refresh_token;
+DELETE FROM "user";
@@ -0,0 +1,22 @@
+-- SQLite: uuid хранится в TEXT, время - в INTEGER (микросекунды Unix, как точность timestamptz)
+CREATE TABLE IF NOT EXISTS "user"
+(
+    user_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    login TEXT NOT NULL,
+    password TEXT NOT NULL,
+    CONSTRAINT user_pk PRIMARY KEY (user_id),
+    CONSTRAINT user_login_unique UNIQUE (login)
+);
+CREATE TABLE IF NOT EXISTS refresh_token
+(
+    refresh_token_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    user_id TEXT NOT NULL,
+    device_code TEXT NOT NULL,
+    expiration_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    is_revoke INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT refresh_token_pk PRIMARY KEY (refresh_token_id),
+    CONSTRAINT refresh_token_user_id_fk FOREIGN KEY (user_id)
+        REFERENCES "user" (user_id)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
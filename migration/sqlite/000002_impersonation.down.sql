@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS impersonation;
+ALTER TABLE "user" DROP COLUMN role;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS audit_event_immutable_trigger;
+DROP TABLE IF EXISTS audit_event;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS audit_event
+(
+    audit_event_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    event_type TEXT NOT NULL,
+    user_id TEXT,
+    login TEXT NOT NULL DEFAULT '',
+    actor_id TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    CONSTRAINT audit_event_pk PRIMARY KEY (audit_event_id)
+);
+CREATE INDEX IF NOT EXISTS audit_event_created_at_idx ON audit_event (created_at);
+CREATE INDEX IF NOT EXISTS audit_event_user_id_idx ON audit_event (user_id, created_at);
+-- записи журнала аудита не изменяются, удаление допускается только по сроку хранения
+CREATE TRIGGER IF NOT EXISTS audit_event_immutable_trigger
+    BEFORE UPDATE ON audit_event
+BEGIN
+    SELECT RAISE(ABORT, 'audit_event is immutable');
+END;
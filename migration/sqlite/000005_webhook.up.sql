@@ -0,0 +1,47 @@
+-- event_types хранится как JSON массив строк
+CREATE TABLE IF NOT EXISTS webhook_subscription
+(
+    subscription_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    CONSTRAINT webhook_subscription_pk PRIMARY KEY (subscription_id)
+);
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    delivery_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    subscription_id TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    locked_until INTEGER,
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    delivered_at INTEGER,
+    CONSTRAINT webhook_delivery_pk PRIMARY KEY (delivery_id),
+    CONSTRAINT webhook_delivery_subscription_id_event_id_key UNIQUE (subscription_id, event_id),
+    CONSTRAINT webhook_delivery_subscription_id_fk FOREIGN KEY (subscription_id)
+        REFERENCES webhook_subscription (subscription_id)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_pending_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_delivery_subscription_id_idx ON webhook_delivery (subscription_id, created_at);
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempt
+(
+    attempt_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    delivery_id TEXT NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    CONSTRAINT webhook_delivery_attempt_pk PRIMARY KEY (attempt_id),
+    CONSTRAINT webhook_delivery_attempt_delivery_id_fk FOREIGN KEY (delivery_id)
+        REFERENCES webhook_delivery (delivery_id)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS password_history
+(
+    password_history_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    user_id TEXT NOT NULL,
+    password TEXT NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    CONSTRAINT password_history_pk PRIMARY KEY (password_history_id),
+    CONSTRAINT password_history_user_id_fk FOREIGN KEY (user_id)
+        REFERENCES "user" (user_id)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS password_history_user_id_created_at_idx ON password_history (user_id, created_at DESC);
+INSERT INTO password_history (user_id, password) SELECT user_id, password FROM "user";
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS job_run
+(
+    name TEXT NOT NULL,
+    instance TEXT NOT NULL DEFAULT '',
+    started_at INTEGER NOT NULL,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    outcome TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    rows_affected INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT job_run_pk PRIMARY KEY (name)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS refresh_token_revoked_at_idx;
+DROP INDEX IF EXISTS refresh_token_expiration_at_idx;
+ALTER TABLE refresh_token DROP COLUMN revoked_at;
@@ -0,0 +1,5 @@
+ALTER TABLE refresh_token ADD COLUMN revoked_at INTEGER;
+-- время отзыва ранее отозванных токенов неизвестно, срок хранения отсчитывается от миграции
+UPDATE refresh_token SET revoked_at = CAST(unixepoch('subsec') * 1000000 AS INTEGER) WHERE is_revoke = 1 AND revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS refresh_token_expiration_at_idx ON refresh_token (expiration_at);
+CREATE INDEX IF NOT EXISTS refresh_token_revoked_at_idx ON refresh_token (revoked_at) WHERE is_revoke = 1;
@@ -0,0 +1,15 @@
+CREATE TABLE impersonation_old
+(
+    impersonation_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    admin_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    expiration_at INTEGER NOT NULL,
+    CONSTRAINT impersonation_pk PRIMARY KEY (impersonation_id)
+);
+INSERT INTO impersonation_old (impersonation_id, admin_id, user_id, reason, created_at, expiration_at)
+    SELECT impersonation_id, admin_id, user_id, reason, created_at, expiration_at FROM impersonation;
+DROP TABLE impersonation;
+ALTER TABLE impersonation_old RENAME TO impersonation;
+CREATE INDEX IF NOT EXISTS impersonation_user_id_idx ON impersonation (user_id);
@@ -0,0 +1,21 @@
+-- SQLite не добавляет внешний ключ в существующую таблицу, таблица пересоздается без записей удаленных пользователей
+CREATE TABLE impersonation_new
+(
+    impersonation_id TEXT NOT NULL DEFAULT (lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) || substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6)))),
+    admin_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000000 AS INTEGER)),
+    expiration_at INTEGER NOT NULL,
+    CONSTRAINT impersonation_pk PRIMARY KEY (impersonation_id),
+    CONSTRAINT impersonation_user_id_fk FOREIGN KEY (user_id)
+        REFERENCES "user" (user_id)
+        ON UPDATE CASCADE
+        ON DELETE CASCADE
+);
+INSERT INTO impersonation_new (impersonation_id, admin_id, user_id, reason, created_at, expiration_at)
+    SELECT impersonation_id, admin_id, user_id, reason, created_at, expiration_at FROM impersonation
+    WHERE user_id IN (SELECT user_id FROM "user");
+DROP TABLE impersonation;
+ALTER TABLE impersonation_new RENAME TO impersonation;
+CREATE INDEX IF NOT EXISTS impersonation_user_id_idx ON impersonation (user_id);
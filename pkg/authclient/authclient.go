@@ -0,0 +1,224 @@
+// Package authclient - клиент сервиса авторизации. TokenSource входит в сервис с учетными данными,
+// хранит токен доступа и обновляет его до истечения. TokenSource подключается к gRPC клиенту как
+// credentials.PerRPCCredentials и к HTTP клиенту как http.RoundTripper
+package authclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	auth "skillsRockGRPC/grpc/gen"
+	"skillsRockGRPC/pkg/jwt"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRefreshBefore = time.Minute
+	defaultTimeout       = 10 * time.Second
+	// retryDelay - пауза между попытками обновления, пока действующий токен доступа еще можно использовать
+	retryDelay = 5 * time.Second
+)
+
+// ErrInsecureTransport возвращается при попытке передать токен без TLS, если Config.Insecure не задан
+var ErrInsecureTransport = errors.New("authclient: token requires transport security")
+
+var errIncompleteClaims = errors.New("token has no id or expiration time")
+
+// Config - учетные данные и параметры обновления токена. Сервис отзывает токены устройства при новом входе,
+// поэтому DeviceCode не должен совпадать у разных TokenSource одного пользователя
+type Config struct {
+	Login      string
+	Password   string
+	DeviceCode string
+	// RefreshBefore - за сколько до истечения обновляется токен доступа, по умолчанию минута.
+	// Для коротких токенов обновление начинается не раньше половины срока действия
+	RefreshBefore time.Duration
+	// Timeout - срок вызова Login и RefreshToken, по умолчанию 10 секунд
+	Timeout time.Duration
+	// Insecure разрешает передавать токен по соединению без TLS
+	Insecure bool
+	// OnSessionRevoked вызывается, когда сервис отклонил refresh токен как отозванный или не найденный
+	// (повторное использование токена, выход, смена пароля). После вызова TokenSource входит заново
+	OnSessionRevoked func(err error)
+}
+
+// TokenSource выдает действующий токен доступа. Одновременные вызовы Token во время обновления ждут
+// одного вызова Login или RefreshToken, поэтому использованный refresh токен не отправляется повторно
+// и сервис не принимает ротацию за повторное использование
+type TokenSource struct {
+	client auth.AuthServiceClient
+	cfg    Config
+	now    func() time.Time
+
+	mu               sync.Mutex
+	accessToken      string
+	refreshAt        time.Time
+	expiresAt        time.Time
+	refreshTokenId   string
+	refreshExpiresAt time.Time
+	renewing         *renewal
+}
+
+// renewal - выполняемое обновление токена, которого ждут вызовы Token
+type renewal struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+func New(client auth.AuthServiceClient, cfg Config) *TokenSource {
+	if cfg.RefreshBefore <= 0 {
+		cfg.RefreshBefore = defaultRefreshBefore
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &TokenSource{
+		client: client,
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// Token возвращает токен доступа из кэша или получает новый. Ожидание обновления прерывается по ctx,
+// само обновление при этом продолжается для следующих вызовов
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	if s.accessToken != "" && s.now().Before(s.refreshAt) {
+		token := s.accessToken
+		s.mu.Unlock()
+		return token, nil
+	}
+	r := s.renewing
+	if r == nil {
+		r = &renewal{done: make(chan struct{})}
+		s.renewing = r
+		go s.renew(r)
+	}
+	s.mu.Unlock()
+	select {
+	case <-r.done:
+		return r.token, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate сбрасывает токен доступа, отклоненный сервисом, следующий вызов Token обновит его.
+// Токен, уже замененный другим вызовом, не сбрасывается
+func (s *TokenSource) Invalidate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken == accessToken {
+		s.accessToken = ""
+	}
+}
+
+func (s *TokenSource) renew(r *renewal) {
+	ctx, cancel := context.WithTimeout(withoutToken(context.Background()), s.cfg.Timeout)
+	defer cancel()
+	token, err := s.obtain(ctx)
+	s.mu.Lock()
+	r.token, r.err = token, err
+	s.renewing = nil
+	s.mu.Unlock()
+	close(r.done)
+}
+
+// obtain обновляет пару токенов по refresh токену, а если его нет или он отозван - входит заново
+func (s *TokenSource) obtain(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	accessToken, expiresAt := s.accessToken, s.expiresAt
+	refreshTokenId, refreshExpiresAt := s.refreshTokenId, s.refreshExpiresAt
+	s.mu.Unlock()
+
+	if refreshTokenId != "" && s.now().Before(refreshExpiresAt) {
+		resp, err := s.client.RefreshToken(ctx, &auth.RefreshTokenRequest{RefreshTokenId: refreshTokenId})
+		if err == nil {
+			return s.store(resp.AccessToken, resp.RefreshToken)
+		}
+		if !isSessionRevoked(err) {
+			//сервис недоступен: действующий токен доступа используется до истечения
+			if accessToken != "" && s.now().Before(expiresAt) {
+				s.mu.Lock()
+				s.refreshAt = minTime(s.now().Add(retryDelay), expiresAt)
+				s.mu.Unlock()
+				return accessToken, nil
+			}
+			return "", fmt.Errorf("authclient: refresh token: %w", err)
+		}
+		s.reset()
+		if s.cfg.OnSessionRevoked != nil {
+			s.cfg.OnSessionRevoked(err)
+		}
+	}
+	resp, err := s.client.Login(ctx, &auth.LoginRequest{
+		Login:      s.cfg.Login,
+		Password:   s.cfg.Password,
+		DeviceCode: s.cfg.DeviceCode,
+	})
+	if err != nil {
+		return "", fmt.Errorf("authclient: login: %w", err)
+	}
+	return s.store(resp.AccessToken, resp.RefreshToken)
+}
+
+// store запоминает выданную пару токенов. Подпись не проверяется: токены получены от сервиса,
+// из них нужны только сроки действия и идентификатор refresh токена
+func (s *TokenSource) store(accessToken string, refreshToken string) (string, error) {
+	access, err := jwt.ParseUnverified(accessToken)
+	if err == nil && access.ExpiresAt == nil {
+		err = errIncompleteClaims
+	}
+	if err != nil {
+		return "", fmt.Errorf("authclient: parse access token: %w", err)
+	}
+	refresh, err := jwt.ParseUnverified(refreshToken)
+	if err == nil && (refresh.Jti == nil || refresh.ExpiresAt == nil) {
+		err = errIncompleteClaims
+	}
+	if err != nil {
+		return "", fmt.Errorf("authclient: parse refresh token: %w", err)
+	}
+	expiresAt := access.ExpiresAt.Time
+	refreshBefore := s.cfg.RefreshBefore
+	if access.IssuedAt != nil {
+		refreshBefore = min(refreshBefore, expiresAt.Sub(access.IssuedAt.Time)/2)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = accessToken
+	s.expiresAt = expiresAt
+	s.refreshAt = expiresAt.Add(-refreshBefore)
+	s.refreshTokenId = refresh.Jti.String()
+	s.refreshExpiresAt = refresh.ExpiresAt.Time
+	return accessToken, nil
+}
+func (s *TokenSource) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = ""
+	s.refreshTokenId = ""
+}
+
+// isSessionRevoked сообщает, что refresh токен больше не примет сервис и нужен новый вход
+func isSessionRevoked(err error) bool {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason == servererrors.ReasonTokenRevoked || info.Reason == servererrors.ReasonTokenNotFound
+		}
+	}
+	return false
+}
+func minTime(a time.Time, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
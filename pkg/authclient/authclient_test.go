@@ -0,0 +1,259 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	auth "skillsRockGRPC/grpc/gen"
+	"skillsRockGRPC/internal/apptest"
+	"skillsRockGRPC/pkg/servererrors"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const password = "correct-horse-1"
+
+// countingClient считает вызовы Login и RefreshToken
+type countingClient struct {
+	auth.AuthServiceClient
+	logins    atomic.Int32
+	refreshes atomic.Int32
+}
+
+func (c *countingClient) Login(ctx context.Context, in *auth.LoginRequest, opts ...grpc.CallOption) (*auth.LoginResponse, error) {
+	c.logins.Add(1)
+	return c.AuthServiceClient.Login(ctx, in, opts...)
+}
+func (c *countingClient) RefreshToken(ctx context.Context, in *auth.RefreshTokenRequest, opts ...grpc.CallOption) (*auth.RefreshTokenResponse, error) {
+	c.refreshes.Add(1)
+	return c.AuthServiceClient.RefreshToken(ctx, in, opts...)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newAdmin регистрирует администратора, токены которого принимают методы с проверкой доступа
+func newAdmin(t *testing.T, h *apptest.Harness) string {
+	t.Helper()
+	resp, err := h.Auth.Register(context.Background(), &auth.RegisterRequest{Login: "admin", Password: password})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	userId := uuid.MustParse(resp.UserId)
+	h.Store.MakeAdmin(&userId)
+	return resp.UserId
+}
+func adminConfig() Config {
+	return Config{Login: "admin", Password: password, DeviceCode: "console", Insecure: true}
+}
+
+// advance переводит часы TokenSource вперед, чтобы токен доступа требовал обновления
+func advance(s *TokenSource, d time.Duration) {
+	s.now = func() time.Time { return time.Now().Add(d) }
+}
+func token(t *testing.T, s *TokenSource) string {
+	t.Helper()
+	token, err := s.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	return token
+}
+
+func TestTokenSourceCache(t *testing.T) {
+	h := apptest.New(t)
+	newAdmin(t, h)
+	client := &countingClient{AuthServiceClient: h.Auth}
+	s := New(client, adminConfig())
+
+	first := token(t, s)
+	if second := token(t, s); second != first {
+		t.Fatal("Token did not return cached token")
+	}
+	if h.Claims(t, first).DeviceCode != "console" {
+		t.Fatalf("access token claims = %+v", h.Claims(t, first))
+	}
+	if client.logins.Load() != 1 || client.refreshes.Load() != 0 {
+		t.Fatalf("logins = %d, refreshes = %d", client.logins.Load(), client.refreshes.Load())
+	}
+}
+
+func TestTokenSourceRefresh(t *testing.T) {
+	h := apptest.New(t)
+	newAdmin(t, h)
+	client := &countingClient{AuthServiceClient: h.Auth}
+	s := New(client, adminConfig())
+	first := token(t, s)
+
+	//одновременные вызовы ждут одного обновления: повторная отправка использованного refresh токена
+	//отозвала бы все токены устройства
+	advance(s, h.Config.Token.AccessLifetime)
+	tokens := make([]string, 16)
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], _ = s.Token(context.Background())
+		}()
+	}
+	wg.Wait()
+	for _, tok := range tokens {
+		if tok == "" || tok != tokens[0] || tok == first {
+			t.Fatalf("tokens after refresh = %v", tokens)
+		}
+	}
+	if client.logins.Load() != 1 || client.refreshes.Load() != 1 {
+		t.Fatalf("logins = %d, refreshes = %d", client.logins.Load(), client.refreshes.Load())
+	}
+
+	//новый refresh токен действует
+	advance(s, 2*h.Config.Token.AccessLifetime)
+	if token(t, s) == tokens[0] {
+		t.Fatal("Token did not refresh rotated token")
+	}
+	if client.logins.Load() != 1 || client.refreshes.Load() != 2 {
+		t.Fatalf("logins = %d, refreshes = %d", client.logins.Load(), client.refreshes.Load())
+	}
+}
+
+func TestTokenSourceRefreshBefore(t *testing.T) {
+	h := apptest.New(t)
+	newAdmin(t, h)
+	cfg := adminConfig()
+	cfg.RefreshBefore = 10 * time.Minute
+	s := New(h.Auth, cfg)
+	first := token(t, s)
+
+	advance(s, h.Config.Token.AccessLifetime-11*time.Minute)
+	if token(t, s) != first {
+		t.Fatal("Token refreshed token before RefreshBefore")
+	}
+	advance(s, h.Config.Token.AccessLifetime-9*time.Minute)
+	if token(t, s) == first {
+		t.Fatal("Token did not refresh token within RefreshBefore")
+	}
+}
+
+func TestTokenSourceSessionRevoked(t *testing.T) {
+	h := apptest.New(t)
+	userId := newAdmin(t, h)
+	client := &countingClient{AuthServiceClient: h.Auth}
+	var revoked error
+	cfg := adminConfig()
+	cfg.OnSessionRevoked = func(err error) { revoked = err }
+	s := New(client, cfg)
+	token(t, s)
+
+	//после выхода refresh токен отозван, TokenSource входит заново
+	if _, err := h.Auth.Logout(context.Background(), &auth.LogoutRequest{UserId: userId, DeviceCode: "console"}); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	advance(s, h.Config.Token.AccessLifetime)
+	tok := token(t, s)
+	if apptest.Reason(revoked) != servererrors.ReasonTokenRevoked {
+		t.Fatalf("OnSessionRevoked error = %v", revoked)
+	}
+	if client.logins.Load() != 2 {
+		t.Fatalf("logins = %d", client.logins.Load())
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tok)
+	if _, err := h.Auth.ListJobs(ctx, &auth.ListJobsRequest{}); err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+}
+
+func TestTokenSourceInvalidCredentials(t *testing.T) {
+	h := apptest.New(t)
+	newAdmin(t, h)
+	cfg := adminConfig()
+	cfg.Password = "wrong-password-1"
+	s := New(h.Auth, cfg)
+	_, err := s.Token(context.Background())
+	if apptest.Reason(err) != servererrors.ReasonInvalidCredentials {
+		t.Fatalf("Token error = %v", err)
+	}
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	h := apptest.New(t)
+	newAdmin(t, h)
+
+	//Login и RefreshToken идут через то же соединение без токена
+	s := New(nil, adminConfig())
+	s.client = h.Dial(t, grpc.WithPerRPCCredentials(s))
+	if _, err := s.client.ListJobs(context.Background(), &auth.ListJobsRequest{}); err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	advance(s, h.Config.Token.AccessLifetime)
+	if _, err := s.client.ListJobs(context.Background(), &auth.ListJobsRequest{}); err != nil {
+		t.Fatalf("ListJobs after refresh: %v", err)
+	}
+
+	//без Insecure токен не передается по соединению без TLS
+	cfg := adminConfig()
+	cfg.Insecure = false
+	_, err := h.Auth.ListJobs(context.Background(), &auth.ListJobsRequest{}, grpc.PerRPCCredentials(New(h.Auth, cfg)))
+	if status.Code(err) != codes.Unauthenticated || apptest.Reason(err) != "" {
+		t.Fatalf("ListJobs over insecure connection = %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	h := apptest.New(t)
+	newAdmin(t, h)
+	s := New(h.Auth, adminConfig())
+	client := &http.Client{Transport: s.Transport(h.HTTP.Transport())}
+	post := func() *http.Response {
+		t.Helper()
+		resp, err := client.Post(h.HTTP.URL("/api/v1/listjobs"), "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	//ответ 401 сбрасывает токен, запрос повторяется с новым токеном
+	var authorizations []string
+	rejected := false
+	client.Transport = s.Transport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		authorizations = append(authorizations, req.Header.Get("Authorization"))
+		if !rejected {
+			rejected = true
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody, Request: req}, nil
+		}
+		return h.HTTP.Transport().RoundTrip(req)
+	}))
+	if resp := post(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("status after retry = %d", resp.StatusCode)
+	}
+	if len(authorizations) != 2 || authorizations[0] == authorizations[1] {
+		t.Fatalf("authorizations = %v", authorizations)
+	}
+
+	//без Insecure токен не передается по http
+	cfg := adminConfig()
+	cfg.Insecure = false
+	client.Transport = New(h.Auth, cfg).Transport(h.HTTP.Transport())
+	_, err := client.Post(h.HTTP.URL("/api/v1/listjobs"), "application/json", strings.NewReader("{}"))
+	if !errors.Is(err, ErrInsecureTransport) {
+		t.Fatalf("POST over http = %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package authclient
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+var _ credentials.PerRPCCredentials = (*TokenSource)(nil)
+
+// withoutTokenKey отмечает вызовы Login и RefreshToken самого TokenSource. Если TokenSource подключен
+// к тому же соединению, что и его клиент, эти вызовы идут без токена и не ждут сами себя
+type withoutTokenKey struct{}
+
+func withoutToken(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutTokenKey{}, true)
+}
+
+// GetRequestMetadata добавляет к вызову заголовок "authorization: Bearer <token>"
+func (s *TokenSource) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if ctx.Value(withoutTokenKey{}) != nil {
+		return nil, nil
+	}
+	token, err := s.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity запрещает передачу токена по соединению без TLS, если Config.Insecure не задан
+func (s *TokenSource) RequireTransportSecurity() bool {
+	return !s.cfg.Insecure
+}
@@ -0,0 +1,71 @@
+package authclient
+
+import (
+	"net/http"
+)
+
+// Transport добавляет токен доступа к запросам HTTP шлюза. Ответ 401 означает, что сервис отклонил токен:
+// токен сбрасывается и запрос один раз повторяется с новым токеном, если тело запроса можно прочитать заново
+type Transport struct {
+	Source *TokenSource
+	// Base выполняет запросы, по умолчанию http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// Transport возвращает http.RoundTripper, добавляющий токен доступа к запросам base
+func (s *TokenSource) Transport(base http.RoundTripper) *Transport {
+	return &Transport{Source: s, Base: base}
+}
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" && !t.Source.cfg.Insecure {
+		closeBody(req)
+		return nil, ErrInsecureTransport
+	}
+	token, err := t.Source.Token(req.Context())
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	resp, err := t.base().RoundTrip(withToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	t.Source.Invalidate(token)
+	retryToken, err := t.Source.Token(req.Context())
+	if err != nil || retryToken == token {
+		return resp, nil
+	}
+	retryReq := withToken(req, retryToken)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retryReq.Body = body
+	}
+	resp.Body.Close()
+	return t.base().RoundTrip(retryReq)
+}
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// withToken копирует запрос с заголовком Authorization, RoundTripper не должен изменять исходный запрос
+func withToken(req *http.Request, token string) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// closeBody закрывает тело запроса, как требует контракт http.RoundTripper и при ошибке
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -2,6 +2,8 @@ package jwt
 
 import (
 	"crypto/rsa"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,34 +17,120 @@ import (
 //exp (expiration time) — время, когда токен станет невалидным;
 //nbf (not before) — время, с которого токен должен считаться действительным;
 //iat (issued at) — время, в которое был выдан токен;
+//act (actor) — сервис, действующий от имени субъекта (RFC 8693);
 
 type TokenClaims struct {
 	Jti        *uuid.UUID `json:"jti"`
 	Sub        *uuid.UUID `json:"sub"`
 	DeviceCode string     `json:"device"`
 	TokenType  string     `json:"type"`
+	Scope      string     `json:"scope,omitempty"`
+	Act        *Actor     `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor - claim "act". Вложенный Act описывает предыдущее звено цепочки делегирования
+type Actor struct {
+	Sub string `json:"sub"`
+	Act *Actor `json:"act,omitempty"`
+}
+
+var ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+
 func CreateToken(userId *uuid.UUID, deviceCode string, tokenType string, lifetime time.Duration, privateKey *rsa.PrivateKey) (string, *TokenClaims, error) {
 	tokenId := uuid.New()
 	now := time.Now()
 	tokenClaims := TokenClaims{
-		&tokenId,
-		userId,
-		deviceCode,
-		tokenType,
-		jwt.RegisteredClaims{
+		Jti:        &tokenId,
+		Sub:        userId,
+		DeviceCode: deviceCode,
+		TokenType:  tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return signToken(&tokenClaims, privateKey)
+}
+
+// CreateExchangeToken выпускает токен доступа для audience от имени субъекта subject. Сервис actor
+// записывается в claim "act", при повторном обмене предыдущий actor сохраняется во вложенном "act"
+func CreateExchangeToken(subject *TokenClaims, actor string, audience string, scopes []string, lifetime time.Duration, privateKey *rsa.PrivateKey) (string, *TokenClaims, error) {
+	tokenId := uuid.New()
+	now := time.Now()
+	tokenClaims := TokenClaims{
+		Jti:        &tokenId,
+		Sub:        subject.Sub,
+		DeviceCode: subject.DeviceCode,
+		TokenType:  subject.TokenType,
+		Scope:      strings.Join(scopes, " "),
+		Act: &Actor{
+			Sub: actor,
+			Act: subject.Act,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{audience},
 			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
 			NotBefore: jwt.NewNumericDate(now),
 			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
+	return signToken(&tokenClaims, privateKey)
+}
+
+// CreateImpersonationToken выпускает токен доступа пользователя userId для администратора adminId.
+// Администратор записывается в claim "act"
+func CreateImpersonationToken(userId *uuid.UUID, adminId *uuid.UUID, deviceCode string, lifetime time.Duration, privateKey *rsa.PrivateKey) (string, *TokenClaims, error) {
+	tokenId := uuid.New()
+	now := time.Now()
+	tokenClaims := TokenClaims{
+		Jti:        &tokenId,
+		Sub:        userId,
+		DeviceCode: deviceCode,
+		TokenType:  "access",
+		Act: &Actor{
+			Sub: adminId.String(),
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return signToken(&tokenClaims, privateKey)
+}
+
+// ParseToken проверяет подпись и срок действия токена
+func ParseToken(tokenString string, publicKey *rsa.PublicKey) (*TokenClaims, error) {
+	tokenClaims := new(TokenClaims)
+	_, err := jwt.ParseWithClaims(tokenString, tokenClaims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, ErrUnexpectedSigningMethod
+		}
+		return publicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	return tokenClaims, nil
+}
+
+// ParseUnverified разбирает claims токена без проверки подписи и срока действия. Используется клиентами,
+// которым нужен только срок действия и идентификатор своего токена
+func ParseUnverified(tokenString string) (*TokenClaims, error) {
+	tokenClaims := new(TokenClaims)
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, tokenClaims); err != nil {
+		return nil, err
+	}
+	return tokenClaims, nil
+}
+
+func signToken(tokenClaims *TokenClaims, privateKey *rsa.PrivateKey) (string, *TokenClaims, error) {
 	tokenJwt := jwt.NewWithClaims(jwt.SigningMethodRS256, tokenClaims)
 	tokenString, err := tokenJwt.SignedString(privateKey)
 	if err != nil {
 		return "", nil, err
 	}
-	return tokenString, &tokenClaims, nil
-
+	return tokenString, tokenClaims, nil
 }
@@ -0,0 +1,112 @@
+// Package secret разрешает ссылки на секреты вида "<схема>://<ссылка>": file:///run/secrets/db_password,
+// env://DB_PASSWORD, vault://secret/auth#dbPassword. Значение без зарегистрированной схемы считается
+// самим секретом
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Provider возвращает секрет по ссылке без схемы
+type Provider interface {
+	Secret(ctx context.Context, ref string) (string, error)
+}
+
+// ProviderFunc позволяет использовать функцию как Provider
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f ProviderFunc) Secret(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// Resolver выбирает провайдера по схеме ссылки
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver создает Resolver со встроенными провайдерами file и env
+func NewResolver() *Resolver {
+	r := &Resolver{providers: map[string]Provider{}}
+	r.Register("file", FileProvider{})
+	r.Register("env", EnvProvider{})
+	return r
+}
+
+// Register добавляет или заменяет провайдера схемы scheme
+func (r *Resolver) Register(scheme string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[scheme] = provider
+}
+
+// IsRef сообщает, является ли value ссылкой на секрет зарегистрированной схемы
+func (r *Resolver) IsRef(value string) bool {
+	_, _, ok := r.provider(value)
+	return ok
+}
+
+// Resolve возвращает секрет по ссылке value или value без изменений, если это не ссылка
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	provider, ref, ok := r.provider(value)
+	if !ok {
+		return value, nil
+	}
+	secret, err := provider.Secret(ctx, ref)
+	if err != nil {
+		//сама ссылка не секретна и помогает найти ошибку в конфигурации
+		return "", fmt.Errorf("resolve '%s': %w", value, err)
+	}
+	return secret, nil
+}
+func (r *Resolver) provider(value string) (Provider, string, bool) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return nil, "", false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[scheme]
+	return provider, ref, ok
+}
+
+// FileProvider читает секрет из файла, завершающий перевод строки отбрасывается. Для file:///run/secrets/db
+// ссылка - абсолютный путь /run/secrets/db
+type FileProvider struct{}
+
+func (FileProvider) Secret(_ context.Context, ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// EnvProvider читает секрет из переменной окружения
+type EnvProvider struct{}
+
+func (EnvProvider) Secret(_ context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable '%s': %w", ref, ErrNotFound)
+	}
+	return value, nil
+}
+
+// Static - провайдер с секретами в памяти для тестов и локальной разработки
+type Static map[string]string
+
+func (s Static) Secret(_ context.Context, ref string) (string, error) {
+	value, ok := s[ref]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
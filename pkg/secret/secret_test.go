@@ -0,0 +1,98 @@
+package secret_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"skillsRockGRPC/pkg/secret"
+)
+
+func TestResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf("write secret file: %v", err)
+	}
+	t.Setenv("SECRET_TEST_PASSWORD", "from-env")
+	resolver := secret.NewResolver()
+	resolver.Register("static", secret.Static{"db": "from-static"})
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		err   error
+	}{
+		{name: "plain", value: "postgres", want: "postgres"},
+		{name: "empty", value: "", want: ""},
+		{name: "unknown scheme", value: "https://example.com/hook", want: "https://example.com/hook"},
+		{name: "file", value: "file://" + path, want: "from-file"},
+		{name: "env", value: "env://SECRET_TEST_PASSWORD", want: "from-env"},
+		{name: "registered", value: "static://db", want: "from-static"},
+		{name: "missing env", value: "env://SECRET_TEST_MISSING", err: secret.ErrNotFound},
+		{name: "missing static", value: "static://other", err: secret.ErrNotFound},
+		{name: "missing file", value: "file://" + path + ".missing", err: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.value)
+			if tt.err != nil {
+				//ошибка называет ссылку, но не содержит значения
+				if !errors.Is(err, tt.err) || !strings.Contains(err.Error(), tt.value) {
+					t.Fatalf("Resolve(%q) error = %v, want %v", tt.value, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+			}
+			if isRef := got != tt.value; resolver.IsRef(tt.value) != isRef {
+				t.Fatalf("IsRef(%q) = %v", tt.value, !isRef)
+			}
+		})
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/auth":
+			w.Write([]byte(`{"data":{"data":{"dbPassword":"from-vault","port":5432},"metadata":{"version":3}}}`))
+		case "/v1/secret/data/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	provider := secret.NewVaultProvider(server.URL+"/", "vault-token", time.Second)
+
+	got, err := provider.Secret(context.Background(), "secret/auth#dbPassword")
+	if err != nil || got != "from-vault" {
+		t.Fatalf("Secret = %q, %v", got, err)
+	}
+	for _, ref := range []string{"secret/auth#missing", "secret/auth#port", "secret/other#dbPassword"} {
+		if _, err := provider.Secret(context.Background(), ref); !errors.Is(err, secret.ErrNotFound) {
+			t.Fatalf("Secret(%s) error = %v, want %v", ref, err, secret.ErrNotFound)
+		}
+	}
+	for _, ref := range []string{"secret/broken#key", "secret/auth", "secret#key", "/auth#key"} {
+		if _, err := provider.Secret(context.Background(), ref); err == nil || errors.Is(err, secret.ErrNotFound) {
+			t.Fatalf("Secret(%s) error = %v", ref, err)
+		}
+	}
+	forbidden := secret.NewVaultProvider(server.URL, "wrong-token", time.Second)
+	if _, err := forbidden.Secret(context.Background(), "secret/auth#dbPassword"); err == nil {
+		t.Fatal("Secret with wrong token: no error")
+	}
+}
@@ -0,0 +1,64 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VaultProvider читает секреты из хранилища KV версии 2 HashiCorp Vault. Ссылка "<mount>/<path>#<key>":
+// vault://secret/auth#dbPassword - поле dbPassword последней версии секрета auth в хранилище secret
+type VaultProvider struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewVaultProvider(addr string, token string, timeout time.Duration) *VaultProvider {
+	return &VaultProvider{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (v *VaultProvider) Secret(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	mount, path, okPath := strings.Cut(path, "/")
+	if !ok || !okPath || mount == "" || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference must be '<mount>/<path>#<key>', got '%s'", ref)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+url.PathEscape(mount)+"/data/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responded with status %d", resp.StatusCode)
+	}
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault response: %w", err)
+	}
+	value, ok := body.Data.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("key '%s': %w", key, ErrNotFound)
+	}
+	return value, nil
+}
@@ -25,6 +25,11 @@ func LoadPrivateKey(privateKeyPath string) (*rsa.PrivateKey, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParsePrivateKey(privateKeyByteArray)
+}
+
+// ParsePrivateKey разбирает ключ RSA в формате PEM (RSA PRIVATE KEY)
+func ParsePrivateKey(privateKeyByteArray []byte) (*rsa.PrivateKey, error) {
 	privateKeyPemBlock, _ := pem.Decode(privateKeyByteArray)
 	if privateKeyPemBlock == nil || privateKeyPemBlock.Type != "RSA PRIVATE KEY" {
 		return nil, errors.New("decoding error. The PEM block was not found or the type is not equal to RSA PRIVATE KEY")
@@ -3,13 +3,31 @@ package servererrors
 import "errors"
 
 var (
-	ErrInternalServerError       = errors.New("internal server error")
-	ErrInvalidLoginOrPassword    = errors.New("invalid login or password")
-	ErrLoginAlreadyExists        = errors.New("login already exists")
-	ErrInvalidArgumentUserId     = errors.New("invalid user id value")
-	ErrInvalidArgumentTokenId    = errors.New("invalid token id value")
-	ErrInvalidArgumentDeviceCode = errors.New("invalid device code value")
-	ErrTokenRevoked              = errors.New("token is revoke")
-	ErrUserNotFound              = errors.New("user not found")
-	ErrTokenNotFound             = errors.New("token not found")
+	ErrInternalServerError           = errors.New("internal server error")
+	ErrInvalidLoginOrPassword        = errors.New("invalid login or password")
+	ErrLoginAlreadyExists            = errors.New("login already exists")
+	ErrInvalidArgumentUserId         = errors.New("invalid user id value")
+	ErrInvalidArgumentTokenId        = errors.New("invalid token id value")
+	ErrInvalidArgumentDeviceCode     = errors.New("invalid device code value")
+	ErrTokenRevoked                  = errors.New("token is revoke")
+	ErrUserNotFound                  = errors.New("user not found")
+	ErrTokenNotFound                 = errors.New("token not found")
+	ErrInvalidArgumentAudience       = errors.New("invalid audience value")
+	ErrInvalidSubjectToken           = errors.New("invalid subject token")
+	ErrInvalidActorCredentials       = errors.New("invalid actor name or secret")
+	ErrAudienceNotAllowed            = errors.New("audience is not allowed for actor")
+	ErrScopeNotAllowed               = errors.New("scope is not allowed for actor")
+	ErrInvalidAccessToken            = errors.New("invalid access token")
+	ErrPermissionDenied              = errors.New("permission denied")
+	ErrCannotImpersonateSelf         = errors.New("cannot impersonate yourself")
+	ErrInvalidArgumentTimeRange      = errors.New("invalid time range value")
+	ErrInvalidArgumentWebhookUrl     = errors.New("invalid webhook url value")
+	ErrInvalidArgumentEventType      = errors.New("invalid event type value")
+	ErrInvalidArgumentSubscriptionId = errors.New("invalid subscription id value")
+	ErrInvalidArgumentDeliveryId     = errors.New("invalid delivery id value")
+	ErrSubscriptionNotFound          = errors.New("subscription not found")
+	ErrDeliveryNotFound              = errors.New("delivery not found")
+	ErrSigningKeyNotLoaded           = errors.New("signing key is not loaded")
+	ErrJobNotFound                   = errors.New("job not found")
+	ErrJobRunning                    = errors.New("job is already running")
 )
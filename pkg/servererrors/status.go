@@ -0,0 +1,143 @@
+package servererrors
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain - домен причин ошибок в google.rpc.ErrorInfo
+const Domain = "auth.skillsrock"
+
+// Причины ошибок google.rpc.ErrorInfo. Значения не меняются, клиенты могут на них опираться
+const (
+	ReasonInternal                = "INTERNAL"
+	ReasonUnavailable             = "UNAVAILABLE"
+	ReasonInvalidArgument         = "INVALID_ARGUMENT"
+	ReasonInvalidCredentials      = "INVALID_CREDENTIALS"
+	ReasonLoginAlreadyExists      = "LOGIN_ALREADY_EXISTS"
+	ReasonTokenRevoked            = "TOKEN_REVOKED"
+	ReasonUserNotFound            = "USER_NOT_FOUND"
+	ReasonTokenNotFound           = "TOKEN_NOT_FOUND"
+	ReasonInvalidSubjectToken     = "INVALID_SUBJECT_TOKEN"
+	ReasonInvalidActorCredentials = "INVALID_ACTOR_CREDENTIALS"
+	ReasonAudienceNotAllowed      = "AUDIENCE_NOT_ALLOWED"
+	ReasonScopeNotAllowed         = "SCOPE_NOT_ALLOWED"
+	ReasonInvalidAccessToken      = "INVALID_ACCESS_TOKEN"
+	ReasonPermissionDenied        = "PERMISSION_DENIED"
+	ReasonCannotImpersonateSelf   = "CANNOT_IMPERSONATE_SELF"
+	ReasonSubscriptionNotFound    = "SUBSCRIPTION_NOT_FOUND"
+	ReasonDeliveryNotFound        = "DELIVERY_NOT_FOUND"
+	ReasonSigningKeyNotLoaded     = "SIGNING_KEY_NOT_LOADED"
+	ReasonJobNotFound             = "JOB_NOT_FOUND"
+	ReasonJobRunning              = "JOB_RUNNING"
+)
+
+var ErrUnavailable = errors.New("service is temporarily unavailable")
+
+var reasons = map[error]string{
+	ErrInternalServerError:           ReasonInternal,
+	ErrUnavailable:                   ReasonUnavailable,
+	ErrInvalidLoginOrPassword:        ReasonInvalidCredentials,
+	ErrLoginAlreadyExists:            ReasonLoginAlreadyExists,
+	ErrInvalidArgumentUserId:         ReasonInvalidArgument,
+	ErrInvalidArgumentTokenId:        ReasonInvalidArgument,
+	ErrInvalidArgumentDeviceCode:     ReasonInvalidArgument,
+	ErrTokenRevoked:                  ReasonTokenRevoked,
+	ErrUserNotFound:                  ReasonUserNotFound,
+	ErrTokenNotFound:                 ReasonTokenNotFound,
+	ErrInvalidArgumentAudience:       ReasonInvalidArgument,
+	ErrInvalidSubjectToken:           ReasonInvalidSubjectToken,
+	ErrInvalidActorCredentials:       ReasonInvalidActorCredentials,
+	ErrAudienceNotAllowed:            ReasonAudienceNotAllowed,
+	ErrScopeNotAllowed:               ReasonScopeNotAllowed,
+	ErrInvalidAccessToken:            ReasonInvalidAccessToken,
+	ErrPermissionDenied:              ReasonPermissionDenied,
+	ErrCannotImpersonateSelf:         ReasonCannotImpersonateSelf,
+	ErrInvalidArgumentTimeRange:      ReasonInvalidArgument,
+	ErrInvalidArgumentWebhookUrl:     ReasonInvalidArgument,
+	ErrInvalidArgumentEventType:      ReasonInvalidArgument,
+	ErrInvalidArgumentSubscriptionId: ReasonInvalidArgument,
+	ErrInvalidArgumentDeliveryId:     ReasonInvalidArgument,
+	ErrSubscriptionNotFound:          ReasonSubscriptionNotFound,
+	ErrDeliveryNotFound:              ReasonDeliveryNotFound,
+	ErrSigningKeyNotLoaded:           ReasonSigningKeyNotLoaded,
+	ErrJobNotFound:                   ReasonJobNotFound,
+	ErrJobRunning:                    ReasonJobRunning,
+}
+
+// Reason возвращает причину ошибки для google.rpc.ErrorInfo, для неизвестных ошибок - INTERNAL
+func Reason(err error) string {
+	for target, reason := range reasons {
+		if errors.Is(err, target) {
+			return reason
+		}
+	}
+	return ReasonInternal
+}
+
+// FieldViolation - нарушение ограничения поля запроса
+type FieldViolation struct {
+	Field string
+	Err   error
+}
+
+// Status возвращает gRPC статус с сообщением err и причиной в google.rpc.ErrorInfo
+func Status(code codes.Code, err error) error {
+	return withDetails(status.New(code, err.Error()), errorInfo(Reason(err), nil))
+}
+
+// InvalidArgument возвращает статус InvalidArgument с нарушениями полей запроса в google.rpc.BadRequest.
+// Сообщение статуса - описание первого нарушения
+func InvalidArgument(violations ...*FieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Err.Error(),
+		})
+	}
+	return withDetails(
+		status.New(codes.InvalidArgument, violations[0].Err.Error()),
+		errorInfo(ReasonInvalidArgument, map[string]string{"field": violations[0].Field}),
+		badRequest,
+	)
+}
+
+// Field возвращает статус InvalidArgument с одним нарушением поля запроса
+func Field(field string, err error) error {
+	return InvalidArgument(&FieldViolation{Field: field, Err: err})
+}
+
+// Internal возвращает статус Internal без подробностей об ошибке
+func Internal() error {
+	return Status(codes.Internal, ErrInternalServerError)
+}
+
+// Unavailable возвращает статус Unavailable с рекомендуемой задержкой перед повтором в google.rpc.RetryInfo
+func Unavailable(retryDelay time.Duration) error {
+	return withDetails(
+		status.New(codes.Unavailable, ErrUnavailable.Error()),
+		errorInfo(ReasonUnavailable, nil),
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryDelay)},
+	)
+}
+func errorInfo(reason string, metadata map[string]string) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   Domain,
+		Metadata: metadata,
+	}
+}
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) error {
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}